@@ -9,6 +9,7 @@ import (
 
 	apiserver "github.com/kun1ts4/stars-analytics/internal/api"
 	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -30,6 +31,9 @@ func main() {
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect database")
 	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		logger.WithError(err).Fatal("database schema check failed")
+	}
 
 	serverManager, err := apiserver.NewManager(cfg, db)
 	if err != nil {
@@ -0,0 +1,258 @@
+// cmd/backfill/main.go
+// Команда backfill загружает произвольный диапазон часов GH Archive (или локального каталога) в Kafka
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/ingestion"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
+	gormrepo "github.com/kun1ts4/stars-analytics/internal/storage/gorm"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	fromFlag := flag.String("from", "", "first hour to load in "+ingestion.HourLayout+
+		" format (UTC), inclusive; defaults to the first file for the dir source")
+	toFlag := flag.String("to", "", "last hour to load in "+ingestion.HourLayout+
+		" format (UTC), exclusive; defaults to after the last file for the dir source")
+	parallel := flag.Int("parallel", 4, "number of hours processed concurrently")
+	list := flag.Bool("list", false, "print the ingestion ledger for -from/-to (default: last 24 hours) and exit")
+	listFailed := flag.Bool("list-failed", false, "print hours recorded as failed and exit")
+	retryFailed := flag.Bool("retry-failed", false, "reload hours recorded as failed instead of a range")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		_, _ = fmt.Fprintf(out, "usage: %s [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+		_, _ = fmt.Fprintln(out, "\nexit status is 1 if the backfill was interrupted or left failed or refused hours")
+	}
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load config")
+	}
+
+	source, err := ingestion.NewEventSource(&http.Client{}, cfg.Ingestion)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create event source")
+	}
+
+	filter, err := ingestion.NewEventFilter(cfg.Ingestion.Filter)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid filter config")
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect database")
+	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		logger.WithError(err).Fatal("database schema check failed")
+	}
+	hours := gormrepo.NewHourRepo(db)
+
+	if *list {
+		if err := printLedger(ctx, hours, *fromFlag, *toFlag); err != nil {
+			logger.WithError(err).Fatal("failed to list ingestion ledger")
+		}
+		return
+	}
+	if *listFailed {
+		if err := printFailedHours(ctx, hours); err != nil {
+			logger.WithError(err).Fatal("failed to list failed hours")
+		}
+		return
+	}
+
+	var from, to time.Time
+	if !*retryFailed {
+		from, to, err = resolveRange(*fromFlag, *toFlag, source)
+		if err != nil {
+			logger.WithError(err).Fatal("invalid range")
+		}
+	}
+
+	producer := ingestion.NewKafkaProducer(cfg.Kafka)
+
+	fetcher := ingestion.NewGHArchiveFetcher(source, from, producer, filter, nil, hours, cfg.Ingestion)
+	dedupWindow := time.Duration(cfg.Processor.DedupRetentionHours) * time.Hour
+	backfiller := ingestion.NewBackfiller(fetcher, hours, *parallel, dedupWindow)
+
+	var report ingestion.BackfillReport
+	if *retryFailed {
+		report, err = backfiller.RetryFailed(ctx)
+	} else {
+		report, err = backfiller.Run(ctx, from, to)
+	}
+	if err := producer.Close(); err != nil {
+		logger.WithError(err).Error("failed to close producer")
+	}
+
+	entry := logger.WithFields(logrus.Fields{
+		"total":     report.Total,
+		"skipped":   report.Skipped,
+		"completed": report.Completed,
+		"failed":    len(report.Failed),
+		"refused":   len(report.Refused),
+	})
+	if err != nil {
+		entry.WithError(err).Fatal("backfill interrupted, rerun the same command to resume")
+	}
+	partial := false
+	if len(report.Refused) > 0 {
+		entry.WithField("hours", formatHours(report.Refused)).
+			Error("refused hours partially loaded before the dedup window, reloading them would double count events")
+		partial = true
+	}
+	if len(report.Failed) > 0 {
+		entry.Error("backfill finished with failed hours, rerun the same command or use -retry-failed")
+		partial = true
+	}
+	// Ненулевой код позволяет скриптам отличить частичную загрузку от полной.
+	if partial {
+		os.Exit(1)
+	}
+	entry.Info("backfill completed")
+}
+
+// printLedger печатает журнал загрузки часов диапазона в виде таблицы.
+// Часы без записи выводятся со статусом missing.
+func printLedger(ctx context.Context, hours *gormrepo.HourRepo, fromFlag, toFlag string) error {
+	to := time.Now().UTC().Truncate(time.Hour)
+	if toFlag != "" {
+		var err error
+		if to, err = ingestion.ParseHour(toFlag); err != nil {
+			return err
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if fromFlag != "" {
+		var err error
+		if from, err = ingestion.ParseHour(fromFlag); err != nil {
+			return err
+		}
+	}
+
+	entries, err := hours.Hours(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	recorded := make(map[time.Time]domain.IngestedHour, len(entries))
+	for _, entry := range entries {
+		recorded[entry.Hour.UTC()] = entry
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOUR\tSTATUS\tBYTES\tLINES\tPARSE FAILURES\tEVENTS\tFILTERED\t"+
+		"SEND FAILURES\tOVERSIZED\tTRUNCATED\tDURATION\tATTEMPTS")
+	for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+		entry, ok := recorded[hour]
+		if !ok {
+			_, _ = fmt.Fprintf(w, "%s\tmissing\t\t\t\t\t\t\t\t\t\t\n", hour.Format(ingestion.HourLayout))
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%t\t%s\t%d\n",
+			hour.Format(ingestion.HourLayout),
+			entry.Status,
+			entry.BytesDownloaded,
+			entry.LinesParsed,
+			entry.ParseFailures,
+			entry.EventsProduced,
+			entry.FilteredEvents,
+			entry.SendFailures,
+			entry.OversizedLines,
+			entry.Truncated,
+			time.Duration(entry.DurationMs)*time.Millisecond,
+			entry.Attempts,
+		)
+	}
+	return w.Flush()
+}
+
+// printFailedHours печатает неудачные часы в виде таблицы.
+func printFailedHours(ctx context.Context, hours *gormrepo.HourRepo) error {
+	failed, err := hours.FailedHours(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOUR\tATTEMPTS\tFAILED AT\tLAST ERROR")
+	for _, hour := range failed {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+			hour.Hour.UTC().Format(ingestion.HourLayout),
+			hour.Attempts,
+			hour.UpdatedAt.UTC().Format(time.RFC3339),
+			hour.LastError,
+		)
+	}
+	return w.Flush()
+}
+
+// resolveRange разбирает диапазон часов из флагов. Для каталога незаданные
+// границы берутся из имеющихся в нем файлов.
+func resolveRange(fromFlag, toFlag string, source ingestion.EventSource) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromFlag != "" {
+		if from, err = ingestion.ParseHour(fromFlag); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("-from: %w", err)
+		}
+	}
+	if toFlag != "" {
+		if to, err = ingestion.ParseHour(toFlag); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("-to: %w", err)
+		}
+	}
+
+	if dir, ok := source.(*ingestion.DirSource); ok && (from.IsZero() || to.IsZero()) {
+		hours, err := dir.Hours()
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if len(hours) == 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("no hour files in %s", dir.Name())
+		}
+		if from.IsZero() {
+			from = hours[0]
+		}
+		if to.IsZero() {
+			to = hours[len(hours)-1].Add(time.Hour)
+		}
+	}
+
+	if from.IsZero() || to.IsZero() {
+		return time.Time{}, time.Time{}, errors.New("-from and -to are required")
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("-from must be before -to")
+	}
+	return from, to, nil
+}
+
+// formatHours форматирует часы в формате HourLayout.
+func formatHours(hours []time.Time) []string {
+	formatted := make([]string, len(hours))
+	for i, hour := range hours {
+		formatted[i] = hour.Format(ingestion.HourLayout)
+	}
+	return formatted
+}
@@ -0,0 +1,70 @@
+// cmd/compact/main.go
+// Команда compact сворачивает часовые агрегаты в дневные, недельные и месячные и удаляет часовые агрегаты старше срока хранения
+package main
+
+import (
+	"context"
+	"flag"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/compaction"
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/ingestion"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
+	gormrepo "github.com/kun1ts4/stars-analytics/internal/storage/gorm"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	once := flag.Bool("once", false, "run a single compaction pass and exit")
+	fromFlag := flag.String("from", "", "recompact days starting at this hour in "+ingestion.HourLayout+
+		" format (UTC); refused if hourly aggregates of that day are already pruned; implies -once")
+	flag.Parse()
+
+	var from time.Time
+	if *fromFlag != "" {
+		var err error
+		if from, err = ingestion.ParseHour(*fromFlag); err != nil {
+			logger.WithError(err).Fatal("invalid -from")
+		}
+		*once = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load config")
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect database")
+	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		logger.WithError(err).Fatal("database schema check failed")
+	}
+
+	compactor := compaction.NewCompactor(gormrepo.NewCompactionRepo(db), cfg.Compaction)
+	if *once {
+		if _, err := compactor.RunOnce(ctx, from); err != nil {
+			logger.WithError(err).Fatal("compaction failed")
+		}
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"interval_minutes":      cfg.Compaction.IntervalMinutes,
+		"settle_hours":          cfg.Compaction.SettleHours,
+		"lookback_days":         cfg.Compaction.LookbackDays,
+		"hourly_retention_days": cfg.Compaction.HourlyRetentionDays,
+	}).Info("starting compaction")
+	compactor.Run(ctx)
+	logger.Info("compaction stopped")
+}
@@ -4,19 +4,34 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/kun1ts4/stars-analytics/internal/config"
 	"github.com/kun1ts4/stars-analytics/internal/ingestion"
-	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/kun1ts4/stars-analytics/internal/prometheus"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
+	gormrepo "github.com/kun1ts4/stars-analytics/internal/storage/gorm"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
+// checkpointSource является ключом checkpoint архива GH Archive.
+const checkpointSource = "gharchive"
+
 func main() {
+	startHour := flag.String("start-hour", "",
+		"first hour to fetch in "+ingestion.HourLayout+" format (UTC), overrides the saved checkpoint; "+
+			"must not be older than processor.dedup_retention_hours")
+	flag.Parse()
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
@@ -25,19 +40,160 @@ func main() {
 		logger.WithError(err).Fatal("failed to load config")
 	}
 
+	checkpoints, hours, err := newStores(ctx, cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create checkpoint store")
+	}
+
+	dedupWindow := time.Duration(cfg.Processor.DedupRetentionHours) * time.Hour
+	lastProceed, err := resolveLastProcessed(ctx, *startHour, checkpoints, cfg.Ingestion.LookbackHours, dedupWindow)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to resolve start hour")
+	}
+
 	httpClient := &http.Client{}
-	lastProceed := time.Now().UTC().Add(-time.Duration(cfg.Ingestion.LookbackHours) * time.Hour)
 
-	producer := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.Producer)
+	producer := ingestion.NewKafkaProducer(cfg.Kafka)
+
+	source, err := ingestion.NewEventSource(httpClient, cfg.Ingestion)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create event source")
+	}
+
+	filter, err := ingestion.NewEventFilter(cfg.Ingestion.Filter)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid filter config")
+	}
+
+	fetcher := ingestion.NewGHArchiveFetcher(source, lastProceed, producer, filter, checkpoints, hours, cfg.Ingestion)
 
-	fetcher := ingestion.NewGHArchiveFetcher(httpClient, lastProceed, producer, cfg.Ingestion)
+	var wg sync.WaitGroup
+	if cfg.Ingestion.MetricsPort > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveMetrics(ctx, cfg.Ingestion.MetricsPort)
+		}()
+	}
+	if cfg.Ingestion.EventsAPI.Enabled {
+		poller := ingestion.NewEventsAPIPoller(httpClient, producer, filter, cfg.Ingestion.EventsAPI, cfg.Ingestion.Workers)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			poller.Run(ctx)
+		}()
+	}
 
 	logger.WithFields(logrus.Fields{
-		"gharchive_url":  cfg.Ingestion.GHArchiveURL,
-		"lookback_hours": cfg.Ingestion.LookbackHours,
+		"source":             source.Name(),
+		"checkpoint_backend": cfg.Ingestion.Checkpoint.Backend,
+		"events_api":         cfg.Ingestion.EventsAPI.Enabled,
+		"next_hour":          lastProceed.Add(time.Hour).Format(ingestion.HourLayout),
 	}).Info("starting ingestion service")
 
-	if err := fetcher.Run(ctx); err != nil {
+	err = fetcher.Run(ctx)
+	// Producer закрывается только после остановки poller, который также в него пишет
+	wg.Wait()
+	closeProducer(producer)
+	if err != nil {
 		logger.WithError(err).Fatal("failed to run fetcher")
 	}
 }
+
+// closeProducer закрывает producer, ожидая отправки буферизованных сообщений
+// не дольше 5 секунд.
+func closeProducer(producer ingestion.KafkaProducer) {
+	done := make(chan struct{})
+	go func() {
+		if err := producer.Close(); err != nil {
+			logger.WithError(err).Error("failed to close producer")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("finished closing producer")
+	case <-time.After(5 * time.Second):
+		logger.Warn("timed out closing producer")
+	}
+}
+
+// serveMetrics отдает метрики Prometheus на порту port до отмены ctx.
+func serveMetrics(ctx context.Context, port int) {
+	prometheus.InitIngestion()
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           prometheus.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.WithError(err).Warn("error shutting down metrics server")
+		}
+	}()
+
+	logger.WithField("address", server.Addr).Info("starting metrics server")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.WithError(err).Error("failed to start metrics server")
+	}
+}
+
+// newStores создает хранилища checkpoint и статусов часов согласно конфигурации.
+// С backend "file" база данных не используется: статусы часов не записываются,
+// а прерванный час после перезапуска загружается заново с начала.
+func newStores(ctx context.Context, cfg *config.Config) (ingestion.CheckpointStore, ingestion.HourStore, error) {
+	switch cfg.Ingestion.Checkpoint.Backend {
+	case "file":
+		return ingestion.NewFileCheckpointStore(cfg.Ingestion.Checkpoint.Path), nil, nil
+	case "postgres", "":
+		db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("connecting database: %w", err)
+		}
+		if err := storage.CheckSchema(ctx, db); err != nil {
+			return nil, nil, err
+		}
+		return gormrepo.NewCheckpointRepo(db, checkpointSource), gormrepo.NewHourRepo(db), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown checkpoint backend: %s", cfg.Ingestion.Checkpoint.Backend)
+	}
+}
+
+// resolveLastProcessed определяет последний обработанный час: флаг -start-hour
+// имеет приоритет над сохраненным checkpoint, а при их отсутствии используется lookback.
+// Часы раньше окна дедупликации dedupWindow не принимаются: записи дедупликации их
+// событий могли быть удалены, и processor учел бы события повторно.
+func resolveLastProcessed(
+	ctx context.Context,
+	startHour string,
+	checkpoints ingestion.CheckpointStore,
+	lookbackHours int,
+	dedupWindow time.Duration,
+) (time.Time, error) {
+	if startHour != "" {
+		start, err := ingestion.ParseHour(startHour)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if cutoff := time.Now().UTC().Add(-dedupWindow); dedupWindow > 0 && start.Before(cutoff) {
+			return time.Time{}, fmt.Errorf("-start-hour %s is older than the dedup window (%s), "+
+				"reloading it would double count events", startHour, dedupWindow)
+		}
+		return start.Add(-time.Hour), nil
+	}
+
+	hour, ok, err := checkpoints.Load(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ok {
+		return hour, nil
+	}
+
+	return time.Now().UTC().Add(-time.Duration(lookbackHours) * time.Hour).Truncate(time.Hour), nil
+}
@@ -1,7 +1,26 @@
 // Package main предоставляет команду миграции базы данных для приложения stars-analytics.
+//
+// Использование:
+//
+//	migrate [up]           применяет все непримененные миграции
+//	migrate down           откатывает последнюю примененную миграцию
+//	migrate status         печатает состояние миграций
+//	migrate to <version>   применяет или откатывает миграции до версии
+//
+// Исходная миграция 1 перенимает таблицы существующих установок и не откатывается.
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	"github.com/kun1ts4/stars-analytics/internal/config"
 	"github.com/kun1ts4/stars-analytics/internal/storage"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
@@ -10,6 +29,19 @@ import (
 )
 
 func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [up | down | status | to <version>]\n", os.Args[0])
+	}
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		logger.WithError(err).Fatal("failed to load config")
@@ -20,9 +52,56 @@ func main() {
 		logger.WithError(err).Fatal("failed to connect to database")
 	}
 
-	if err := storage.Migrate(db); err != nil {
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create migrator")
+	}
+
+	switch command {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		version, parseErr := strconv.ParseInt(flag.Arg(1), 10, 64)
+		if parseErr != nil {
+			logger.WithError(parseErr).Fatal("to requires a numeric version")
+		}
+		err = migrator.To(ctx, version)
+	case "status":
+		if err := printStatus(ctx, migrator); err != nil {
+			logger.WithError(err).Fatal("failed to get migration status")
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
 		logger.WithError(err).Fatal("migration failed")
 	}
 
 	logger.Info("migration completed successfully")
 }
+
+// printStatus печатает состояние миграций в виде таблицы.
+func printStatus(ctx context.Context, migrator *storage.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		applied := "pending"
+		if !status.AppliedAt.IsZero() {
+			applied = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if status.Unknown {
+			applied += " (not in this build)"
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	return w.Flush()
+}
@@ -6,10 +6,14 @@ import (
 	"context"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/kun1ts4/stars-analytics/internal/antispam"
 	"github.com/kun1ts4/stars-analytics/internal/config"
 	processor "github.com/kun1ts4/stars-analytics/internal/processor"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
 	gormrepo "github.com/kun1ts4/stars-analytics/internal/storage/gorm"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
 	"github.com/kun1ts4/stars-analytics/pkg/kafka"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 	"github.com/sirupsen/logrus"
@@ -33,17 +37,48 @@ func main() {
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect database")
 	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		logger.WithError(err).Fatal("database schema check failed")
+	}
 
 	repo := gormrepo.NewStatsRepo(db)
-	consumer := kafka.NewConsumer(cfg.Kafka.Brokers, cfg.Kafka.Topic)
+	consumer := kafka.NewConsumer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.GroupID)
+
+	var deadLetters processor.KafkaProducer
+	if cfg.Kafka.DLQ.Topic != "" {
+		dlqProducer := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.DLQ.Topic, cfg.Kafka.Producer)
+		defer func() {
+			if err := dlqProducer.Close(); err != nil {
+				logger.WithError(err).Error("failed to close dead-letter producer")
+			}
+		}()
+		deadLetters = dlqProducer
+	}
+
+	var detector *antispam.Detector
+	if cfg.Processor.Antispam.Enabled {
+		detector = antispam.NewDetector(cfg.Processor.Antispam)
+	}
 
 	proc := processor.Processor{
-		Consumer:  consumer,
-		StatsRepo: repo,
+		Consumer:           consumer,
+		StatsRepo:          repo,
+		DedupRetention:     time.Duration(cfg.Processor.DedupRetentionHours) * time.Hour,
+		StarEventRetention: time.Duration(cfg.Processor.StarEventsRetentionDays) * 24 * time.Hour,
+		BatchSize:          cfg.Processor.BatchSize,
+		FlushInterval:      time.Duration(cfg.Processor.FlushIntervalMs) * time.Millisecond,
+		DeadLetters:        deadLetters,
+		MaxAttempts:        cfg.Kafka.DLQ.MaxAttempts,
+		Backoff:            backoff.New(cfg.Kafka.DLQ.InitialBackoffMs, cfg.Kafka.DLQ.MaxBackoffMs),
+		Detector:           detector,
 	}
 
 	logger.WithFields(logrus.Fields{
-		"topic": cfg.Kafka.Topic,
+		"topic":      cfg.Kafka.Topic,
+		"group_id":   cfg.Kafka.GroupID,
+		"batch_size": cfg.Processor.BatchSize,
+		"dlq_topic":  cfg.Kafka.DLQ.Topic,
+		"antispam":   cfg.Processor.Antispam.Enabled,
 	}).Info("starting processor")
 	err = proc.Run(ctx)
 	if err != nil {
@@ -0,0 +1,152 @@
+// cmd/rebuild/main.go
+// Команда rebuild пересчитывает агрегаты диапазона часов из star_events или архива и сравнивает или заменяет ими текущие
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/antispam"
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/ingestion"
+	"github.com/kun1ts4/stars-analytics/internal/rebuild"
+	"github.com/kun1ts4/stars-analytics/internal/storage"
+	gormrepo "github.com/kun1ts4/stars-analytics/internal/storage/gorm"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	fromFlag := flag.String("from", "", "first hour to rebuild in "+ingestion.HourLayout+" format (UTC), inclusive")
+	toFlag := flag.String("to", "", "last hour to rebuild in "+ingestion.HourLayout+" format (UTC), exclusive")
+	sourceFlag := flag.String("source", "store", "where to read events from: store (stars saved in star_events) "+
+		"or archive (all metrics, re-read from the configured ingestion source)")
+	apply := flag.Bool("apply", false, "swap the rebuilt aggregates in; by default only the diff is printed")
+	pageSize := flag.Int("page-size", rebuild.DefaultPageSize, "star events read per query for the store source")
+	flag.Parse()
+
+	window, err := parseWindow(*fromFlag, *toFlag)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid range")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load config")
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect database")
+	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		logger.WithError(err).Fatal("database schema check failed")
+	}
+
+	var source rebuild.Source
+	var detector *antispam.Detector
+	switch *sourceFlag {
+	case "store":
+		source = rebuild.NewStoreSource(gormrepo.NewStatsRepo(db), *pageSize)
+	case "archive":
+		events, err := ingestion.NewEventSource(&http.Client{}, cfg.Ingestion)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create event source")
+		}
+		filter, err := ingestion.NewEventFilter(cfg.Ingestion.Filter)
+		if err != nil {
+			logger.WithError(err).Fatal("invalid filter config")
+		}
+		source = rebuild.NewArchiveSource(events, filter)
+		if cfg.Processor.Antispam.Enabled {
+			detector = antispam.NewDetector(cfg.Processor.Antispam)
+		}
+	default:
+		logger.Fatalf("unknown -source %q, expected store or archive", *sourceFlag)
+	}
+
+	entry := logger.WithFields(logrus.Fields{
+		"from":   window.From.Format(ingestion.HourLayout),
+		"to":     window.To.Format(ingestion.HourLayout),
+		"source": *sourceFlag,
+		"apply":  *apply,
+	})
+	if *apply {
+		entry.Warn("events backfilled into this range until the swap will be lost")
+	}
+	entry.Info("starting rebuild")
+
+	lag := time.Duration(cfg.Processor.WriteLagHours) * time.Hour
+	rebuilder := rebuild.NewRebuilder(source, gormrepo.NewRebuildRepo(db), detector, lag)
+	report, err := rebuilder.Run(ctx, window, *apply)
+	if err != nil {
+		logger.WithError(err).Fatal("rebuild failed, current aggregates are unchanged")
+	}
+
+	if err := printDiff(report.Diffs); err != nil {
+		logger.WithError(err).Fatal("failed to print diff")
+	}
+
+	entry = logger.WithFields(logrus.Fields{
+		"events":     report.Events,
+		"duplicates": report.Duplicates,
+		"outside":    report.Outside,
+		"repos":      len(report.Diffs),
+	})
+	if !report.Applied {
+		entry.Info("dry run completed, rerun with -apply to swap the rebuilt aggregates in")
+		return
+	}
+	entry.Info("rebuild applied")
+}
+
+// parseWindow разбирает обязательный диапазон часов из флагов.
+func parseWindow(fromFlag, toFlag string) (domain.TimeRange, error) {
+	if fromFlag == "" || toFlag == "" {
+		return domain.TimeRange{}, errors.New("-from and -to are required")
+	}
+	from, err := ingestion.ParseHour(fromFlag)
+	if err != nil {
+		return domain.TimeRange{}, fmt.Errorf("-from: %w", err)
+	}
+	to, err := ingestion.ParseHour(toFlag)
+	if err != nil {
+		return domain.TimeRange{}, fmt.Errorf("-to: %w", err)
+	}
+	window := domain.TimeRange{From: from, To: to}
+	if err := window.Validate(); err != nil {
+		return domain.TimeRange{}, err
+	}
+	return window, nil
+}
+
+// printDiff печатает изменившиеся метрики репозиториев в виде таблицы.
+func printDiff(diffs []domain.RepoDiff) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REPO ID\tREPO\tMETRIC\tOLD\tNEW\tDELTA")
+	for _, diff := range diffs {
+		for _, metric := range domain.Metrics {
+			delta := diff.Delta(metric)
+			if delta == 0 {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%+d\n",
+				diff.RepoID, diff.RepoName, metric, diff.Old[metric], diff.New[metric], delta)
+		}
+	}
+	return w.Flush()
+}
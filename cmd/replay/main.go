@@ -0,0 +1,110 @@
+// cmd/replay/main.go
+// Команда replay повторно публикует сообщения из dead-letter (или любого другого) топика в основной топик
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/internal/replay"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	topicFlag := flag.String("topic", "", "topic to read from (defaults to the dead-letter topic)")
+	group := flag.String("group", "stars-replay",
+		"consumer group used to track replay progress; offsets advance only past replayed messages")
+	errorTypes := flag.String("error-type", "", "comma-separated error types to replay (decode, process, publish)")
+	sinceFlag := flag.String("since", "", "replay messages failed at or after this time (RFC3339)")
+	untilFlag := flag.String("until", "", "replay messages failed before this time (RFC3339)")
+	repo := flag.String("repo", "", "replay only events of this repository (owner/name)")
+	dryRun := flag.Bool("dry-run", false, "print messages that would be replayed without publishing or committing")
+	idleTimeout := flag.Duration("idle-timeout", 10*time.Second, "stop after no messages arrive for this long")
+	flag.Parse()
+
+	filter := replay.Filter{Repo: *repo}
+	for _, errorType := range strings.Split(*errorTypes, ",") {
+		if errorType = strings.TrimSpace(errorType); errorType != "" {
+			filter.ErrorTypes = append(filter.ErrorTypes, dto.DeadLetterErrorType(errorType))
+		}
+	}
+	var err error
+	if filter.Since, err = parseTime(*sinceFlag); err != nil {
+		logger.WithError(err).Fatal("invalid -since")
+	}
+	if filter.Until, err = parseTime(*untilFlag); err != nil {
+		logger.WithError(err).Fatal("invalid -until")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load config")
+	}
+
+	topic := *topicFlag
+	if topic == "" {
+		topic = cfg.Kafka.DLQ.Topic
+	}
+	if topic == "" {
+		logger.Fatal("-topic is required when no dead-letter topic is configured")
+	}
+	if topic == cfg.Kafka.Topic {
+		logger.Fatal("-topic must differ from the main topic")
+	}
+
+	consumer := kafka.NewConsumer(cfg.Kafka.Brokers, topic, *group)
+	defer func() {
+		if err := consumer.Close(); err != nil {
+			logger.WithError(err).Error("failed to close consumer")
+		}
+	}()
+
+	producer := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.Producer)
+	defer func() {
+		if err := producer.Close(); err != nil {
+			logger.WithError(err).Error("failed to close producer")
+		}
+	}()
+
+	replayer := replay.NewReplayer(consumer, producer, filter, *dryRun, *idleTimeout, os.Stdout)
+
+	logger.WithFields(logrus.Fields{
+		"topic":   topic,
+		"target":  cfg.Kafka.Topic,
+		"group":   *group,
+		"dry_run": *dryRun,
+	}).Info("starting replay")
+	report, err := replayer.Run(ctx)
+
+	entry := logger.WithFields(logrus.Fields{
+		"read":        report.Read,
+		"replayed":    report.Replayed,
+		"filtered":    report.Filtered,
+		"invalid":     report.Invalid,
+		"uncommitted": report.Uncommitted,
+	})
+	if err != nil {
+		entry.WithError(err).Fatal("replay interrupted")
+	}
+	entry.Info("replay completed")
+}
+
+// parseTime разбирает время в формате RFC3339; пустая строка дает нулевое время.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,325 @@
+// Package antispam ищет накрученные звезды: всплески звезд от одного аккаунта
+// и всплески звезд репозиторию от аккаунтов без другой активности.
+package antispam
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+)
+
+// defaultKnownActors ограничивает число аккаунтов с другой активностью, если лимит не задан.
+const defaultKnownActors = 100000
+
+// star описывает звезду, попавшую в окно аккаунта и репозитория.
+type star struct {
+	id       string
+	actor    string
+	repoID   int64
+	repoName string
+	at       time.Time
+	flagged  bool
+	// batch и index указывают на событие в пачке, которая анализировалась,
+	// когда звезда была получена.
+	batch uint64
+	index int
+}
+
+// window хранит звезды за последние size времени.
+type window struct {
+	stars []*star
+}
+
+// prune удаляет звезды, полученные раньше since.
+func (w *window) prune(since time.Time) {
+	n := 0
+	for _, s := range w.stars {
+		if !s.at.Before(since) {
+			w.stars[n] = s
+			n++
+		}
+	}
+	clear(w.stars[n:])
+	w.stars = w.stars[:n]
+}
+
+// latest возвращает время самой поздней звезды окна.
+func (w *window) latest() time.Time {
+	var latest time.Time
+	for _, s := range w.stars {
+		if s.at.After(latest) {
+			latest = s.at
+		}
+	}
+	return latest
+}
+
+// knownSet запоминает ограниченное число аккаунтов, вытесняя самые старые.
+type knownSet struct {
+	logins map[string]struct{}
+	ring   []string
+	next   int
+}
+
+func newKnownSet(size int) *knownSet {
+	return &knownSet{
+		logins: make(map[string]struct{}, size),
+		ring:   make([]string, size),
+	}
+}
+
+func (k *knownSet) add(login string) {
+	if _, ok := k.logins[login]; ok {
+		return
+	}
+	if evicted := k.ring[k.next]; evicted != "" {
+		delete(k.logins, evicted)
+	}
+	k.ring[k.next] = login
+	k.next = (k.next + 1) % len(k.ring)
+	k.logins[login] = struct{}{}
+}
+
+func (k *knownSet) contains(login string) bool {
+	_, ok := k.logins[login]
+	return ok
+}
+
+// Verdict содержит результат анализа пачки сверх флагов Flagged ее событий.
+type Verdict struct {
+	// Stars содержит звезды прошлых пачек, признанные подозрительными задним числом.
+	Stars []domain.StarFlag
+	// Actors содержит аккаунты, чьи звезды признаны подозрительными.
+	Actors []domain.ActorFlag
+}
+
+// Empty сообщает, что сохранять нечего.
+func (v Verdict) Empty() bool {
+	return len(v.Stars) == 0 && len(v.Actors) == 0
+}
+
+// Detector хранит скользящие окна звезд по аккаунтам и репозиториям.
+// Окна отсчитываются по времени событий, а не по времени обработки.
+type Detector struct {
+	cfg         config.AntispamConfig
+	actorWindow time.Duration
+	repoWindow  time.Duration
+
+	mu        sync.Mutex
+	actors    map[string]*window
+	repos     map[int64]*window
+	known     *knownSet
+	batch     uint64
+	lastSweep time.Time
+}
+
+// NewDetector создает детектор. Правило с нулевым окном или порогом отключено.
+func NewDetector(cfg config.AntispamConfig) *Detector {
+	knownActors := cfg.KnownActors
+	if knownActors <= 0 {
+		knownActors = defaultKnownActors
+	}
+	return &Detector{
+		cfg:         cfg,
+		actorWindow: time.Duration(cfg.ActorWindowMinutes) * time.Minute,
+		repoWindow:  time.Duration(cfg.RepoWindowMinutes) * time.Minute,
+		actors:      make(map[string]*window),
+		repos:       make(map[int64]*window),
+		known:       newKnownSet(knownActors),
+	}
+}
+
+// analysis накапливает флаги одного вызова Analyze.
+type analysis struct {
+	events []domain.Event
+	batch  uint64
+	stars  map[starKey]*domain.StarFlag
+	actors map[string]*domain.ActorFlag
+}
+
+type starKey struct {
+	repoID int64
+	hour   time.Time
+}
+
+// Analyze проверяет пачку событий. Подозрительные звезды пачки помечаются
+// через Event.Flagged, а звезды прошлых пачек и аккаунты возвращаются в Verdict.
+// Nil-детектор ничего не помечает.
+func (d *Detector) Analyze(events []domain.Event) Verdict {
+	if d == nil || len(events) == 0 {
+		return Verdict{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.batch++
+	a := &analysis{
+		events: events,
+		batch:  d.batch,
+		stars:  make(map[starKey]*domain.StarFlag),
+		actors: make(map[string]*domain.ActorFlag),
+	}
+
+	var latest time.Time
+	for i, event := range events {
+		if event.CreatedAt.After(latest) {
+			latest = event.CreatedAt
+		}
+		if event.ActorLogin == "" {
+			continue
+		}
+		if event.Action != domain.ActionStarred {
+			d.known.add(event.ActorLogin)
+			continue
+		}
+		d.observe(a, &star{
+			id:       event.ID,
+			actor:    event.ActorLogin,
+			repoID:   event.RepoID,
+			repoName: event.RepoName,
+			at:       event.CreatedAt,
+			batch:    d.batch,
+			index:    i,
+		})
+	}
+	d.sweep(latest)
+
+	return a.verdict()
+}
+
+// observe добавляет звезду в окна и применяет правила.
+func (d *Detector) observe(a *analysis, s *star) {
+	actor := d.actors[s.actor]
+	if actor == nil {
+		actor = &window{}
+		d.actors[s.actor] = actor
+	}
+	actor.prune(s.at.Add(-max(d.actorWindow, d.repoWindow)))
+	for _, seen := range actor.stars {
+		// Повторная звезда тому же репозиторию, например после снятия.
+		if seen.repoID == s.repoID {
+			return
+		}
+	}
+	actor.stars = append(actor.stars, s)
+
+	repo := d.repos[s.repoID]
+	if repo == nil {
+		repo = &window{}
+		d.repos[s.repoID] = repo
+	}
+	repo.prune(s.at.Add(-d.repoWindow))
+	repo.stars = append(repo.stars, s)
+
+	d.checkActor(a, actor, s.at)
+	d.checkRepo(a, repo)
+}
+
+// checkActor помечает звезды аккаунта, поставившего звезды ActorBurstStars
+// разным репозиториям за окно.
+func (d *Detector) checkActor(a *analysis, actor *window, now time.Time) {
+	if d.actorWindow <= 0 || d.cfg.ActorBurstStars <= 0 {
+		return
+	}
+	since := now.Add(-d.actorWindow)
+	var recent []*star
+	for _, s := range actor.stars {
+		if !s.at.Before(since) {
+			recent = append(recent, s)
+		}
+	}
+	if len(recent) < d.cfg.ActorBurstStars {
+		return
+	}
+	for _, s := range recent {
+		a.flag(s, domain.SpamReasonActorBurst)
+	}
+}
+
+// checkRepo помечает звезды аккаунтов без другой активности, если репозиторий
+// получил RepoBurstStars звезд за окно и доля таких звезд не меньше RepoUnknownShare.
+func (d *Detector) checkRepo(a *analysis, repo *window) {
+	if d.repoWindow <= 0 || d.cfg.RepoBurstStars <= 0 || len(repo.stars) < d.cfg.RepoBurstStars {
+		return
+	}
+	var unknown []*star
+	for _, s := range repo.stars {
+		if !d.known.contains(s.actor) {
+			unknown = append(unknown, s)
+		}
+	}
+	if float64(len(unknown)) < d.cfg.RepoUnknownShare*float64(len(repo.stars)) {
+		return
+	}
+	for _, s := range unknown {
+		a.flag(s, domain.SpamReasonRepoBurst)
+	}
+}
+
+// sweep удаляет окна без звезд за последние окна времени. Выполняется
+// не чаще раза за окно времени событий.
+func (d *Detector) sweep(now time.Time) {
+	retention := max(d.actorWindow, d.repoWindow)
+	if now.Sub(d.lastSweep) < retention {
+		return
+	}
+	d.lastSweep = now
+
+	since := now.Add(-retention)
+	for login, actor := range d.actors {
+		if actor.latest().Before(since) {
+			delete(d.actors, login)
+		}
+	}
+	for repoID, repo := range d.repos {
+		if repo.latest().Before(since) {
+			delete(d.repos, repoID)
+		}
+	}
+}
+
+// flag помечает звезду подозрительной, если она еще не помечена.
+func (a *analysis) flag(s *star, reason domain.SpamReason) {
+	if s.flagged {
+		return
+	}
+	s.flagged = true
+
+	if s.batch == a.batch {
+		a.events[s.index].Flagged = true
+	} else {
+		key := starKey{repoID: s.repoID, hour: s.at.UTC().Truncate(time.Hour)}
+		flag := a.stars[key]
+		if flag == nil {
+			flag = &domain.StarFlag{RepoID: s.repoID, RepoName: s.repoName, Hour: key.hour}
+			a.stars[key] = flag
+		}
+		flag.Stars++
+		flag.EventIDs = append(flag.EventIDs, s.id)
+	}
+
+	actor := a.actors[s.actor]
+	if actor == nil {
+		actor = &domain.ActorFlag{Login: s.actor}
+		a.actors[s.actor] = actor
+	}
+	actor.Reason = reason
+	actor.Stars++
+	if s.at.After(actor.FlaggedAt) {
+		actor.FlaggedAt = s.at
+	}
+}
+
+func (a *analysis) verdict() Verdict {
+	var v Verdict
+	for _, flag := range a.stars {
+		v.Stars = append(v.Stars, *flag)
+	}
+	for _, actor := range a.actors {
+		v.Actors = append(v.Actors, *actor)
+	}
+	return v
+}
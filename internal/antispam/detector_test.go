@@ -0,0 +1,160 @@
+package antispam
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var base = time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+
+func starEvent(actor string, repoID int64, at time.Duration) domain.Event {
+	return domain.Event{
+		ID:         fmt.Sprintf("%s-%d-%s", actor, repoID, at),
+		Action:     domain.ActionStarred,
+		RepoID:     repoID,
+		RepoName:   fmt.Sprintf("org/repo%d", repoID),
+		ActorLogin: actor,
+		CreatedAt:  base.Add(at),
+	}
+}
+
+func flagged(events []domain.Event) []bool {
+	flags := make([]bool, len(events))
+	for i, event := range events {
+		flags[i] = event.Flagged
+	}
+	return flags
+}
+
+func TestDetector_ActorBurst(t *testing.T) {
+	detector := NewDetector(config.AntispamConfig{ActorWindowMinutes: 10, ActorBurstStars: 3})
+
+	events := []domain.Event{
+		starEvent("farmer", 1, time.Minute),
+		starEvent("farmer", 2, 2*time.Minute),
+		starEvent("user", 1, 2*time.Minute),
+		starEvent("farmer", 3, 3*time.Minute),
+	}
+	verdict := detector.Analyze(events)
+
+	assert.Equal(t, []bool{true, true, false, true}, flagged(events))
+	assert.Empty(t, verdict.Stars)
+	assert.Equal(t, []domain.ActorFlag{{
+		Login:     "farmer",
+		Reason:    domain.SpamReasonActorBurst,
+		Stars:     3,
+		FlaggedAt: base.Add(3 * time.Minute),
+	}}, verdict.Actors)
+}
+
+func TestDetector_FlagsEarlierBatches(t *testing.T) {
+	detector := NewDetector(config.AntispamConfig{ActorWindowMinutes: 10, ActorBurstStars: 3})
+
+	first := []domain.Event{
+		starEvent("farmer", 1, 55*time.Minute),
+		starEvent("farmer", 2, 58*time.Minute),
+	}
+	verdict := detector.Analyze(first)
+	assert.Equal(t, []bool{false, false}, flagged(first))
+	assert.True(t, verdict.Empty())
+
+	second := []domain.Event{starEvent("farmer", 3, 62*time.Minute)}
+	verdict = detector.Analyze(second)
+
+	assert.Equal(t, []bool{true}, flagged(second))
+	assert.ElementsMatch(t, []domain.StarFlag{
+		{RepoID: 1, RepoName: "org/repo1", Hour: base, Stars: 1, EventIDs: []string{first[0].ID}},
+		{RepoID: 2, RepoName: "org/repo2", Hour: base, Stars: 1, EventIDs: []string{first[1].ID}},
+	}, verdict.Stars)
+	require.Len(t, verdict.Actors, 1)
+	assert.Equal(t, 3, verdict.Actors[0].Stars)
+
+	// Уже помеченные звезды не учитываются повторно.
+	third := []domain.Event{starEvent("farmer", 4, 63*time.Minute)}
+	verdict = detector.Analyze(third)
+	assert.Equal(t, []bool{true}, flagged(third))
+	assert.Empty(t, verdict.Stars)
+	require.Len(t, verdict.Actors, 1)
+	assert.Equal(t, 1, verdict.Actors[0].Stars)
+}
+
+func TestDetector_IgnoresSlowAndRepeatedStars(t *testing.T) {
+	detector := NewDetector(config.AntispamConfig{ActorWindowMinutes: 10, ActorBurstStars: 3})
+
+	events := []domain.Event{
+		starEvent("user", 1, 0),
+		starEvent("user", 1, time.Minute),
+		starEvent("user", 2, 8*time.Minute),
+		starEvent("user", 1, 9*time.Minute),
+		starEvent("user", 3, 15*time.Minute),
+	}
+	verdict := detector.Analyze(events)
+
+	assert.Equal(t, []bool{false, false, false, false, false}, flagged(events))
+	assert.True(t, verdict.Empty())
+}
+
+func TestDetector_RepoBurst(t *testing.T) {
+	detector := NewDetector(config.AntispamConfig{
+		RepoWindowMinutes: 10,
+		RepoBurstStars:    4,
+		RepoUnknownShare:  0.8,
+	})
+
+	events := []domain.Event{
+		{Action: domain.ActionForked, RepoID: 9, ActorLogin: "dev", CreatedAt: base},
+		starEvent("bot1", 1, time.Minute),
+		starEvent("dev", 1, 2*time.Minute),
+		starEvent("bot2", 1, 3*time.Minute),
+		starEvent("bot3", 1, 4*time.Minute),
+		starEvent("bot4", 2, 4*time.Minute),
+	}
+	verdict := detector.Analyze(events)
+
+	assert.Equal(t, []bool{false, false, false, false, false, false}, flagged(events),
+		"доля неизвестных аккаунтов 3/4 ниже порога")
+	assert.True(t, verdict.Empty())
+
+	more := []domain.Event{starEvent("bot5", 1, 5*time.Minute)}
+	verdict = detector.Analyze(more)
+
+	assert.Equal(t, []bool{true}, flagged(more))
+	assert.Equal(t, []domain.StarFlag{{
+		RepoID:   1,
+		RepoName: "org/repo1",
+		Hour:     base,
+		Stars:    3,
+		EventIDs: []string{events[1].ID, events[3].ID, events[4].ID},
+	}}, verdict.Stars)
+	assert.Len(t, verdict.Actors, 4)
+	for _, actor := range verdict.Actors {
+		assert.Equal(t, domain.SpamReasonRepoBurst, actor.Reason)
+		assert.NotEqual(t, "dev", actor.Login)
+	}
+}
+
+func TestKnownSet_EvictsOldest(t *testing.T) {
+	known := newKnownSet(2)
+	known.add("a")
+	known.add("b")
+	known.add("a")
+	known.add("c")
+
+	assert.False(t, known.contains("a"))
+	assert.True(t, known.contains("b"))
+	assert.True(t, known.contains("c"))
+}
+
+func TestDetector_Nil(t *testing.T) {
+	var detector *Detector
+	events := []domain.Event{starEvent("farmer", 1, 0)}
+
+	assert.True(t, detector.Analyze(events).Empty())
+	assert.False(t, events[0].Flagged)
+}
@@ -3,29 +3,302 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kun1ts4/stars-analytics/internal/domain"
 	"github.com/kun1ts4/stars-analytics/pkg/pb/github.com/kun1ts4/stars-analytics/proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Server реализует интерфейс StatsServer.
 type Server struct {
 	*proto.UnimplementedStatsServer
-	Repo domain.StatsRepo
+	Repo   domain.StatsRepo
+	Ledger domain.IngestionLedger
 }
 
-// TopN возвращает топ N репозиториев по звездам.
+// TopN возвращает топ N репозиториев по запрошенной метрике за запрошенное окно.
 func (s *Server) TopN(_ context.Context, req *proto.NRequest) (*proto.TopResponse, error) {
-	repos, err := s.Repo.GetTopN(int(req.N))
+	window, err := resolveWindow(req, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	metric, err := toMetric(req.Metric)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	spam, err := toSpamPolicy(req.SpamMode, req.FlaggedWeight)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	repos, err := s.Repo.GetTopN(int(req.N), window, metric, spam)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+
+	if req.Window == proto.Window_WINDOW_LAST_HOUR {
+		for _, repo := range repos {
+			repo.StarsLastHour = repo.WindowStars
+		}
+	}
+
 	return &proto.TopResponse{Repos: repos}, nil
 }
 
+// maxSeriesPoints ограничивает количество корзин в ответе RepoTimeSeries.
+const maxSeriesPoints = 366 * 24
+
+// RepoTimeSeries возвращает временной ряд звезд одного репозитория.
+func (s *Server) RepoTimeSeries(
+	_ context.Context,
+	req *proto.TimeSeriesRequest,
+) (*proto.TimeSeriesResponse, error) {
+	ref := domain.RepoRef{ID: req.GetId(), Name: req.GetName()}
+	if ref.ID == 0 && ref.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "repo name or id is required")
+	}
+
+	if req.Start == nil {
+		return nil, status.Error(codes.InvalidArgument, "start is required")
+	}
+	window := domain.TimeRange{From: req.Start.AsTime(), To: time.Now().UTC()}
+	if req.End != nil {
+		window.To = req.End.AsTime()
+	}
+	if err := window.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	granularity, err := toGranularity(req.Granularity)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if window.Buckets(granularity) > maxSeriesPoints {
+		return nil, status.Errorf(codes.InvalidArgument, "range exceeds %d buckets", maxSeriesPoints)
+	}
+
+	series, err := s.Repo.GetTimeSeries(ref, window, granularity)
+	if err != nil {
+		if errors.Is(err, domain.ErrRepoNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return series, nil
+}
+
+// IngestionStatus возвращает журнал загрузки часов за диапазон, по умолчанию за последние сутки.
+func (s *Server) IngestionStatus(
+	ctx context.Context,
+	req *proto.IngestionStatusRequest,
+) (*proto.IngestionStatusResponse, error) {
+	window := domain.LastHours(time.Now(), 24)
+	if req.End != nil {
+		window.To = req.End.AsTime()
+		window.From = window.To.Add(-24 * time.Hour)
+	}
+	if req.Start != nil {
+		window.From = req.Start.AsTime()
+	}
+	if err := window.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if window.Buckets(domain.GranularityHour) > maxSeriesPoints {
+		return nil, status.Errorf(codes.InvalidArgument, "range exceeds %d hours", maxSeriesPoints)
+	}
+
+	resp, err := s.Ledger.IngestionStatus(ctx, window)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+const (
+	// defaultStarEventsLimit задает размер страницы StarEvents по умолчанию.
+	defaultStarEventsLimit = 100
+	// maxStarEventsLimit ограничивает размер страницы StarEvents.
+	maxStarEventsLimit = 1000
+)
+
+// StarEvents возвращает сохраненные события звезд репозитория или аккаунта постранично.
+func (s *Server) StarEvents(
+	_ context.Context,
+	req *proto.StarEventsRequest,
+) (*proto.StarEventsResponse, error) {
+	query := domain.StarEventQuery{
+		Repo:  domain.RepoRef{ID: req.GetId(), Name: req.GetName()},
+		Actor: req.Actor,
+		Limit: defaultStarEventsLimit,
+	}
+	if query.Repo.ID == 0 && query.Repo.Name == "" && query.Actor == "" {
+		return nil, status.Error(codes.InvalidArgument, "repo or actor is required")
+	}
+
+	if req.Start == nil {
+		return nil, status.Error(codes.InvalidArgument, "start is required")
+	}
+	query.Window = domain.TimeRange{From: req.Start.AsTime(), To: time.Now().UTC()}
+	if req.End != nil {
+		query.Window.To = req.End.AsTime()
+	}
+	if err := query.Window.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.Limit > 0 {
+		query.Limit = min(int(req.Limit), maxStarEventsLimit)
+	}
+	if req.PageToken != "" {
+		cursor, err := decodePageToken(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		query.After = &cursor
+	}
+
+	events, err := s.Repo.ListStarEvents(query)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &proto.StarEventsResponse{Events: make([]*proto.StarEvent, len(events))}
+	for i, event := range events {
+		resp.Events[i] = &proto.StarEvent{
+			Id:        event.ID,
+			RepoId:    event.RepoID,
+			RepoName:  event.RepoName,
+			Actor:     event.ActorLogin,
+			CreatedAt: timestamppb.New(event.CreatedAt),
+			Flagged:   event.Flagged,
+		}
+	}
+	if len(events) == query.Limit {
+		last := events[len(events)-1]
+		resp.NextPageToken = encodePageToken(domain.StarEventCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return resp, nil
+}
+
+// encodePageToken кодирует курсор выборки в непрозрачный токен страницы.
+func encodePageToken(cursor domain.StarEventCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodePageToken восстанавливает курсор из токена encodePageToken.
+func decodePageToken(token string) (domain.StarEventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return domain.StarEventCursor{}, fmt.Errorf("invalid page token: %w", err)
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return domain.StarEventCursor{}, errors.New("invalid page token")
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return domain.StarEventCursor{}, fmt.Errorf("invalid page token: %w", err)
+	}
+	return domain.StarEventCursor{CreatedAt: time.Unix(0, unixNano).UTC(), ID: id}, nil
+}
+
 // Healthy возвращает статус здоровья сервиса.
 func (s *Server) Healthy(_ context.Context, _ *proto.Empty) (*proto.HealthyResponse, error) {
 	return &proto.HealthyResponse{Status: "ok"}, nil
 }
+
+// resolveWindow преобразует окно из запроса в диапазон времени.
+func resolveWindow(req *proto.NRequest, now time.Time) (domain.TimeRange, error) {
+	switch req.Window {
+	case proto.Window_WINDOW_LAST_HOUR:
+		return domain.LastHours(now, 1), nil
+	case proto.Window_WINDOW_LAST_DAY:
+		return domain.LastHours(now, 24), nil
+	case proto.Window_WINDOW_LAST_WEEK:
+		return domain.LastHours(now, 7*24), nil
+	case proto.Window_WINDOW_CUSTOM:
+		if req.Start == nil || req.End == nil {
+			return domain.TimeRange{}, errors.New("start and end are required for custom window")
+		}
+		window := domain.TimeRange{
+			From: req.Start.AsTime(),
+			To:   req.End.AsTime(),
+		}
+		if err := window.Validate(); err != nil {
+			return domain.TimeRange{}, err
+		}
+		return window, nil
+	default:
+		return domain.TimeRange{}, errors.New("unknown window")
+	}
+}
+
+// toGranularity преобразует гранулярность из запроса в доменную.
+func toGranularity(g proto.Granularity) (domain.Granularity, error) {
+	switch g {
+	case proto.Granularity_GRANULARITY_HOUR:
+		return domain.GranularityHour, nil
+	case proto.Granularity_GRANULARITY_DAY:
+		return domain.GranularityDay, nil
+	case proto.Granularity_GRANULARITY_WEEK:
+		return domain.GranularityWeek, nil
+	case proto.Granularity_GRANULARITY_MONTH:
+		return domain.GranularityMonth, nil
+	default:
+		return "", errors.New("unknown granularity")
+	}
+}
+
+// toMetric преобразует метрику из запроса в доменную.
+func toMetric(m proto.Metric) (domain.Metric, error) {
+	switch m {
+	case proto.Metric_METRIC_STARS:
+		return domain.MetricStars, nil
+	case proto.Metric_METRIC_FORKS:
+		return domain.MetricForks, nil
+	case proto.Metric_METRIC_PRS_OPENED:
+		return domain.MetricPRsOpened, nil
+	case proto.Metric_METRIC_PRS_MERGED:
+		return domain.MetricPRsMerged, nil
+	case proto.Metric_METRIC_ISSUES_OPENED:
+		return domain.MetricIssuesOpened, nil
+	case proto.Metric_METRIC_RELEASES:
+		return domain.MetricReleases, nil
+	default:
+		return "", errors.New("unknown metric")
+	}
+}
+
+// toSpamPolicy преобразует учет подозрительных звезд из запроса в доменный.
+func toSpamPolicy(mode proto.SpamMode, weight float64) (domain.SpamPolicy, error) {
+	switch mode {
+	case proto.SpamMode_SPAM_MODE_INCLUDE:
+		return domain.SpamPolicy{Mode: domain.SpamModeInclude}, nil
+	case proto.SpamMode_SPAM_MODE_EXCLUDE:
+		return domain.SpamPolicy{Mode: domain.SpamModeExclude}, nil
+	case proto.SpamMode_SPAM_MODE_DISCOUNT:
+		if weight < 0 || weight > 1 {
+			return domain.SpamPolicy{}, errors.New("flagged_weight must be between 0 and 1")
+		}
+		if weight == 0 {
+			weight = domain.DefaultFlaggedWeight
+		}
+		return domain.SpamPolicy{Mode: domain.SpamModeDiscount, Weight: weight}, nil
+	default:
+		return domain.SpamPolicy{}, errors.New("unknown spam mode")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/pb/github.com/kun1ts4/stars-analytics/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestResolveWindow(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 42, 0, 0, time.UTC)
+	hour := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		req     *proto.NRequest
+		want    domain.TimeRange
+		wantErr bool
+	}{
+		{
+			name: "last_hour_by_default",
+			req:  &proto.NRequest{N: 10},
+			want: domain.TimeRange{From: hour.Add(-time.Hour), To: hour},
+		},
+		{
+			name: "last_day",
+			req:  &proto.NRequest{N: 10, Window: proto.Window_WINDOW_LAST_DAY},
+			want: domain.TimeRange{From: hour.Add(-24 * time.Hour), To: hour},
+		},
+		{
+			name: "last_week",
+			req:  &proto.NRequest{N: 10, Window: proto.Window_WINDOW_LAST_WEEK},
+			want: domain.TimeRange{From: hour.Add(-7 * 24 * time.Hour), To: hour},
+		},
+		{
+			name: "custom",
+			req: &proto.NRequest{
+				N:      10,
+				Window: proto.Window_WINDOW_CUSTOM,
+				Start:  timestamppb.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+				End:    timestamppb.New(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)),
+			},
+			want: domain.TimeRange{
+				From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "custom_without_bounds",
+			req:     &proto.NRequest{N: 10, Window: proto.Window_WINDOW_CUSTOM},
+			wantErr: true,
+		},
+		{
+			name: "custom_reversed",
+			req: &proto.NRequest{
+				N:      10,
+				Window: proto.Window_WINDOW_CUSTOM,
+				Start:  timestamppb.New(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)),
+				End:    timestamppb.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := resolveWindow(c.req, now)
+			if c.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestToSpamPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		mode    proto.SpamMode
+		weight  float64
+		want    domain.SpamPolicy
+		wantErr bool
+	}{
+		{name: "include", mode: proto.SpamMode_SPAM_MODE_INCLUDE, want: domain.SpamPolicy{Mode: domain.SpamModeInclude}},
+		{name: "exclude", mode: proto.SpamMode_SPAM_MODE_EXCLUDE, want: domain.SpamPolicy{Mode: domain.SpamModeExclude}},
+		{
+			name: "discount_default_weight",
+			mode: proto.SpamMode_SPAM_MODE_DISCOUNT,
+			want: domain.SpamPolicy{Mode: domain.SpamModeDiscount, Weight: domain.DefaultFlaggedWeight},
+		},
+		{
+			name:   "discount",
+			mode:   proto.SpamMode_SPAM_MODE_DISCOUNT,
+			weight: 0.25,
+			want:   domain.SpamPolicy{Mode: domain.SpamModeDiscount, Weight: 0.25},
+		},
+		{name: "weight_out_of_range", mode: proto.SpamMode_SPAM_MODE_DISCOUNT, weight: 1.5, wantErr: true},
+		{name: "unknown_mode", mode: proto.SpamMode(42), wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := toSpamPolicy(c.mode, c.weight)
+			if c.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestPageToken_RoundTrip(t *testing.T) {
+	cursor := domain.StarEventCursor{
+		CreatedAt: time.Date(2024, 1, 1, 15, 30, 0, 123, time.UTC),
+		ID:        "35012345678",
+	}
+
+	got, err := decodePageToken(encodePageToken(cursor))
+	require.NoError(t, err)
+	require.Equal(t, cursor, got)
+
+	for _, token := range []string{"!!!", "bm9jb2xvbg", "eDox"} {
+		_, err := decodePageToken(token)
+		require.Error(t, err, token)
+	}
+}
+
+func TestRepoTimeSeries_RangeTooLong(t *testing.T) {
+	// Диапазон в тысячи лет отклоняется до обращения к хранилищу
+	srv := &Server{}
+	_, err := srv.RepoTimeSeries(context.Background(), &proto.TimeSeriesRequest{
+		Repo:        &proto.TimeSeriesRequest_Name{Name: "org/repo"},
+		Start:       timestamppb.New(time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)),
+		End:         timestamppb.New(time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Granularity: proto.Granularity_GRANULARITY_HOUR,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	month := domain.TimeRange{
+		From: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+	}
+	require.Equal(t, 3, month.Buckets(domain.GranularityMonth))
+	require.Equal(t, 47, month.Buckets(domain.GranularityDay))
+	require.Equal(t, 47*24, month.Buckets(domain.GranularityHour))
+	require.Equal(t, 7, month.Buckets(domain.GranularityWeek))
+}
@@ -42,6 +42,7 @@ func NewManager(cfg *config.Config, db *gorm.DB) (*Manager, error) {
 	srv := &Server{
 		UnimplementedStatsServer: &proto.UnimplementedStatsServer{},
 		Repo:                     repo,
+		Ledger:                   gormrepo.NewHourRepo(db),
 	}
 
 	grpcServer := grpc.NewServer(
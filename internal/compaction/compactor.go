@@ -0,0 +1,253 @@
+// Package compaction сворачивает часовые агрегаты в дневные, недельные и месячные
+// и удаляет часовые агрегаты старше срока хранения.
+package compaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultInterval задает период проходов, если он не указан в конфигурации.
+const defaultInterval = time.Hour
+
+// ErrBeforeHorizon означает, что пересчет запрошен для суток, часовые агрегаты
+// которых уже удалены: пересчет заменил бы их свертки неполными суммами.
+var ErrBeforeHorizon = errors.New("range starts before the retained hourly aggregates")
+
+// Store хранит свертки и их границы.
+type Store interface {
+	// Watermarks возвращает границы свертки: корзины раньше границы свернуты.
+	Watermarks(ctx context.Context) (map[domain.Granularity]time.Time, error)
+	// HourlyHorizon возвращает начало первых суток с полными часовыми
+	// агрегатами и false, если их нет.
+	HourlyHorizon(ctx context.Context) (time.Time, bool, error)
+	// DirtyDays возвращает свернутые сутки, в которые позже попали опоздавшие
+	// часовые агрегаты.
+	DirtyDays(ctx context.Context) ([]time.Time, error)
+	// DiscardDirtyDays удаляет отметки суток раньше before.
+	DiscardDirtyDays(ctx context.Context, before time.Time) (int64, error)
+	// Compact пересчитывает корзины g, начинающиеся в window, и сдвигает границу g.
+	// Пересчет суток снимает их отметки опоздавших агрегатов.
+	Compact(ctx context.Context, g domain.Granularity, window domain.TimeRange) error
+	// PruneHourly удаляет часовые агрегаты и счетчики уникальных аккаунтов раньше
+	// before и сдвигает на before начало полных часовых агрегатов.
+	PruneHourly(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Report содержит итоги прохода свертки.
+type Report struct {
+	// Buckets содержит число пересчитанных корзин по гранулярности.
+	Buckets map[domain.Granularity]int
+	// PrunedRows содержит число удаленных часовых агрегатов.
+	PrunedRows int64
+}
+
+// Compactor периодически сворачивает завершенные сутки, недели и месяцы.
+type Compactor struct {
+	store     Store
+	interval  time.Duration
+	settle    time.Duration
+	lookback  int
+	retention int
+}
+
+// NewCompactor создает новый Compactor.
+func NewCompactor(store Store, cfg config.CompactionConfig) *Compactor {
+	interval := time.Duration(cfg.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Compactor{
+		store:     store,
+		interval:  interval,
+		settle:    time.Duration(cfg.SettleHours) * time.Hour,
+		lookback:  cfg.LookbackDays,
+		retention: cfg.HourlyRetentionDays,
+	}
+}
+
+// Run выполняет проходы свертки сразу и затем с интервалом, пока не отменен ctx.
+// Ошибка прохода не останавливает работу: следующий проход продолжит с границ.
+func (c *Compactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.RunOnce(ctx, time.Time{}); err != nil && ctx.Err() == nil {
+			logger.WithError(err).Warn("compaction failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce выполняет один проход на текущий момент и записывает итоги в лог.
+func (c *Compactor) RunOnce(ctx context.Context, from time.Time) (Report, error) {
+	report, err := c.Compact(ctx, time.Now().UTC(), from)
+	if err != nil {
+		return report, err
+	}
+	logger.WithFields(logrus.Fields{
+		"days":        report.Buckets[domain.GranularityDay],
+		"weeks":       report.Buckets[domain.GranularityWeek],
+		"months":      report.Buckets[domain.GranularityMonth],
+		"pruned_rows": report.PrunedRows,
+	}).Info("compaction completed")
+	return report, nil
+}
+
+// Compact выполняет один проход на момент now: сворачивает сутки, закончившиеся
+// не позже чем за settle до now, затем недели и месяцы из суток, и удаляет часовые
+// агрегаты старше срока хранения. Уже свернутые последние lookback суток и
+// более ранние сутки с опоздавшими часовыми агрегатами пересчитываются вместе с
+// их неделями и месяцами. Ненулевой from пересчитывает сутки начиная с from;
+// если часовые агрегаты этих суток уже удалены, возвращается ErrBeforeHorizon.
+func (c *Compactor) Compact(ctx context.Context, now, from time.Time) (Report, error) {
+	report := Report{Buckets: make(map[domain.Granularity]int)}
+
+	watermarks, err := c.store.Watermarks(ctx)
+	if err != nil {
+		return report, err
+	}
+	horizon, hasHourly, err := c.store.HourlyHorizon(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	day := domain.GranularityDay
+	if !from.IsZero() && hasHourly && day.Truncate(from).Before(horizon) {
+		return report, fmt.Errorf("%w: from %s, hourly aggregates start at %s",
+			ErrBeforeHorizon, day.Truncate(from).Format(time.DateOnly), horizon.Format(time.DateOnly))
+	}
+	limit := day.Truncate(now.Add(-c.settle))
+	dayMark, compacted := watermarks[day]
+
+	start := limit
+	switch {
+	case !from.IsZero():
+		start = day.Truncate(from)
+	case compacted:
+		start = dayMark.AddDate(0, 0, -c.lookback)
+	case hasHourly:
+		start = horizon
+	}
+	// Сутки без часовых агрегатов пересчитывать не из чего.
+	if !hasHourly {
+		start = limit
+	} else if start.Before(horizon) {
+		start = horizon
+	}
+
+	if report.Buckets[day], err = c.compactRange(ctx, day, start, limit); err != nil {
+		return report, err
+	}
+	if start.Before(limit) && (!compacted || dayMark.Before(limit)) {
+		dayMark, compacted = limit, true
+	}
+	if !compacted {
+		return report, nil
+	}
+
+	dirty, err := c.compactDirty(ctx, horizon, dayMark)
+	if err != nil {
+		return report, err
+	}
+	report.Buckets[day] += len(dirty)
+
+	for _, g := range []domain.Granularity{domain.GranularityWeek, domain.GranularityMonth} {
+		gStart := g.Truncate(start)
+		if mark, ok := watermarks[g]; ok && mark.Before(gStart) {
+			gStart = mark
+		}
+		if report.Buckets[g], err = c.compactRange(ctx, g, gStart, g.Truncate(dayMark)); err != nil {
+			return report, err
+		}
+
+		// Корзины суток с опоздавшими агрегатами, лежащие раньше пересчитанного диапазона
+		var buckets []time.Time
+		for _, d := range dirty {
+			if bucket := g.Truncate(d); bucket.Before(gStart) && !slices.Contains(buckets, bucket) {
+				buckets = append(buckets, bucket)
+			}
+		}
+		for _, bucket := range buckets {
+			if _, err := c.compactRange(ctx, g, bucket, g.Next(bucket)); err != nil {
+				return report, err
+			}
+			report.Buckets[g]++
+		}
+	}
+
+	if c.retention > 0 {
+		// Удаляются только свернутые часы, которые больше не будут пересчитаны.
+		cutoff := day.Truncate(now).AddDate(0, 0, -c.retention)
+		if keep := dayMark.AddDate(0, 0, -c.lookback); keep.Before(cutoff) {
+			cutoff = keep
+		}
+		if hasHourly && horizon.Before(cutoff) {
+			if report.PrunedRows, err = c.store.PruneHourly(ctx, cutoff); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// compactDirty пересчитывает свернутые сутки раньше dayMark, в которые попали
+// опоздавшие часовые агрегаты, и возвращает их по возрастанию. Часовые агрегаты
+// суток раньше horizon удалены, и пересчет заменил бы их свертки неполными
+// суммами: отметки таких суток отбрасываются, а опоздавшие агрегаты в свертки
+// не попадают.
+func (c *Compactor) compactDirty(ctx context.Context, horizon, dayMark time.Time) ([]time.Time, error) {
+	discarded, err := c.store.DiscardDirtyDays(ctx, horizon)
+	if err != nil {
+		return nil, err
+	}
+	if discarded > 0 {
+		logger.WithFields(logrus.Fields{
+			"days":    discarded,
+			"horizon": horizon.Format(time.DateOnly),
+		}).Warn("late hourly aggregates of pruned days are not compacted")
+	}
+
+	days, err := c.store.DirtyDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var recompacted []time.Time
+	for _, d := range days {
+		if d.Before(horizon) || !d.Before(dayMark) {
+			continue
+		}
+		if _, err := c.compactRange(ctx, domain.GranularityDay, d, domain.GranularityDay.Next(d)); err != nil {
+			return recompacted, err
+		}
+		recompacted = append(recompacted, d)
+	}
+	return recompacted, nil
+}
+
+// compactRange пересчитывает по одной корзины g от from до to и возвращает их число.
+func (c *Compactor) compactRange(ctx context.Context, g domain.Granularity, from, to time.Time) (int, error) {
+	count := 0
+	for bucket := from; bucket.Before(to); bucket = g.Next(bucket) {
+		window := domain.TimeRange{From: bucket, To: g.Next(bucket)}
+		if err := c.store.Compact(ctx, g, window); err != nil {
+			return count, fmt.Errorf("compacting %s %s: %w", g, bucket.Format(time.DateOnly), err)
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,149 @@
+package compaction
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	watermarks map[domain.Granularity]time.Time
+	horizon    time.Time
+	compacted  map[domain.Granularity][]time.Time
+	prunedTo   time.Time
+	dirty      []time.Time
+}
+
+func newFakeStore(horizon time.Time) *fakeStore {
+	return &fakeStore{
+		watermarks: make(map[domain.Granularity]time.Time),
+		horizon:    horizon,
+		compacted:  make(map[domain.Granularity][]time.Time),
+	}
+}
+
+func (s *fakeStore) Watermarks(context.Context) (map[domain.Granularity]time.Time, error) {
+	watermarks := make(map[domain.Granularity]time.Time, len(s.watermarks))
+	for g, mark := range s.watermarks {
+		watermarks[g] = mark
+	}
+	return watermarks, nil
+}
+
+func (s *fakeStore) HourlyHorizon(context.Context) (time.Time, bool, error) {
+	return s.horizon, !s.horizon.IsZero(), nil
+}
+
+func (s *fakeStore) DirtyDays(context.Context) ([]time.Time, error) {
+	return slices.Clone(s.dirty), nil
+}
+
+func (s *fakeStore) DiscardDirtyDays(_ context.Context, before time.Time) (int64, error) {
+	count := len(s.dirty)
+	s.dirty = slices.DeleteFunc(s.dirty, func(day time.Time) bool { return day.Before(before) })
+	return int64(count - len(s.dirty)), nil
+}
+
+func (s *fakeStore) Compact(_ context.Context, g domain.Granularity, window domain.TimeRange) error {
+	s.compacted[g] = append(s.compacted[g], window.From)
+	if g == domain.GranularityDay {
+		s.dirty = slices.DeleteFunc(s.dirty, func(day time.Time) bool {
+			return !day.Before(window.From) && day.Before(window.To)
+		})
+	}
+	if window.To.After(s.watermarks[g]) {
+		s.watermarks[g] = window.To
+	}
+	return nil
+}
+
+func (s *fakeStore) PruneHourly(_ context.Context, before time.Time) (int64, error) {
+	s.prunedTo = before
+	s.horizon = before
+	return 10, nil
+}
+
+func days(from time.Time, n int) []time.Time {
+	result := make([]time.Time, n)
+	for i := range result {
+		result[i] = from.AddDate(0, 0, i)
+	}
+	return result
+}
+
+func TestCompact(t *testing.T) {
+	// 1 января 2024 года — понедельник
+	jan1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore(jan1.Add(5 * time.Hour))
+	compactor := NewCompactor(store, config.CompactionConfig{
+		SettleHours:         2,
+		LookbackDays:        2,
+		HourlyRetentionDays: 3,
+	})
+
+	// Первый проход сворачивает все завершенные сутки с первых часовых агрегатов;
+	// сутки 10 января еще ждут опоздавших событий
+	store.horizon = jan1
+	report, err := compactor.Compact(context.Background(), jan1.AddDate(0, 0, 10).Add(time.Hour), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, days(jan1, 9), store.compacted[domain.GranularityDay])
+	assert.Equal(t, []time.Time{jan1}, store.compacted[domain.GranularityWeek])
+	assert.Empty(t, store.compacted[domain.GranularityMonth])
+	assert.Equal(t, 9, report.Buckets[domain.GranularityDay])
+
+	// Часы удаляются за сроком хранения, но не в пределах пересчитываемых суток
+	assert.Equal(t, jan1.AddDate(0, 0, 7), store.prunedTo)
+	assert.Equal(t, int64(10), report.PrunedRows)
+
+	// Следующий проход пересчитывает последние свернутые сутки
+	store.compacted = make(map[domain.Granularity][]time.Time)
+	_, err = compactor.Compact(context.Background(), jan1.AddDate(0, 0, 11).Add(3*time.Hour), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, days(jan1.AddDate(0, 0, 7), 4), store.compacted[domain.GranularityDay])
+	assert.Empty(t, store.compacted[domain.GranularityWeek])
+	assert.Equal(t, jan1.AddDate(0, 0, 8), store.prunedTo)
+
+	// Пересчет с from раньше удаленных часов отклоняется
+	store.compacted = make(map[domain.Granularity][]time.Time)
+	_, err = compactor.Compact(context.Background(), jan1.AddDate(0, 0, 11).Add(3*time.Hour), jan1)
+	require.ErrorIs(t, err, ErrBeforeHorizon)
+	assert.Empty(t, store.compacted)
+}
+
+func TestCompact_RecompactsDirtyDays(t *testing.T) {
+	// 1 января 2024 года — понедельник
+	jan1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStore(jan1.AddDate(0, 0, 3))
+	store.watermarks[domain.GranularityDay] = jan1.AddDate(0, 0, 20)
+	store.watermarks[domain.GranularityWeek] = jan1.AddDate(0, 0, 14)
+	// Опоздавшие агрегаты попали в сутки с удаленными часами и в сутки вне lookback
+	store.dirty = []time.Time{jan1.AddDate(0, 0, 1), jan1.AddDate(0, 0, 4)}
+	compactor := NewCompactor(store, config.CompactionConfig{LookbackDays: 1})
+
+	report, err := compactor.Compact(context.Background(), jan1.AddDate(0, 0, 21), time.Time{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Time{jan1.AddDate(0, 0, 19), jan1.AddDate(0, 0, 20), jan1.AddDate(0, 0, 4)},
+		store.compacted[domain.GranularityDay])
+	assert.Equal(t, 3, report.Buckets[domain.GranularityDay])
+	// Неделя суток с опоздавшими агрегатами пересчитывается вместе с ними
+	assert.Equal(t, []time.Time{jan1.AddDate(0, 0, 14), jan1}, store.compacted[domain.GranularityWeek])
+	assert.Empty(t, store.dirty)
+}
+
+func TestCompact_NoHourlyAggregates(t *testing.T) {
+	store := newFakeStore(time.Time{})
+	compactor := NewCompactor(store, config.CompactionConfig{HourlyRetentionDays: 1})
+
+	report, err := compactor.Compact(context.Background(), time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, store.compacted)
+	assert.Zero(t, report.PrunedRows)
+	assert.True(t, store.prunedTo.IsZero())
+}
@@ -9,10 +9,12 @@ import (
 
 // Config содержит все настройки приложения.
 type Config struct {
-	Database  DatabaseConfig  `mapstructure:"database"`
-	Kafka     KafkaConfig     `mapstructure:"kafka"`
-	GRPC      GRPCConfig      `mapstructure:"grpc"`
-	Ingestion IngestionConfig `mapstructure:"ingestion"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Kafka      KafkaConfig      `mapstructure:"kafka"`
+	GRPC       GRPCConfig       `mapstructure:"grpc"`
+	Ingestion  IngestionConfig  `mapstructure:"ingestion"`
+	Processor  ProcessorConfig  `mapstructure:"processor"`
+	Compaction CompactionConfig `mapstructure:"compaction"`
 }
 
 // DatabaseConfig содержит настройки подключения к базе данных.
@@ -41,7 +43,18 @@ func (d DatabaseConfig) PostgresDSN() string {
 type KafkaConfig struct {
 	Brokers  []string            `mapstructure:"brokers"`
 	Topic    string              `mapstructure:"topic"`
+	GroupID  string              `mapstructure:"group_id"`
 	Producer KafkaProducerConfig `mapstructure:"producer"`
+	DLQ      DeadLetterConfig    `mapstructure:"dlq"`
+}
+
+// DeadLetterConfig содержит настройки повторов и dead-letter топика.
+// Пустой Topic отключает перенаправление в dead-letter топик.
+type DeadLetterConfig struct {
+	Topic            string `mapstructure:"topic"`
+	MaxAttempts      int    `mapstructure:"max_attempts"`
+	InitialBackoffMs int    `mapstructure:"initial_backoff_ms"`
+	MaxBackoffMs     int    `mapstructure:"max_backoff_ms"`
 }
 
 // KafkaProducerConfig содержит настройки производителя Kafka.
@@ -69,6 +82,130 @@ type IngestionConfig struct {
 	Workers         int    `mapstructure:"workers"`
 	ChannelSize     int    `mapstructure:"channel_size"`
 	PollIntervalSec int    `mapstructure:"poll_interval_seconds"`
+	// MaxLineKB ограничивает длину строки дампа; более длинные строки пропускаются.
+	MaxLineKB int `mapstructure:"max_line_kb"`
+	// DecodeWorkers задает число горутин разбора строк; 0 означает GOMAXPROCS.
+	DecodeWorkers int `mapstructure:"decode_workers"`
+	// MetricsPort задает порт HTTP-сервера метрик Prometheus; 0 отключает сервер.
+	MetricsPort int `mapstructure:"metrics_port"`
+
+	Source     SourceConfig     `mapstructure:"source"`
+	Retry      RetryConfig      `mapstructure:"retry"`
+	Checkpoint CheckpointConfig `mapstructure:"checkpoint"`
+	EventsAPI  EventsAPIConfig  `mapstructure:"events_api"`
+	Filter     FilterConfig     `mapstructure:"filter"`
+}
+
+// FilterConfig содержит правила отбора событий перед публикацией в Kafka.
+// Пустые списки не ограничивают события.
+type FilterConfig struct {
+	// AllowOwners оставляет только репозитории перечисленных владельцев.
+	AllowOwners []string `mapstructure:"allow_owners"`
+	DenyOwners  []string `mapstructure:"deny_owners"`
+	// IncludeRepos оставляет только репозитории, имя owner/name которых
+	// совпадает хотя бы с одним регулярным выражением.
+	IncludeRepos []string `mapstructure:"include_repos"`
+	ExcludeRepos []string `mapstructure:"exclude_repos"`
+	// ExcludeBots отбрасывает события аккаунтов с логином вида name[bot].
+	ExcludeBots   bool     `mapstructure:"exclude_bots"`
+	BlockedActors []string `mapstructure:"blocked_actors"`
+	// MaxActorID отбрасывает события аккаунтов с ID больше заданного: ID растут
+	// со временем, поэтому это отсекает аккаунты, созданные позже. 0 отключает правило.
+	MaxActorID int64 `mapstructure:"max_actor_id"`
+}
+
+// SourceConfig содержит настройки источника часовых дампов.
+type SourceConfig struct {
+	// Type задает источник: "http" (GH Archive по gharchive_url) или "dir".
+	Type string `mapstructure:"type"`
+	// Dir задает каталог с дампами для источника "dir".
+	Dir string `mapstructure:"dir"`
+}
+
+// EventsAPIConfig содержит настройки опроса GitHub Events API.
+type EventsAPIConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	URL     string `mapstructure:"url"`
+	// Token передается в заголовке Authorization; без него лимит запросов ниже.
+	Token   string `mapstructure:"token"`
+	PerPage int    `mapstructure:"per_page"`
+	// MaxPages ограничивает число страниц за один опрос.
+	MaxPages int `mapstructure:"max_pages"`
+	// PollIntervalSec задает минимальный интервал опроса; X-Poll-Interval
+	// из ответа может его только увеличить.
+	PollIntervalSec int `mapstructure:"poll_interval_seconds"`
+	// SeenSize задает число последних ID событий, по которым отбрасываются повторы.
+	SeenSize int `mapstructure:"seen_size"`
+}
+
+// RetryConfig содержит настройки повторной загрузки часа.
+type RetryConfig struct {
+	// MaxAttempts задает число попыток, после которого час отмечается неудачным
+	// и пропускается; 0 означает бесконечные попытки.
+	MaxAttempts      int `mapstructure:"max_attempts"`
+	InitialBackoffMs int `mapstructure:"initial_backoff_ms"`
+	MaxBackoffMs     int `mapstructure:"max_backoff_ms"`
+	// NotFoundGraceHours задает, сколько часов после окончания часа его отсутствие
+	// считается задержкой публикации, а не ошибкой, и не расходует попытки.
+	NotFoundGraceHours int `mapstructure:"not_found_grace_hours"`
+}
+
+// CheckpointConfig содержит настройки хранения checkpoint ingestion.
+type CheckpointConfig struct {
+	// Backend задает хранилище: "postgres" или "file".
+	Backend string `mapstructure:"backend"`
+	// Path задает путь к файлу для backend "file".
+	Path string `mapstructure:"path"`
+}
+
+// ProcessorConfig содержит настройки сервиса processor.
+type ProcessorConfig struct {
+	// DedupRetentionHours задает, сколько часов хранятся записи дедупликации после
+	// создания и учета события; backfill не загружает повторно часы старше этого срока.
+	DedupRetentionHours int `mapstructure:"dedup_retention_hours"`
+	BatchSize           int `mapstructure:"batch_size"`
+	FlushIntervalMs     int `mapstructure:"flush_interval_ms"`
+	// StarEventsRetentionDays задает, сколько дней хранятся события звезд;
+	// 0 отключает удаление.
+	StarEventsRetentionDays int `mapstructure:"star_events_retention_days"`
+	// WriteLagHours задает, сколько часов после конца часа processor еще учитывает
+	// его события; rebuild не заменяет агрегаты более поздних часов.
+	WriteLagHours int `mapstructure:"write_lag_hours"`
+
+	Antispam AntispamConfig `mapstructure:"antispam"`
+}
+
+// CompactionConfig содержит настройки свертки часовых агрегатов в дневные,
+// недельные и месячные.
+type CompactionConfig struct {
+	IntervalMinutes int `mapstructure:"interval_minutes"`
+	// SettleHours задает, сколько часов после конца суток ждать опоздавших
+	// событий, прежде чем свернуть сутки.
+	SettleHours int `mapstructure:"settle_hours"`
+	// LookbackDays задает, сколько последних свернутых суток пересчитывать на
+	// каждом проходе, чтобы учесть события, учтенные позже. Более ранние сутки
+	// с опоздавшими событиями пересчитываются по отметкам.
+	LookbackDays int `mapstructure:"lookback_days"`
+	// HourlyRetentionDays задает, сколько дней хранятся часовые агрегаты и счетчики
+	// уникальных аккаунтов; 0 отключает удаление. Несвернутые часы не удаляются.
+	HourlyRetentionDays int `mapstructure:"hourly_retention_days"`
+}
+
+// AntispamConfig содержит настройки поиска накрученных звезд.
+type AntispamConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ActorWindowMinutes и ActorBurstStars: аккаунт, поставивший звезды
+	// ActorBurstStars разным репозиториям за окно, считается подозрительным.
+	ActorWindowMinutes int `mapstructure:"actor_window_minutes"`
+	ActorBurstStars    int `mapstructure:"actor_burst_stars"`
+	// RepoWindowMinutes, RepoBurstStars и RepoUnknownShare: если репозиторий
+	// получил RepoBurstStars звезд за окно и доля звезд от аккаунтов без другой
+	// активности не меньше RepoUnknownShare, такие звезды считаются подозрительными.
+	RepoWindowMinutes int     `mapstructure:"repo_window_minutes"`
+	RepoBurstStars    int     `mapstructure:"repo_burst_stars"`
+	RepoUnknownShare  float64 `mapstructure:"repo_unknown_share"`
+	// KnownActors ограничивает число запоминаемых аккаунтов с другой активностью.
+	KnownActors int `mapstructure:"known_actors"`
 }
 
 // LoadConfig загружает конфигурацию из файла.
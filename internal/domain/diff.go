@@ -0,0 +1,18 @@
+package domain
+
+// MetricCounts содержит значения метрик.
+type MetricCounts map[Metric]int64
+
+// RepoDiff описывает расхождение пересчитанных агрегатов репозитория
+// с текущими за диапазон.
+type RepoDiff struct {
+	RepoID   int64
+	RepoName string
+	Old      MetricCounts
+	New      MetricCounts
+}
+
+// Delta возвращает изменение метрики после пересчета.
+func (d RepoDiff) Delta(metric Metric) int64 {
+	return d.New[metric] - d.Old[metric]
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "errors"
+
+var (
+	// ErrRepoNotFound возвращается, если репозиторий не найден в хранилище.
+	ErrRepoNotFound = errors.New("repo not found")
+	// ErrDuplicateEvent возвращается, если событие уже было учтено ранее.
+	ErrDuplicateEvent = errors.New("event already processed")
+)
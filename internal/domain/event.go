@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-// Event представляет событие звезды GitHub.
+// Event представляет учитываемое событие GitHub.
 type Event struct {
 	ID     string
 	Action ActionType
@@ -15,6 +15,9 @@ type Event struct {
 	ActorLogin string
 
 	CreatedAt time.Time
+
+	// Flagged помечает звезду как подозрительную.
+	Flagged bool
 }
 
 // ActionType представляет тип действия в событии.
@@ -23,4 +26,62 @@ type ActionType string
 const (
 	// ActionStarred является типом действия для звезды репозитория.
 	ActionStarred ActionType = "starred"
+	// ActionForked является типом действия для форка репозитория.
+	ActionForked ActionType = "forked"
+	// ActionPROpened является типом действия для открытия pull request.
+	ActionPROpened ActionType = "pr_opened"
+	// ActionPRMerged является типом действия для слияния pull request.
+	ActionPRMerged ActionType = "pr_merged"
+	// ActionIssueOpened является типом действия для открытия issue.
+	ActionIssueOpened ActionType = "issue_opened"
+	// ActionReleasePublished является типом действия для публикации релиза.
+	ActionReleasePublished ActionType = "release_published"
+)
+
+// Metric представляет счетчик, который агрегируется по репозиторию и часу.
+type Metric string
+
+const (
+	// MetricStars считает звезды.
+	MetricStars Metric = "stars"
+	// MetricForks считает форки.
+	MetricForks Metric = "forks"
+	// MetricPRsOpened считает открытые pull request.
+	MetricPRsOpened Metric = "prs_opened"
+	// MetricPRsMerged считает слитые pull request.
+	MetricPRsMerged Metric = "prs_merged"
+	// MetricIssuesOpened считает открытые issue.
+	MetricIssuesOpened Metric = "issues_opened"
+	// MetricReleases считает опубликованные релизы.
+	MetricReleases Metric = "releases"
 )
+
+// Metrics перечисляет все метрики в порядке вывода.
+var Metrics = []Metric{
+	MetricStars,
+	MetricForks,
+	MetricPRsOpened,
+	MetricPRsMerged,
+	MetricIssuesOpened,
+	MetricReleases,
+}
+
+// Metric возвращает метрику, которую увеличивает действие.
+func (a ActionType) Metric() (Metric, bool) {
+	switch a {
+	case ActionStarred:
+		return MetricStars, true
+	case ActionForked:
+		return MetricForks, true
+	case ActionPROpened:
+		return MetricPRsOpened, true
+	case ActionPRMerged:
+		return MetricPRsMerged, true
+	case ActionIssueOpened:
+		return MetricIssuesOpened, true
+	case ActionReleasePublished:
+		return MetricReleases, true
+	default:
+		return "", false
+	}
+}
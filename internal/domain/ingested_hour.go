@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// IngestedHourStatus представляет статус обработки часа GH Archive.
+type IngestedHourStatus string
+
+const (
+	// IngestedHourCompleted означает, что все события часа опубликованы.
+	IngestedHourCompleted IngestedHourStatus = "completed"
+	// IngestedHourFailed означает, что час пропущен после исчерпания попыток.
+	IngestedHourFailed IngestedHourStatus = "failed"
+	// IngestedHourInProgress означает, что загрузка часа прервана и будет продолжена.
+	IngestedHourInProgress IngestedHourStatus = "in_progress"
+)
+
+// HourStats содержит счетчики одной загрузки часа.
+type HourStats struct {
+	BytesDownloaded int64
+	LinesParsed     int64
+	ParseFailures   int64
+	EventsProduced  int64
+	SendFailures    int64
+	DurationMs      int64
+	// FilteredEvents считает события, отброшенные правилами фильтра ingestion.
+	FilteredEvents int64
+	// OversizedLines считает строки, пропущенные из-за превышения длины.
+	OversizedLines int64
+	// Truncated означает, что дамп поврежден и загружена только его начальная часть.
+	Truncated bool
+}
+
+// IngestedHour представляет запись журнала загрузки часа GH Archive.
+type IngestedHour struct {
+	Hour   time.Time
+	Status IngestedHourStatus
+	// Attempts считает все неудачные попытки загрузить час.
+	Attempts  int
+	LastError string
+	// LineOffset содержит число уже опубликованных строк незавершенного часа.
+	LineOffset int64
+	// HourStats содержит счетчики последней загрузки.
+	HourStats
+	UpdatedAt time.Time
+}
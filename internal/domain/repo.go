@@ -0,0 +1,7 @@
+package domain
+
+// RepoRef идентифицирует репозиторий по ID или по имени.
+type RepoRef struct {
+	ID   int64
+	Name string
+}
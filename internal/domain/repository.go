@@ -1,11 +1,41 @@
 package domain
 
 import (
+	"context"
+	"time"
+
 	"github.com/kun1ts4/stars-analytics/pkg/pb/github.com/kun1ts4/stars-analytics/proto"
 )
 
 // StatsRepo определяет интерфейс для репозитория статистики.
 type StatsRepo interface {
+	// UpdateCounts учитывает событие ровно один раз; для уже учтенного
+	// события возвращает ErrDuplicateEvent.
 	UpdateCounts(event Event) error
-	GetTopN(count int) ([]*proto.Repo, error)
+	// UpdateCountsBatch учитывает пачку событий атомарно, пропуская уже учтенные,
+	// и возвращает число учтенных событий.
+	UpdateCountsBatch(events []Event) (int, error)
+	// FreshEvents возвращает события пачки, которые еще не были учтены.
+	FreshEvents(events []Event) ([]Event, error)
+	// PruneProcessedEvents удаляет записи дедупликации событий, созданных и учтенных раньше before.
+	PruneProcessedEvents(before time.Time) (int64, error)
+	// SaveSpamFlags учитывает звезды, помеченные подозрительными задним числом,
+	// и сохраняет подозрительные аккаунты. Звезды, которые не были учтены или
+	// уже помечены, пропускаются.
+	SaveSpamFlags(stars []StarFlag, actors []ActorFlag) error
+	// GetTopN возвращает топ репозиториев по метрике metric за окно window;
+	// spam задает учет подозрительных звезд.
+	GetTopN(count int, window TimeRange, metric Metric, spam SpamPolicy) ([]*proto.Repo, error)
+	GetTimeSeries(repo RepoRef, window TimeRange, granularity Granularity) (*proto.TimeSeriesResponse, error)
+	// ListStarEvents возвращает сохраненные события звезд, упорядоченные по времени и ID.
+	ListStarEvents(query StarEventQuery) ([]Event, error)
+	// PruneStarEvents удаляет дневные секции событий звезд, целиком лежащие раньше before,
+	// и возвращает число удаленных секций.
+	PruneStarEvents(before time.Time) (int, error)
+}
+
+// IngestionLedger определяет интерфейс для журнала загрузки часов.
+type IngestionLedger interface {
+	// IngestionStatus возвращает записи журнала за окно window и часы без записей.
+	IngestionStatus(ctx context.Context, window TimeRange) (*proto.IngestionStatusResponse, error)
 }
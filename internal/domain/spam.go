@@ -0,0 +1,67 @@
+package domain
+
+import "time"
+
+// SpamMode задает учет подозрительных звезд в топе.
+type SpamMode int
+
+const (
+	// SpamModeInclude учитывает все звезды.
+	SpamModeInclude SpamMode = iota
+	// SpamModeExclude не учитывает подозрительные звезды.
+	SpamModeExclude
+	// SpamModeDiscount учитывает подозрительные звезды с весом SpamPolicy.Weight.
+	SpamModeDiscount
+)
+
+// DefaultFlaggedWeight задает вес подозрительной звезды для SpamModeDiscount по умолчанию.
+const DefaultFlaggedWeight = 0.5
+
+// SpamPolicy задает учет подозрительных звезд в топе.
+type SpamPolicy struct {
+	Mode SpamMode
+	// Weight задает вес подозрительной звезды от 0 до 1, только для SpamModeDiscount.
+	Weight float64
+}
+
+// FlaggedWeight возвращает вес, с которым учитывается подозрительная звезда.
+func (p SpamPolicy) FlaggedWeight() float64 {
+	switch p.Mode {
+	case SpamModeExclude:
+		return 0
+	case SpamModeDiscount:
+		return p.Weight
+	default:
+		return 1
+	}
+}
+
+// SpamReason представляет правило, по которому активность признана подозрительной.
+type SpamReason string
+
+const (
+	// SpamReasonActorBurst означает, что аккаунт поставил звезды многим репозиториям за короткое время.
+	SpamReasonActorBurst SpamReason = "actor_burst"
+	// SpamReasonRepoBurst означает всплеск звезд репозиторию от аккаунтов без другой активности.
+	SpamReasonRepoBurst SpamReason = "repo_burst"
+)
+
+// StarFlag описывает звезды репозитория за час, признанные подозрительными
+// после того, как они уже были учтены.
+type StarFlag struct {
+	RepoID   int64
+	RepoName string
+	Hour     time.Time
+	Stars    int
+	// EventIDs содержит ID событий помеченных звезд.
+	EventIDs []string
+}
+
+// ActorFlag описывает аккаунт, замеченный в подозрительной активности.
+type ActorFlag struct {
+	Login  string
+	Reason SpamReason
+	// Stars считает звезды аккаунта, помеченные подозрительными.
+	Stars     int
+	FlaggedAt time.Time
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// StarEventQuery задает выборку сохраненных событий звезд.
+type StarEventQuery struct {
+	// Repo ограничивает выборку репозиторием; пустое значение не ограничивает.
+	Repo RepoRef
+	// Actor ограничивает выборку аккаунтом; пустое значение не ограничивает.
+	Actor  string
+	Window TimeRange
+	Limit  int
+	// After продолжает выборку после события с этим курсором.
+	After *StarEventCursor
+}
+
+// StarEventCursor указывает позицию в выборке, упорядоченной по времени и ID события.
+type StarEventCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
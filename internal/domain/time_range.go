@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// TimeRange представляет полуинтервал времени [From, To).
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// LastHours возвращает диапазон из hours последних полных часов относительно now.
+func LastHours(now time.Time, hours int) TimeRange {
+	to := now.UTC().Truncate(time.Hour)
+	return TimeRange{
+		From: to.Add(-time.Duration(hours) * time.Hour),
+		To:   to,
+	}
+}
+
+// Validate проверяет корректность диапазона.
+func (r TimeRange) Validate() error {
+	if r.From.IsZero() || r.To.IsZero() {
+		return errors.New("range bounds are required")
+	}
+	if !r.From.Before(r.To) {
+		return errors.New("range start must be before end")
+	}
+	return nil
+}
+
+// Align расширяет диапазон до границ корзин granularity.
+func (r TimeRange) Align(g Granularity) TimeRange {
+	to := g.Truncate(r.To)
+	if to.Before(r.To) {
+		to = g.Next(to)
+	}
+	return TimeRange{
+		From: g.Truncate(r.From),
+		To:   to,
+	}
+}
+
+// Buckets возвращает количество корзин granularity в выровненном диапазоне.
+// Количество вычисляется без перебора корзин, поэтому проверка лимита
+// не зависит от длины диапазона.
+func (r TimeRange) Buckets(g Granularity) int {
+	aligned := r.Align(g)
+	if !aligned.From.Before(aligned.To) {
+		return 0
+	}
+	if g == GranularityMonth {
+		return (aligned.To.Year()-aligned.From.Year())*12 + int(aligned.To.Month()-aligned.From.Month())
+	}
+
+	// Секунды Unix не переполняются в отличие от time.Duration на длинных диапазонах.
+	seconds := aligned.To.Unix() - aligned.From.Unix()
+	switch g {
+	case GranularityDay:
+		return int(seconds / (24 * 60 * 60))
+	case GranularityWeek:
+		return int(seconds / (7 * 24 * 60 * 60))
+	default:
+		return int(seconds / (60 * 60))
+	}
+}
+
+// Granularity представляет размер корзины временного ряда.
+type Granularity string
+
+const (
+	// GranularityHour является часовой корзиной.
+	GranularityHour Granularity = "hour"
+	// GranularityDay является суточной корзиной (UTC).
+	GranularityDay Granularity = "day"
+	// GranularityWeek является недельной корзиной, начинающейся в понедельник (UTC).
+	GranularityWeek Granularity = "week"
+	// GranularityMonth является календарным месяцем (UTC).
+	GranularityMonth Granularity = "month"
+)
+
+// Truncate возвращает начало корзины, содержащей t.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case GranularityDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t.Truncate(time.Hour)
+	}
+}
+
+// Next возвращает начало корзины, следующей за корзиной bucket.
+func (g Granularity) Next(bucket time.Time) time.Time {
+	switch g {
+	case GranularityDay:
+		return bucket.AddDate(0, 0, 1)
+	case GranularityWeek:
+		return bucket.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return bucket.AddDate(0, 1, 0)
+	default:
+		return bucket.Add(time.Hour)
+	}
+}
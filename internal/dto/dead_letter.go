@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+// DeadLetterErrorType описывает причину попадания сообщения в dead-letter топик.
+type DeadLetterErrorType string
+
+const (
+	// DeadLetterDecode означает, что сообщение не удалось декодировать.
+	DeadLetterDecode DeadLetterErrorType = "decode"
+	// DeadLetterProcess означает, что событие не удалось учесть в хранилище.
+	DeadLetterProcess DeadLetterErrorType = "process"
+	// DeadLetterPublish означает, что событие не удалось отправить в основной топик.
+	DeadLetterPublish DeadLetterErrorType = "publish"
+)
+
+// DeadLetter представляет сообщение dead-letter топика: исходные данные и
+// сведения об ошибке, достаточные для разбора и повторной отправки.
+type DeadLetter struct {
+	Payload   []byte              `json:"payload"`
+	Key       string              `json:"key"`
+	ErrorType DeadLetterErrorType `json:"error_type"`
+	Error     string              `json:"error"`
+	Source    string              `json:"source"`
+	Topic     string              `json:"topic,omitempty"`
+	Partition int                 `json:"partition"`
+	Offset    int64               `json:"offset"`
+	Attempts  int                 `json:"attempts"`
+	FailedAt  time.Time           `json:"failed_at"`
+}
@@ -8,12 +8,10 @@ import (
 
 // GHEvent представляет событие GitHub из API.
 type GHEvent struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Payload struct {
-		Action string `json:"action"`
-	} `json:"payload"`
-	Repo struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Payload GHPayload `json:"payload"`
+	Repo    struct {
 		ID   int64  `json:"id"`
 		Name string `json:"name"`
 		URL  string `json:"url"`
@@ -26,6 +24,14 @@ type GHEvent struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// GHPayload содержит используемые поля payload события GitHub.
+type GHPayload struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Merged bool `json:"merged"`
+	} `json:"pull_request"`
+}
+
 // Validate проверяет, имеет ли GHEvent обязательные поля.
 func (e GHEvent) Validate() error {
 	if e.ID == "" {
@@ -12,9 +12,7 @@ func TestValidate(t *testing.T) {
 	in := GHEvent{
 		ID:   "3488012293",
 		Type: "WatchEvent",
-		Payload: struct {
-			Action string `json:"action"`
-		}{
+		Payload: GHPayload{
 			Action: "started",
 		},
 		Repo: struct {
@@ -51,9 +49,7 @@ func TestValidateError(t *testing.T) {
 			name: "missing ID",
 			event: GHEvent{
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -83,9 +79,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID: "3488012293",
 				// Type missing
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -115,9 +109,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID:   "3488012293",
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -147,9 +139,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID:   "3488012293",
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -178,9 +168,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID:   "3488012293",
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -210,9 +198,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID:   "3488012293",
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -242,9 +228,7 @@ func TestValidateError(t *testing.T) {
 			event: GHEvent{
 				ID:   "3488012293",
 				Type: "WatchEvent",
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				Repo: struct {
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,6 +18,29 @@ type KafkaEvent struct {
 	Timestamp time.Time         `json:"timestamp"`
 }
 
+// Validate проверяет, имеет ли KafkaEvent обязательные поля.
+func (e KafkaEvent) Validate() error {
+	if e.EventID == "" {
+		return errors.New("event ID is required")
+	}
+	if e.Action == "" {
+		return errors.New("action is required")
+	}
+	if _, ok := e.Action.Metric(); !ok {
+		return fmt.Errorf("unsupported action: %s", e.Action)
+	}
+	if e.RepoID == 0 {
+		return errors.New("repo ID is required")
+	}
+	if e.RepoName == "" {
+		return errors.New("repo Name is required")
+	}
+	if e.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	return nil
+}
+
 // ToDomain преобразует KafkaEvent в доменное Event.
 func (e KafkaEvent) ToDomain() domain.Event {
 	event := domain.Event{
@@ -31,22 +55,69 @@ func (e KafkaEvent) ToDomain() domain.Event {
 	return event
 }
 
-// ToKafkaEvent преобразует GHEvent в KafkaEvent.
+// ErrUnsupportedEvent означает, что событие GitHub не соответствует ни одной метрике.
+var ErrUnsupportedEvent = errors.New("unsupported event")
+
+// supportedTypes содержит типы событий GitHub, из которых извлекаются доменные действия.
+var supportedTypes = map[string]struct{}{
+	"WatchEvent":       {},
+	"ForkEvent":        {},
+	"PullRequestEvent": {},
+	"IssuesEvent":      {},
+	"ReleaseEvent":     {},
+}
+
+// IsSupportedType сообщает, может ли событие типа eventType соответствовать метрике.
+// Позволяет отбрасывать события до полного разбора JSON.
+func IsSupportedType(eventType string) bool {
+	_, ok := supportedTypes[eventType]
+	return ok
+}
+
+// ToKafkaEvent преобразует GHEvent в KafkaEvent. Для событий, которые не
+// учитываются, возвращается ошибка, оборачивающая ErrUnsupportedEvent.
 func ToKafkaEvent(gh GHEvent) (*KafkaEvent, error) {
+	action, err := actionOf(gh)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaEvent{
+		EventID:   gh.ID,
+		Action:    action,
+		RepoID:    gh.Repo.ID,
+		RepoName:  gh.Repo.Name,
+		UserLogin: gh.Actor.Login,
+		Timestamp: gh.CreatedAt,
+	}, nil
+}
+
+// actionOf определяет доменное действие по типу события и его payload.
+func actionOf(gh GHEvent) (domain.ActionType, error) {
 	switch gh.Type {
 	case "WatchEvent":
-		if gh.Payload.Action != "started" {
-			return nil, fmt.Errorf("unsupported action for WatchEvent: %s", gh.Payload.Action)
+		if gh.Payload.Action == "started" {
+			return domain.ActionStarred, nil
+		}
+	case "ForkEvent":
+		return domain.ActionForked, nil
+	case "PullRequestEvent":
+		switch {
+		case gh.Payload.Action == "opened":
+			return domain.ActionPROpened, nil
+		case gh.Payload.Action == "closed" && gh.Payload.PullRequest.Merged:
+			return domain.ActionPRMerged, nil
+		}
+	case "IssuesEvent":
+		if gh.Payload.Action == "opened" {
+			return domain.ActionIssueOpened, nil
+		}
+	case "ReleaseEvent":
+		if gh.Payload.Action == "published" {
+			return domain.ActionReleasePublished, nil
 		}
-		return &KafkaEvent{
-			EventID:   gh.ID,
-			Action:    domain.ActionStarred,
-			RepoID:    gh.Repo.ID,
-			RepoName:  gh.Repo.Name,
-			UserLogin: gh.Actor.Login,
-			Timestamp: gh.CreatedAt,
-		}, nil
 	default:
-		return nil, fmt.Errorf("unsupported event type: %s", gh.Type)
+		return "", fmt.Errorf("%w: type %s", ErrUnsupportedEvent, gh.Type)
 	}
+	return "", fmt.Errorf("%w: action %s for %s", ErrUnsupportedEvent, gh.Payload.Action, gh.Type)
 }
@@ -90,9 +90,7 @@ func TestToKafkaEvent(t *testing.T) {
 				}{
 					Login: "user",
 				},
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -128,9 +126,7 @@ func TestToKafkaEvent(t *testing.T) {
 				}{
 					Login: "developer",
 				},
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "started",
 				},
 				CreatedAt: time.Date(2025, 6, 15, 12, 30, 45, 0, time.UTC),
@@ -154,9 +150,9 @@ func TestToKafkaEvent(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "unsupported_event_fork",
+			name: "unsupported_event_issue_comment",
 			input: GHEvent{
-				Type: "ForkEvent",
+				Type: "IssueCommentEvent",
 			},
 			want:    nil,
 			wantErr: true,
@@ -181,9 +177,7 @@ func TestToKafkaEvent(t *testing.T) {
 				}{
 					Login: "user2",
 				},
-				Payload: struct {
-					Action string `json:"action"`
-				}{
+				Payload: GHPayload{
 					Action: "stopped",
 				},
 				CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
@@ -206,3 +200,71 @@ func TestToKafkaEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestKafkaEventValidate(t *testing.T) {
+	valid := KafkaEvent{
+		EventID:   "1",
+		Action:    domain.ActionStarred,
+		RepoID:    1,
+		RepoName:  "test/repo",
+		UserLogin: "user",
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, valid.Validate())
+
+	cases := []struct {
+		name   string
+		modify func(e *KafkaEvent)
+		expErr string
+	}{
+		{name: "missing_id", modify: func(e *KafkaEvent) { e.EventID = "" }, expErr: "event ID is required"},
+		{name: "missing_action", modify: func(e *KafkaEvent) { e.Action = "" }, expErr: "action is required"},
+		{name: "unknown_action", modify: func(e *KafkaEvent) { e.Action = "pushed" }, expErr: "unsupported action: pushed"},
+		{name: "missing_repo_id", modify: func(e *KafkaEvent) { e.RepoID = 0 }, expErr: "repo ID is required"},
+		{name: "missing_repo_name", modify: func(e *KafkaEvent) { e.RepoName = "" }, expErr: "repo Name is required"},
+		{name: "missing_timestamp", modify: func(e *KafkaEvent) { e.Timestamp = time.Time{} }, expErr: "timestamp is required"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			event := valid
+			c.modify(&event)
+			require.EqualError(t, event.Validate(), c.expErr)
+		})
+	}
+}
+
+func TestToKafkaEvent_Actions(t *testing.T) {
+	cases := []struct {
+		name      string
+		eventType string
+		payload   GHPayload
+		want      domain.ActionType
+	}{
+		{name: "fork", eventType: "ForkEvent", want: domain.ActionForked},
+		{name: "pr_opened", eventType: "PullRequestEvent", payload: GHPayload{Action: "opened"}, want: domain.ActionPROpened},
+		{name: "pr_merged", eventType: "PullRequestEvent", payload: mergedPayload(true), want: domain.ActionPRMerged},
+		{name: "pr_closed_unmerged", eventType: "PullRequestEvent", payload: mergedPayload(false)},
+		{name: "issue_opened", eventType: "IssuesEvent", payload: GHPayload{Action: "opened"}, want: domain.ActionIssueOpened},
+		{name: "issue_closed", eventType: "IssuesEvent", payload: GHPayload{Action: "closed"}},
+		{name: "release_published", eventType: "ReleaseEvent", payload: GHPayload{Action: "published"}, want: domain.ActionReleasePublished},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ToKafkaEvent(GHEvent{ID: "1", Type: c.eventType, Payload: c.payload})
+			if c.want == "" {
+				require.ErrorIs(t, err, ErrUnsupportedEvent)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.want, got.Action)
+		})
+	}
+}
+
+func mergedPayload(merged bool) GHPayload {
+	payload := GHPayload{Action: "closed"}
+	payload.PullRequest.Merged = merged
+	return payload
+}
@@ -0,0 +1,232 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// HourStore хранит статусы часов: полностью опубликованные, неудачные и прерванные.
+type HourStore interface {
+	CompletedHours(ctx context.Context, from, to time.Time) ([]time.Time, error)
+	// LoadProgress возвращает число уже опубликованных строк незавершенного часа.
+	LoadProgress(ctx context.Context, hour time.Time) (int64, error)
+	// SaveProgress сохраняет число опубликованных строк незавершенного часа.
+	SaveProgress(ctx context.Context, hour time.Time, offset int64) error
+	// MarkCompleted отмечает час завершенным, сохраняет счетчики загрузки и сбрасывает смещение.
+	MarkCompleted(ctx context.Context, hour time.Time, stats domain.HourStats) error
+	// MarkFailed отмечает час неудачным, прибавляя attempts к числу попыток.
+	MarkFailed(ctx context.Context, hour time.Time, attempts int, cause error) error
+	FailedHours(ctx context.Context) ([]domain.IngestedHour, error)
+	// Hours возвращает записи журнала для часов диапазона [from, to).
+	Hours(ctx context.Context, from, to time.Time) ([]domain.IngestedHour, error)
+}
+
+// BackfillReport содержит итоги прогона backfill.
+type BackfillReport struct {
+	Total     int
+	Skipped   int
+	Completed int
+	Failed    []time.Time
+	// Refused содержит часы, которые нельзя загрузить повторно без двойного
+	// учета: записи дедупликации их событий могли быть уже удалены.
+	Refused []time.Time
+}
+
+// Backfiller загружает диапазон часов GH Archive с ограниченным параллелизмом.
+type Backfiller struct {
+	fetcher     *GHArchiveFetcher
+	hours       HourStore
+	parallelism int
+	dedupWindow time.Duration
+}
+
+// NewBackfiller создает новый Backfiller. dedupWindow равен сроку хранения
+// записей дедупликации processor: processor удаляет запись, только когда и
+// событие, и его учет старше этого срока. Поэтому час, который уже частично
+// публиковался (неудачный или прерванный) и старше dedupWindow вместе с
+// последней попыткой, не загружается повторно. Нулевое значение отключает проверку.
+func NewBackfiller(fetcher *GHArchiveFetcher, hours HourStore, parallelism int, dedupWindow time.Duration) *Backfiller {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &Backfiller{
+		fetcher:     fetcher,
+		hours:       hours,
+		parallelism: parallelism,
+		dedupWindow: dedupWindow,
+	}
+}
+
+// Run публикует часы диапазона [from, to), пропуская уже завершенные ранее,
+// поэтому прерванный прогон можно просто запустить повторно. Часы, повторная
+// загрузка которых приведет к двойному учету, не публикуются и попадают в Refused.
+func (b *Backfiller) Run(ctx context.Context, from, to time.Time) (BackfillReport, error) {
+	from, to = from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour)
+
+	completed, err := b.hours.CompletedHours(ctx, from, to)
+	if err != nil {
+		return BackfillReport{}, fmt.Errorf("loading completed hours: %w", err)
+	}
+	done := make(map[time.Time]bool, len(completed))
+	for _, hour := range completed {
+		done[hour.UTC()] = true
+	}
+
+	refused, err := b.refusedHours(ctx, from, to)
+	if err != nil {
+		return BackfillReport{}, err
+	}
+
+	var pending []time.Time
+	report := BackfillReport{}
+	for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+		report.Total++
+		switch {
+		case done[hour]:
+			report.Skipped++
+		case refused[hour]:
+			report.Refused = append(report.Refused, hour)
+		default:
+			pending = append(pending, hour)
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"from":    from.Format(HourLayout),
+		"to":      to.Format(HourLayout),
+		"total":   report.Total,
+		"skipped": report.Skipped,
+		"refused": len(report.Refused),
+	}).Info("starting backfill")
+
+	return b.process(ctx, pending, report)
+}
+
+// RetryFailed повторно публикует часы, ранее отмеченные неудачными.
+func (b *Backfiller) RetryFailed(ctx context.Context) (BackfillReport, error) {
+	failed, err := b.hours.FailedHours(ctx)
+	if err != nil {
+		return BackfillReport{}, fmt.Errorf("loading failed hours: %w", err)
+	}
+
+	report := BackfillReport{Total: len(failed)}
+	pending := make([]time.Time, 0, len(failed))
+	for _, hour := range failed {
+		if b.stale(hour, time.Now()) {
+			report.Refused = append(report.Refused, hour.Hour.UTC())
+			continue
+		}
+		pending = append(pending, hour.Hour.UTC())
+	}
+
+	logger.WithField("total", len(pending)).Info("retrying failed hours")
+
+	return b.process(ctx, pending, report)
+}
+
+// refusedHours возвращает часы диапазона [from, to), повторная загрузка
+// которых может учесть события дважды.
+func (b *Backfiller) refusedHours(ctx context.Context, from, to time.Time) (map[time.Time]bool, error) {
+	if b.dedupWindow <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	if cutoff := now.Add(-b.dedupWindow); cutoff.Before(to) {
+		to = cutoff
+	}
+	if !from.Before(to) {
+		return nil, nil
+	}
+
+	records, err := b.hours.Hours(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading ingested hours: %w", err)
+	}
+	refused := make(map[time.Time]bool)
+	for _, record := range records {
+		if b.stale(record, now) {
+			refused[record.Hour.UTC()] = true
+		}
+	}
+	return refused, nil
+}
+
+// stale сообщает, что незавершенный час record мог частично публиковаться так
+// давно, что записи дедупликации его событий уже удалены.
+func (b *Backfiller) stale(record domain.IngestedHour, now time.Time) bool {
+	if b.dedupWindow <= 0 || record.Status == domain.IngestedHourCompleted {
+		return false
+	}
+	cutoff := now.Add(-b.dedupWindow)
+	return !record.Hour.Add(time.Hour).After(cutoff) && record.UpdatedAt.Before(cutoff)
+}
+
+// process публикует часы pending с ограниченным параллелизмом и дополняет report.
+func (b *Backfiller) process(ctx context.Context, pending []time.Time, report BackfillReport) (BackfillReport, error) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		processed atomic.Int64
+		sem       = make(chan struct{}, b.parallelism)
+	)
+
+dispatch:
+	for _, hour := range pending {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(hour time.Time) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := b.backfillHour(ctx, hour)
+
+			fields := logrus.Fields{
+				"hour":     hour.Format(HourLayout),
+				"progress": fmt.Sprintf("%d/%d", processed.Add(1), len(pending)),
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Failed = append(report.Failed, hour)
+				logger.WithError(err).WithFields(fields).Warn("backfill hour failed")
+				return
+			}
+			report.Completed++
+			logger.WithFields(fields).Info("backfill hour completed")
+		}(hour)
+	}
+	wg.Wait()
+
+	return report, ctx.Err()
+}
+
+// backfillHour публикует один час и отмечает его завершенным или неудачным.
+func (b *Backfiller) backfillHour(ctx context.Context, hour time.Time) error {
+	stats, err := b.fetcher.ingestHour(ctx, hour)
+	if err != nil {
+		if ctx.Err() == nil {
+			if markErr := b.hours.MarkFailed(ctx, hour, 1, err); markErr != nil {
+				logger.WithError(markErr).Warn("failed to record failed hour")
+			}
+		}
+		return err
+	}
+	if err := b.hours.MarkCompleted(ctx, hour, stats); err != nil {
+		return fmt.Errorf("marking hour completed: %w", err)
+	}
+	return nil
+}
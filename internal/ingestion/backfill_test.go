@@ -0,0 +1,259 @@
+package ingestion
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProducer запоминает ключи отправленных сообщений.
+type fakeProducer struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (p *fakeProducer) Send(_ context.Context, key string, _ []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, key)
+	return nil
+}
+
+func (p *fakeProducer) Close() error { return nil }
+
+func (p *fakeProducer) sortedKeys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := append([]string(nil), p.keys...)
+	sort.Strings(keys)
+	return keys
+}
+
+// memoryHourStore хранит завершенные, неудачные и прерванные часы в памяти.
+type memoryHourStore struct {
+	mu       sync.Mutex
+	hours    map[time.Time]bool
+	stats    map[time.Time]domain.HourStats
+	failed   map[time.Time]int
+	progress map[time.Time]int64
+	// updated содержит время последней записи неудачных и прерванных часов.
+	updated map[time.Time]time.Time
+}
+
+func (s *memoryHourStore) LoadProgress(_ context.Context, hour time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hours[hour] {
+		return 0, nil
+	}
+	return s.progress[hour], nil
+}
+
+func (s *memoryHourStore) SaveProgress(_ context.Context, hour time.Time, offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.progress == nil {
+		s.progress = make(map[time.Time]int64)
+	}
+	s.progress[hour] = offset
+	return nil
+}
+
+func (s *memoryHourStore) CompletedHours(_ context.Context, from, to time.Time) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hours []time.Time
+	for hour := range s.hours {
+		if !hour.Before(from) && hour.Before(to) {
+			hours = append(hours, hour)
+		}
+	}
+	return hours, nil
+}
+
+func (s *memoryHourStore) MarkCompleted(_ context.Context, hour time.Time, stats domain.HourStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[time.Time]domain.HourStats)
+	}
+	s.hours[hour] = true
+	s.stats[hour] = stats
+	delete(s.progress, hour)
+	delete(s.failed, hour)
+	return nil
+}
+
+func (s *memoryHourStore) MarkFailed(_ context.Context, hour time.Time, attempts int, _ error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = make(map[time.Time]int)
+	}
+	s.failed[hour] += attempts
+	return nil
+}
+
+func (s *memoryHourStore) FailedHours(_ context.Context) ([]domain.IngestedHour, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hours []domain.IngestedHour
+	for hour, attempts := range s.failed {
+		hours = append(hours, domain.IngestedHour{
+			Hour:      hour,
+			Status:    domain.IngestedHourFailed,
+			Attempts:  attempts,
+			UpdatedAt: s.updated[hour],
+		})
+	}
+	return hours, nil
+}
+
+func (s *memoryHourStore) Hours(_ context.Context, from, to time.Time) ([]domain.IngestedHour, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hours []domain.IngestedHour
+	for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+		record := domain.IngestedHour{Hour: hour, UpdatedAt: s.updated[hour]}
+		switch {
+		case s.hours[hour]:
+			record.Status = domain.IngestedHourCompleted
+		case s.failed[hour] > 0:
+			record.Status = domain.IngestedHourFailed
+		case s.progress[hour] > 0:
+			record.Status = domain.IngestedHourInProgress
+		default:
+			continue
+		}
+		hours = append(hours, record)
+	}
+	return hours, nil
+}
+
+func (s *memoryHourStore) failedAttempts() map[time.Time]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.failed)
+}
+
+func starLine(id string, createdAt time.Time) string {
+	return fmt.Sprintf(
+		`{"id":%q,"type":"WatchEvent","actor":{"id":1,"login":"user"},`+
+			`"repo":{"id":2,"name":"org/repo"},"payload":{"action":"started"},"created_at":%q}`,
+		id, createdAt.Format(time.RFC3339),
+	)
+}
+
+func gzipLines(t *testing.T, lines ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// archiveServer отдает по одному событию звезды на каждый час, кроме missing.
+func archiveServer(t *testing.T, missing time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".json.gz")
+		hour, err := time.Parse("2006-01-02-15", name)
+		if err != nil || hour.Equal(missing) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(gzipLines(t, starLine(name, hour)))
+	}))
+}
+
+func TestBackfiller_Run(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(6 * time.Hour)
+	missing := from.Add(4 * time.Hour)
+
+	server := archiveServer(t, missing)
+	defer server.Close()
+
+	producer := &fakeProducer{}
+	store := &memoryHourStore{hours: map[time.Time]bool{from.Add(time.Hour): true}}
+	source := NewHTTPArchiveSource(server.Client(), server.URL+"/")
+	fetcher := NewGHArchiveFetcher(source, from, producer, nil, nil, nil, config.IngestionConfig{
+		Workers:     2,
+		ChannelSize: 10,
+	})
+
+	report, err := NewBackfiller(fetcher, store, 3, 0).Run(context.Background(), from, to)
+	require.NoError(t, err)
+
+	require.Equal(t, 6, report.Total)
+	require.Equal(t, 1, report.Skipped)
+	require.Equal(t, 4, report.Completed)
+	require.Equal(t, []time.Time{missing}, report.Failed)
+
+	require.Equal(t, []string{
+		"2024-01-01-00", "2024-01-01-02", "2024-01-01-03", "2024-01-01-05",
+	}, producer.sortedKeys())
+	require.Len(t, store.hours, 5)
+	require.False(t, store.hours[missing])
+	require.Equal(t, map[time.Time]int{missing: 1}, store.failedAttempts())
+
+	stats := store.stats[from]
+	require.Equal(t, int64(1), stats.LinesParsed)
+	require.Equal(t, int64(1), stats.EventsProduced)
+	require.Zero(t, stats.ParseFailures)
+	require.Positive(t, stats.BytesDownloaded)
+}
+
+func TestBackfiller_RefusesHoursOutsideDedupWindow(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Hour)
+	window := 48 * time.Hour
+	old := now.Add(-72 * time.Hour)
+	retried := old.Add(time.Hour)
+	recent := now.Add(-24 * time.Hour)
+
+	server := archiveServer(t, time.Time{})
+	defer server.Close()
+
+	producer := &fakeProducer{}
+	store := &memoryHourStore{
+		hours:    map[time.Time]bool{},
+		failed:   map[time.Time]int{old: 1, retried: 1, recent: 1},
+		progress: map[time.Time]int64{},
+		updated: map[time.Time]time.Time{
+			old: old.Add(time.Hour),
+			// Час повторялся недавно, записи дедупликации его событий еще хранятся
+			retried: now,
+			recent:  recent.Add(time.Hour),
+		},
+	}
+	source := NewHTTPArchiveSource(server.Client(), server.URL+"/")
+	fetcher := NewGHArchiveFetcher(source, old, producer, nil, nil, nil, config.IngestionConfig{
+		Workers:     1,
+		ChannelSize: 10,
+	})
+	backfiller := NewBackfiller(fetcher, store, 1, window)
+
+	report, err := backfiller.Run(context.Background(), old, old.Add(3*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{old}, report.Refused)
+	require.Equal(t, 2, report.Completed)
+
+	report, err = backfiller.RetryFailed(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{old}, report.Refused)
+	require.Equal(t, 1, report.Completed)
+	require.Equal(t, map[time.Time]int{old: 1}, store.failedAttempts())
+}
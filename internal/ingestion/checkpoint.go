@@ -0,0 +1,62 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckpointStore хранит последний полностью опубликованный час.
+type CheckpointStore interface {
+	// Load возвращает сохраненный час; ok равен false, если checkpoint еще не сохранялся.
+	Load(ctx context.Context) (hour time.Time, ok bool, err error)
+	Save(ctx context.Context, hour time.Time) error
+}
+
+// FileCheckpointStore хранит checkpoint в локальном файле.
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore создает новый FileCheckpointStore.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load читает checkpoint из файла.
+func (s *FileCheckpointStore) Load(_ context.Context) (time.Time, bool, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	hour, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("parsing checkpoint: %w", err)
+	}
+	return hour.UTC(), true, nil
+}
+
+// Save атомарно записывает checkpoint в файл через временный файл.
+func (s *FileCheckpointStore) Save(_ context.Context, hour time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating checkpoint dir: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	data := []byte(hour.UTC().Format(time.RFC3339) + "\n")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replacing checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package ingestion
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "state", "checkpoint"))
+
+	_, ok, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	hour := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Save(ctx, hour))
+	require.NoError(t, store.Save(ctx, hour.Add(time.Hour)))
+
+	got, ok, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, hour.Add(time.Hour), got)
+}
@@ -0,0 +1,107 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// deadLetterSource является значением поля Source для сообщений ingestion.
+const deadLetterSource = "ingestion"
+
+// DeadLetterProducer повторяет отправку с экспоненциальной задержкой, а после
+// исчерпания попыток перенаправляет сообщение в dead-letter топик.
+type DeadLetterProducer struct {
+	producer    KafkaProducer
+	deadLetters KafkaProducer
+	topic       string
+	maxAttempts int
+	backoff     backoff.Backoff
+}
+
+// NewDeadLetterProducer создает новый DeadLetterProducer для основного топика topic.
+func NewDeadLetterProducer(
+	producer KafkaProducer,
+	deadLetters KafkaProducer,
+	topic string,
+	cfg config.DeadLetterConfig,
+) *DeadLetterProducer {
+	return &DeadLetterProducer{
+		producer:    producer,
+		deadLetters: deadLetters,
+		topic:       topic,
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		backoff:     backoff.New(cfg.InitialBackoffMs, cfg.MaxBackoffMs),
+	}
+}
+
+// Send отправляет сообщение. Ошибка возвращается, только если сообщение не
+// удалось отправить ни в основной, ни в dead-letter топик.
+func (p *DeadLetterProducer) Send(ctx context.Context, key string, value []byte) error {
+	var sendErr error
+	attempt := 1
+	for ; ; attempt++ {
+		sendErr = p.producer.Send(ctx, key, value)
+		if sendErr == nil {
+			return nil
+		}
+		if attempt >= p.maxAttempts {
+			break
+		}
+		if err := backoff.Sleep(ctx, p.backoff.Delay(attempt)); err != nil {
+			return errors.Join(sendErr, err)
+		}
+	}
+
+	letter, err := json.Marshal(dto.DeadLetter{
+		Payload:   value,
+		Key:       key,
+		ErrorType: dto.DeadLetterPublish,
+		Error:     sendErr.Error(),
+		Source:    deadLetterSource,
+		Topic:     p.topic,
+		Partition: -1,
+		Offset:    -1,
+		Attempts:  attempt,
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling dead letter: %w", err)
+	}
+	if err := p.deadLetters.Send(ctx, key, letter); err != nil {
+		return fmt.Errorf("sending to dead-letter topic: %w (original error: %v)", err, sendErr)
+	}
+
+	logger.WithError(sendErr).WithFields(logrus.Fields{
+		"key":      key,
+		"attempts": attempt,
+	}).Warn("message routed to dead-letter topic")
+	return nil
+}
+
+// Close закрывает основной и dead-letter производители.
+func (p *DeadLetterProducer) Close() error {
+	return errors.Join(p.producer.Close(), p.deadLetters.Close())
+}
+
+// NewKafkaProducer создает производителя основного топика; если задан
+// dead-letter топик, производитель оборачивается в DeadLetterProducer.
+func NewKafkaProducer(cfg config.KafkaConfig) KafkaProducer {
+	producer := kafka.NewProducer(cfg.Brokers, cfg.Topic, cfg.Producer)
+	if cfg.DLQ.Topic == "" {
+		return producer
+	}
+
+	deadLetters := kafka.NewProducer(cfg.Brokers, cfg.DLQ.Topic, cfg.Producer)
+	return NewDeadLetterProducer(producer, deadLetters, cfg.Topic, cfg.DLQ)
+}
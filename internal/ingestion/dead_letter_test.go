@@ -0,0 +1,70 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyProducer завершается ошибкой первые failures вызовов Send.
+type flakyProducer struct {
+	failures int
+	calls    int
+	values   [][]byte
+}
+
+func (p *flakyProducer) Send(_ context.Context, _ string, value []byte) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("broker unavailable")
+	}
+	p.values = append(p.values, value)
+	return nil
+}
+
+func (p *flakyProducer) Close() error { return nil }
+
+func TestDeadLetterProducer_RetriesThenSucceeds(t *testing.T) {
+	main := &flakyProducer{failures: 2}
+	dlq := &flakyProducer{}
+	producer := NewDeadLetterProducer(main, dlq, "events", config.DeadLetterConfig{MaxAttempts: 3})
+
+	err := producer.Send(context.Background(), "1", []byte("payload"))
+	require.NoError(t, err)
+
+	require.Equal(t, 3, main.calls)
+	require.Empty(t, dlq.values)
+}
+
+func TestDeadLetterProducer_RoutesToDeadLetters(t *testing.T) {
+	main := &flakyProducer{failures: 100}
+	dlq := &flakyProducer{}
+	producer := NewDeadLetterProducer(main, dlq, "events", config.DeadLetterConfig{MaxAttempts: 2})
+
+	err := producer.Send(context.Background(), "1", []byte(`{"event_id":"1"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, main.calls)
+	require.Len(t, dlq.values, 1)
+
+	var letter dto.DeadLetter
+	require.NoError(t, json.Unmarshal(dlq.values[0], &letter))
+	require.Equal(t, []byte(`{"event_id":"1"}`), letter.Payload)
+	require.Equal(t, dto.DeadLetterPublish, letter.ErrorType)
+	require.Equal(t, "broker unavailable", letter.Error)
+	require.Equal(t, "events", letter.Topic)
+	require.Equal(t, 2, letter.Attempts)
+}
+
+func TestDeadLetterProducer_DeadLettersUnavailable(t *testing.T) {
+	main := &flakyProducer{failures: 100}
+	dlq := &flakyProducer{failures: 100}
+	producer := NewDeadLetterProducer(main, dlq, "events", config.DeadLetterConfig{MaxAttempts: 1})
+
+	err := producer.Send(context.Background(), "1", []byte("payload"))
+	require.Error(t, err)
+}
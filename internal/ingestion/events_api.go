@@ -0,0 +1,230 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// nextLinkPattern извлекает ссылку rel="next" из заголовка Link.
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// EventsAPIPoller опрашивает GitHub Events API и публикует новые события в Kafka.
+// Повторы внутри окна последних SeenSize событий отбрасываются на месте; события,
+// которые позже придут из GH Archive, имеют тот же ID (ключ сообщения Kafka) и
+// пропускаются processor через processed_events.
+type EventsAPIPoller struct {
+	httpClient *http.Client
+	producer   KafkaProducer
+	filter     *EventFilter
+	config     config.EventsAPIConfig
+	workers    int
+
+	etag string
+	seen *seenSet
+}
+
+// NewEventsAPIPoller создает новый EventsAPIPoller. Если filter равен nil, публикуются все события.
+func NewEventsAPIPoller(
+	httpClient *http.Client,
+	producer KafkaProducer,
+	filter *EventFilter,
+	cfg config.EventsAPIConfig,
+	workers int,
+) *EventsAPIPoller {
+	return &EventsAPIPoller{
+		httpClient: httpClient,
+		producer:   producer,
+		filter:     filter,
+		config:     cfg,
+		workers:    workers,
+		seen:       newSeenSet(cfg.SeenSize),
+	}
+}
+
+// Run опрашивает API до отмены контекста, выдерживая интервал между опросами.
+func (p *EventsAPIPoller) Run(ctx context.Context) {
+	for {
+		interval, err := p.poll(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("events api poll failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll выполняет один опрос: получает страницы, начиная с первой, и публикует
+// новые события. Возвращает интервал до следующего опроса.
+func (p *EventsAPIPoller) poll(ctx context.Context) (time.Duration, error) {
+	interval := time.Duration(p.config.PollIntervalSec) * time.Second
+
+	events := make(chan lineEvent, p.config.PerPage)
+	done := make(chan struct{})
+	go func() {
+		publishEvents(ctx, p.producer, p.filter, p.workers, events, nil)
+		close(done)
+	}()
+	defer func() {
+		close(events)
+		<-done
+	}()
+
+	pageURL, err := p.firstPageURL()
+	if err != nil {
+		return interval, err
+	}
+
+	published := 0
+	for page := 1; pageURL != "" && page <= max(p.config.MaxPages, 1); page++ {
+		resp, err := p.fetchPage(ctx, pageURL, page == 1)
+		if err != nil {
+			return interval, err
+		}
+		interval = max(interval, resp.pollInterval)
+		if resp.notModified {
+			break
+		}
+
+		for _, event := range resp.events {
+			if !p.seen.add(event.ID) {
+				continue
+			}
+			select {
+			case events <- lineEvent{event: event}:
+			case <-ctx.Done():
+				return interval, ctx.Err()
+			}
+			published++
+		}
+		pageURL = resp.next
+	}
+
+	logger.WithFields(logrus.Fields{
+		"events":   published,
+		"interval": interval,
+	}).Debug("events api polled")
+	return interval, nil
+}
+
+// firstPageURL возвращает адрес первой страницы с учетом per_page.
+func (p *EventsAPIPoller) firstPageURL() (string, error) {
+	u, err := url.Parse(p.config.URL)
+	if err != nil {
+		return "", fmt.Errorf("parsing events api url: %w", err)
+	}
+	if p.config.PerPage > 0 {
+		query := u.Query()
+		query.Set("per_page", strconv.Itoa(p.config.PerPage))
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// eventsPage представляет ответ на запрос одной страницы событий.
+type eventsPage struct {
+	events       []dto.GHEvent
+	next         string
+	pollInterval time.Duration
+	notModified  bool
+}
+
+// fetchPage запрашивает страницу событий. Для первой страницы отправляется
+// сохраненный ETag, а новый ETag запоминается.
+func (p *EventsAPIPoller) fetchPage(ctx context.Context, pageURL string, first bool) (*eventsPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if p.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.Token)
+	}
+	if first && p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting events: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.WithError(err).Warn("failed to close response body")
+		}
+	}()
+
+	page := &eventsPage{}
+	if seconds, err := strconv.Atoi(resp.Header.Get("X-Poll-Interval")); err == nil {
+		page.pollInterval = time.Duration(seconds) * time.Second
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		page.notModified = true
+		return page, nil
+	default:
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&page.events); err != nil {
+		return nil, fmt.Errorf("decoding events: %w", err)
+	}
+	if first {
+		p.etag = resp.Header.Get("ETag")
+	}
+	if match := nextLinkPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		page.next = match[1]
+	}
+	return page, nil
+}
+
+// seenSet хранит ограниченное число последних ID событий.
+type seenSet struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+// newSeenSet создает seenSet на size ID.
+func newSeenSet(size int) *seenSet {
+	size = max(size, 1)
+	return &seenSet{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, 0, size),
+	}
+}
+
+// add добавляет ID и возвращает false, если он уже был среди запомненных.
+// При переполнении вытесняется самый старый ID.
+func (s *seenSet) add(id string) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, id)
+	} else {
+		delete(s.ids, s.order[s.next])
+		s.order[s.next] = id
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,86 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsAPIServer имитирует GitHub Events API с двумя страницами и ETag.
+type eventsAPIServer struct {
+	mu       sync.Mutex
+	etag     string
+	pages    map[string][]string
+	requests []string
+}
+
+func (s *eventsAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := r.URL.Query().Get("page")
+	s.requests = append(s.requests, page+"|"+r.Header.Get("If-None-Match"))
+
+	w.Header().Set("X-Poll-Interval", "60")
+	if page == "" && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if page == "" {
+		w.Header().Set("ETag", s.etag)
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/events?page=2>; rel="next", <http://%s/events?page=2>; rel="last"`,
+			r.Host, r.Host))
+	}
+	_, _ = fmt.Fprintf(w, "[%s]", strings.Join(s.pages[page], ","))
+}
+
+func TestEventsAPIPoller_Poll(t *testing.T) {
+	now := time.Now().UTC()
+	api := &eventsAPIServer{
+		etag: `"v1"`,
+		pages: map[string][]string{
+			"":  {starLine("3", now), starLine("2", now)},
+			"2": {starLine("2", now), starLine("1", now)},
+		},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	producer := &fakeProducer{}
+	poller := NewEventsAPIPoller(server.Client(), producer, nil, config.EventsAPIConfig{
+		URL:             server.URL + "/events",
+		MaxPages:        3,
+		PollIntervalSec: 1,
+		SeenSize:        10,
+	}, 2)
+
+	interval, err := poller.poll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 60*time.Second, interval)
+	require.Equal(t, []string{"1", "2", "3"}, producer.sortedKeys())
+
+	// Повторный опрос с тем же ETag ничего не публикует
+	_, err = poller.poll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, producer.sortedKeys(), 3)
+	require.Equal(t, []string{`|`, `2|`, `|"v1"`}, api.requests)
+}
+
+func TestSeenSet_EvictsOldest(t *testing.T) {
+	seen := newSeenSet(2)
+
+	require.True(t, seen.add("1"))
+	require.True(t, seen.add("2"))
+	require.False(t, seen.add("1"))
+	require.True(t, seen.add("3"))
+	require.True(t, seen.add("1"))
+	require.False(t, seen.add("3"))
+}
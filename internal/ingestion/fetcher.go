@@ -3,14 +3,16 @@ package ingestion
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 )
 
@@ -20,81 +22,180 @@ type KafkaProducer interface {
 	Close() error
 }
 
-// GHArchiveFetcher получает события GitHub из GH Archive.
+// GHArchiveFetcher получает часовые дампы событий GitHub из источника.
 type GHArchiveFetcher struct {
-	httpClient    *http.Client
+	source        EventSource
 	lastProcessed time.Time
 	producer      KafkaProducer
+	filter        *EventFilter
+	checkpoints   CheckpointStore
+	hours         HourStore
+	backoff       backoff.Backoff
 	config        config.IngestionConfig
 }
 
-// NewGHArchiveFetcher создает новый GHArchiveFetcher.
+// HourLayout задает формат часа во флагах командной строки.
+const HourLayout = "2006-01-02T15"
+
+// ParseHour разбирает час в формате HourLayout (UTC).
+func ParseHour(value string) (time.Time, error) {
+	hour, err := time.Parse(HourLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing hour %q: %w", value, err)
+	}
+	return hour, nil
+}
+
+// NewGHArchiveFetcher создает новый GHArchiveFetcher. Если filter равен nil, публикуются
+// все события; если checkpoints равен nil, обработанные часы не сохраняются; если hours
+// равен nil, статусы часов не записываются.
 func NewGHArchiveFetcher(
-	httpClient *http.Client,
+	source EventSource,
 	lastProcessed time.Time,
 	producer KafkaProducer,
+	filter *EventFilter,
+	checkpoints CheckpointStore,
+	hours HourStore,
 	cfg config.IngestionConfig,
 ) *GHArchiveFetcher {
 	return &GHArchiveFetcher{
-		httpClient:    httpClient,
+		source:        source,
 		lastProcessed: lastProcessed,
 		producer:      producer,
+		filter:        filter,
+		checkpoints:   checkpoints,
+		hours:         hours,
+		backoff:       backoff.New(cfg.Retry.InitialBackoffMs, cfg.Retry.MaxBackoffMs),
 		config:        cfg,
 	}
 }
 
-// Run запускает цикл получения.
+// Run запускает цикл получения до отмены ctx. Неудачный час повторяется с экспоненциальной
+// задержкой; отсутствующий час в пределах NotFoundGraceHours ожидается с обычным
+// интервалом опроса без расхода попыток. После MaxAttempts попыток час
+// отмечается неудачным и пропускается. Producer не закрывается: его могут
+// использовать другие источники, поэтому его закрывает владелец.
 func (f *GHArchiveFetcher) Run(ctx context.Context) error {
 	pollInterval := time.Duration(f.config.PollIntervalSec) * time.Second
+	notFoundGrace := time.Duration(f.config.Retry.NotFoundGraceHours) * time.Hour
+	attempts := 0
 
 	for {
-		select {
-		case <-ctx.Done():
-			return f.shutdown()
-		default:
-			nextHour := f.lastProcessed.Add(time.Hour)
-			if time.Since(nextHour) >= time.Hour {
-				if err := f.fetchHour(nextHour); err != nil {
-					logger.WithError(err).Warn("fetch failed")
-				}
-			} else {
-				time.Sleep(pollInterval)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		nextHour := f.lastProcessed.Add(time.Hour)
+		if time.Since(nextHour) < time.Hour {
+			_ = backoff.Sleep(ctx, pollInterval)
+			continue
+		}
+
+		err := f.fetchHour(ctx, nextHour)
+		if err == nil {
+			attempts = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+
+		notFound := errors.Is(err, ErrHourNotFound)
+		delay := pollInterval
+		if !notFound || time.Since(nextHour.Add(time.Hour)) >= notFoundGrace {
+			attempts++
+			if !notFound {
+				delay = f.retryDelay(attempts)
 			}
 		}
+
+		entry := logger.WithError(err).WithFields(logrus.Fields{
+			"hour":     nextHour.Format(HourLayout),
+			"attempts": attempts,
+		})
+		if f.config.Retry.MaxAttempts > 0 && attempts >= f.config.Retry.MaxAttempts {
+			entry.Error("giving up on hour")
+			f.skipHour(ctx, nextHour, attempts, err)
+			attempts = 0
+			continue
+		}
+
+		entry.WithField("retry_in", delay).Warn("fetch failed")
+		_ = backoff.Sleep(ctx, delay)
 	}
 }
 
-// shutdown выполняет корректное завершение работы fetcher.
-func (f *GHArchiveFetcher) shutdown() error {
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer shutdownCancel()
+// retryDelay возвращает задержку после неудачной попытки attempt.
+func (f *GHArchiveFetcher) retryDelay(attempt int) time.Duration {
+	if f.backoff.Initial <= 0 {
+		return time.Duration(f.config.PollIntervalSec) * time.Second
+	}
+	return f.backoff.Delay(attempt)
+}
 
-	done := make(chan struct{})
-	go func() {
-		err := f.producer.Close()
-		if err != nil {
-			logger.WithError(err).Error("failed to close producer")
+// skipHour записывает час как неудачный и переходит к следующему.
+func (f *GHArchiveFetcher) skipHour(ctx context.Context, t time.Time, attempts int, cause error) {
+	if f.hours != nil {
+		if err := f.hours.MarkFailed(ctx, t, attempts, cause); err != nil {
+			logger.WithError(err).Warn("failed to record failed hour")
 		}
-		close(done)
-	}()
+	}
+	f.advance(ctx, t)
+}
+
+// fetchHour публикует час t и сохраняет его как checkpoint.
+func (f *GHArchiveFetcher) fetchHour(ctx context.Context, t time.Time) error {
+	stats, err := f.ingestHour(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	if f.hours != nil {
+		if err := f.hours.MarkCompleted(ctx, t, stats); err != nil {
+			logger.WithError(err).Warn("failed to mark hour completed")
+		}
+	}
+	f.advance(ctx, t)
+	logger.WithFields(logrus.Fields{
+		"hour":     t.Format("2006-01-02 15"),
+		"events":   stats.EventsProduced,
+		"filtered": stats.FilteredEvents,
+	}).Info("finished processing hour")
+	return nil
+}
 
-	select {
-	case <-done:
-		logger.Info("finished closing producer")
-		return nil
-	case <-shutdownCtx.Done():
-		logger.Info("shutting down producer")
-		return shutdownCtx.Err()
+// advance делает час t последним обработанным и сохраняет checkpoint.
+func (f *GHArchiveFetcher) advance(ctx context.Context, t time.Time) {
+	f.lastProcessed = t
+	if f.checkpoints != nil {
+		if err := f.checkpoints.Save(ctx, t); err != nil {
+			logger.WithError(err).Warn("failed to save checkpoint")
+		}
 	}
 }
 
-func (f *GHArchiveFetcher) fetchHour(t time.Time) error {
+// progressInterval задает период сохранения смещения обрабатываемого часа.
+const progressInterval = 10 * time.Second
+
+// ingestHour читает час t из источника, публикует его события и возвращает
+// счетчики загрузки, не меняя состояние fetcher. Безопасен для параллельного вызова.
+// Если задан hours, час продолжается с сохраненного смещения строки, а само смещение
+// периодически и при прерывании сохраняется; счетчики относятся только к прочитанной части.
+func (f *GHArchiveFetcher) ingestHour(ctx context.Context, t time.Time) (domain.HourStats, error) {
+	stats := domain.HourStats{}
 	if time.Since(t) < time.Hour {
-		return fmt.Errorf("data not ready yet, need to wait")
+		return stats, fmt.Errorf("data not ready yet, need to wait")
 	}
-	body, err := f.downloadHour(t)
+
+	offset, err := f.loadProgress(ctx, t)
 	if err != nil {
-		return err
+		return stats, err
+	}
+
+	started := time.Now()
+	body, err := f.source.Open(ctx, t)
+	if err != nil {
+		return stats, err
 	}
 	defer func() {
 		if err := body.Close(); err != nil {
@@ -102,38 +203,97 @@ func (f *GHArchiveFetcher) fetchHour(t time.Time) error {
 		}
 	}()
 
-	if err := f.processStream(body); err != nil {
-		return err
+	if offset > 0 {
+		logger.WithFields(logrus.Fields{
+			"hour":   t.Format(HourLayout),
+			"offset": offset,
+		}).Info("resuming hour")
 	}
 
-	f.lastProcessed = t
-	logger.WithFields(logrus.Fields{
-		"hour": t.Format("2006-01-02 15"),
-	}).Info("finished processing hour")
-	return nil
-}
+	tracker := newLineTracker(offset)
+	stopProgress := f.trackProgress(ctx, t, tracker)
 
-func (f *GHArchiveFetcher) downloadHour(date time.Time) (io.ReadCloser, error) {
-	url := fmt.Sprintf(
-		"%s%s-%02d.json.gz",
-		f.config.GHArchiveURL,
-		date.Format("2006-01-02"),
-		date.Hour(),
-	)
+	counter := &countingReader{r: body}
+	err = f.processStream(ctx, counter, offset, tracker, &stats)
+	stopProgress()
+	stats.BytesDownloaded = counter.n
+	stats.DurationMs = time.Since(started).Milliseconds()
 
-	logger.WithFields(logrus.Fields{
-		"url": url,
-	}).Info("downloading")
+	if err != nil {
+		f.saveProgress(t, tracker.offset())
+	}
+	return stats, err
+}
 
-	resp, err := f.httpClient.Get(url)
+// loadProgress возвращает сохраненное смещение незавершенного часа t.
+func (f *GHArchiveFetcher) loadProgress(ctx context.Context, t time.Time) (int64, error) {
+	if f.hours == nil {
+		return 0, nil
+	}
+	offset, err := f.hours.LoadProgress(ctx, t)
 	if err != nil {
-		return nil, fmt.Errorf("download: %w", err)
+		return 0, fmt.Errorf("loading hour progress: %w", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		if err := resp.Body.Close(); err != nil {
-			logger.WithError(err).Warn("failed to close response body")
+	return offset, nil
+}
+
+// trackProgress периодически сохраняет смещение часа t, пока не будет вызвана
+// возвращенная функция остановки.
+func (f *GHArchiveFetcher) trackProgress(ctx context.Context, t time.Time, tracker *lineTracker) func() {
+	if f.hours == nil {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		saved := tracker.offset()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if offset := tracker.offset(); offset != saved {
+				f.saveProgress(t, offset)
+				saved = offset
+			}
 		}
-		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}()
+
+	return func() {
+		close(stop)
+		<-done
 	}
-	return resp.Body, nil
+}
+
+// saveProgress сохраняет смещение часа t. Использует отдельный контекст, чтобы
+// смещение записалось и после отмены основного.
+func (f *GHArchiveFetcher) saveProgress(t time.Time, offset int64) {
+	if f.hours == nil || offset == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.hours.SaveProgress(ctx, t, offset); err != nil {
+		logger.WithError(err).WithField("hour", t.Format(HourLayout)).Warn("failed to save hour progress")
+	}
+}
+
+// countingReader считает прочитанные байты.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,159 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGHArchiveFetcher_Run_SkipsHourAfterMaxAttempts(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	failedHour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	store := &memoryHourStore{hours: map[time.Time]bool{}}
+	checkpoints := NewFileCheckpointStore(t.TempDir() + "/checkpoint")
+	fetcher := NewGHArchiveFetcher(
+		NewHTTPArchiveSource(server.Client(), server.URL+"/"),
+		failedHour.Add(-time.Hour),
+		&fakeProducer{},
+		nil,
+		checkpoints,
+		store,
+		config.IngestionConfig{
+			Workers:         1,
+			PollIntervalSec: 1,
+			Retry: config.RetryConfig{
+				MaxAttempts:      3,
+				InitialBackoffMs: 1,
+				MaxBackoffMs:     2,
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- fetcher.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return store.failedAttempts()[failedHour] == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	require.GreaterOrEqual(t, requests.Load(), int64(3))
+	saved, ok, err := checkpoints.Load(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, saved.Before(failedHour))
+}
+
+// cancelingProducer отменяет контекст на отправке с ключом cancelOn и после этого
+// отклоняет все отправки.
+type cancelingProducer struct {
+	fakeProducer
+	cancelOn string
+	cancel   context.CancelFunc
+}
+
+func (p *cancelingProducer) Send(ctx context.Context, key string, value []byte) error {
+	if key == p.cancelOn {
+		p.cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.fakeProducer.Send(ctx, key, value)
+}
+
+func TestGHArchiveFetcher_IngestHour_ResumesFromOffset(t *testing.T) {
+	hour := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	lines := []string{
+		starLine("1", hour), "not json", starLine("3", hour), starLine("4", hour), starLine("5", hour),
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01-01-5.json.gz"), gzipLines(t, lines...), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	producer := &cancelingProducer{cancelOn: "4", cancel: cancel}
+	store := &memoryHourStore{hours: map[time.Time]bool{}}
+	cfg := config.IngestionConfig{Workers: 1, ChannelSize: 1, DecodeWorkers: 1}
+
+	fetcher := NewGHArchiveFetcher(NewDirSource(dir), hour, producer, nil, nil, store, cfg)
+	_, err := fetcher.ingestHour(ctx, hour)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"1", "3"}, producer.sortedKeys())
+	require.Equal(t, int64(3), store.progress[hour])
+
+	resumed := &fakeProducer{}
+	fetcher = NewGHArchiveFetcher(NewDirSource(dir), hour, resumed, nil, nil, store, cfg)
+	stats, err := fetcher.ingestHour(context.Background(), hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"4", "5"}, resumed.sortedKeys())
+	require.Equal(t, int64(2), stats.LinesParsed)
+}
+
+// rejectingProducer отклоняет отправку с ключом rejectOn.
+type rejectingProducer struct {
+	fakeProducer
+	rejectOn string
+}
+
+func (p *rejectingProducer) Send(ctx context.Context, key string, value []byte) error {
+	if key == p.rejectOn {
+		return errors.New("broker unavailable")
+	}
+	return p.fakeProducer.Send(ctx, key, value)
+}
+
+func TestGHArchiveFetcher_IngestHour_RetriesFailedSends(t *testing.T) {
+	hour := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	lines := []string{starLine("1", hour), starLine("2", hour), starLine("3", hour)}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01-01-5.json.gz"), gzipLines(t, lines...), 0o600))
+
+	producer := &rejectingProducer{rejectOn: "2"}
+	store := &memoryHourStore{hours: map[time.Time]bool{}}
+	cfg := config.IngestionConfig{Workers: 1, ChannelSize: 1, DecodeWorkers: 1}
+
+	fetcher := NewGHArchiveFetcher(NewDirSource(dir), hour, producer, nil, nil, store, cfg)
+	stats, err := fetcher.ingestHour(context.Background(), hour)
+	require.ErrorIs(t, err, ErrSendFailed)
+	require.Equal(t, int64(1), stats.SendFailures)
+	// Смещение остается на неотправленной строке
+	require.Equal(t, int64(1), store.progress[hour])
+
+	resumed := &fakeProducer{}
+	fetcher = NewGHArchiveFetcher(NewDirSource(dir), hour, resumed, nil, nil, store, cfg)
+	_, err = fetcher.ingestHour(context.Background(), hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "3"}, resumed.sortedKeys())
+}
+
+func TestLineTracker_Offset(t *testing.T) {
+	tracker := newLineTracker(2)
+
+	tracker.markDone(3)
+	tracker.markDone(5)
+	require.Equal(t, int64(2), tracker.offset())
+
+	tracker.markDone(2)
+	require.Equal(t, int64(4), tracker.offset())
+
+	tracker.markDone(4)
+	require.Equal(t, int64(6), tracker.offset())
+}
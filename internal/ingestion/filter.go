@@ -0,0 +1,124 @@
+package ingestion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+)
+
+// Правила фильтрации; используются как метка счетчика отброшенных событий.
+const (
+	RuleOwnerNotAllowed = "owner_not_allowed"
+	RuleOwnerDenied     = "owner_denied"
+	RuleRepoNotIncluded = "repo_not_included"
+	RuleRepoExcluded    = "repo_excluded"
+	RuleBotActor        = "bot_actor"
+	RuleBlockedActor    = "blocked_actor"
+	RuleNewAccount      = "new_account"
+)
+
+// EventFilter отбирает события по правилам конфигурации. Владельцы и логины
+// сравниваются без учета регистра. Nil-фильтр пропускает все события.
+type EventFilter struct {
+	allowOwners   map[string]struct{}
+	denyOwners    map[string]struct{}
+	includeRepos  []*regexp.Regexp
+	excludeRepos  []*regexp.Regexp
+	excludeBots   bool
+	blockedActors map[string]struct{}
+	maxActorID    int64
+}
+
+// NewEventFilter создает EventFilter и компилирует регулярные выражения имен репозиториев.
+func NewEventFilter(cfg config.FilterConfig) (*EventFilter, error) {
+	includeRepos, err := compilePatterns(cfg.IncludeRepos)
+	if err != nil {
+		return nil, fmt.Errorf("include_repos: %w", err)
+	}
+	excludeRepos, err := compilePatterns(cfg.ExcludeRepos)
+	if err != nil {
+		return nil, fmt.Errorf("exclude_repos: %w", err)
+	}
+
+	return &EventFilter{
+		allowOwners:   lowerSet(cfg.AllowOwners),
+		denyOwners:    lowerSet(cfg.DenyOwners),
+		includeRepos:  includeRepos,
+		excludeRepos:  excludeRepos,
+		excludeBots:   cfg.ExcludeBots,
+		blockedActors: lowerSet(cfg.BlockedActors),
+		maxActorID:    cfg.MaxActorID,
+	}, nil
+}
+
+// Check возвращает правило, по которому событие отбрасывается, и false;
+// для пропускаемого события возвращается пустая строка и true.
+func (f *EventFilter) Check(event dto.GHEvent) (string, bool) {
+	if f == nil {
+		return "", true
+	}
+
+	owner, _, _ := strings.Cut(event.Repo.Name, "/")
+	owner = strings.ToLower(owner)
+	if len(f.allowOwners) > 0 {
+		if _, ok := f.allowOwners[owner]; !ok {
+			return RuleOwnerNotAllowed, false
+		}
+	}
+	if _, ok := f.denyOwners[owner]; ok {
+		return RuleOwnerDenied, false
+	}
+	if len(f.includeRepos) > 0 && !matchAny(f.includeRepos, event.Repo.Name) {
+		return RuleRepoNotIncluded, false
+	}
+	if matchAny(f.excludeRepos, event.Repo.Name) {
+		return RuleRepoExcluded, false
+	}
+
+	login := strings.ToLower(event.Actor.Login)
+	if f.excludeBots && strings.HasSuffix(login, "[bot]") {
+		return RuleBotActor, false
+	}
+	if _, ok := f.blockedActors[login]; ok {
+		return RuleBlockedActor, false
+	}
+	if f.maxActorID > 0 && int64(event.Actor.ID) > f.maxActorID {
+		return RuleNewAccount, false
+	}
+	return "", true
+}
+
+// compilePatterns компилирует список регулярных выражений.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchAny сообщает, совпадает ли value хотя бы с одним выражением.
+func matchAny(patterns []*regexp.Regexp, value string) bool {
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerSet строит множество значений в нижнем регистре.
+func lowerSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,87 @@
+package ingestion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func filterEvent(repo, login string, actorID int) dto.GHEvent {
+	event := dto.GHEvent{ID: "1", Type: "WatchEvent", CreatedAt: time.Now().UTC()}
+	event.Payload.Action = "started"
+	event.Repo.ID = 2
+	event.Repo.Name = repo
+	event.Actor.ID = actorID
+	event.Actor.Login = login
+	return event
+}
+
+func TestEventFilter_Check(t *testing.T) {
+	filter, err := NewEventFilter(config.FilterConfig{
+		AllowOwners:   []string{"Kubernetes", "golang", "spam"},
+		DenyOwners:    []string{"spam"},
+		IncludeRepos:  []string{`(?i)^(kubernetes|golang|spam)/`},
+		ExcludeRepos:  []string{`-mirror$`},
+		ExcludeBots:   true,
+		BlockedActors: []string{"Farmer"},
+		MaxActorID:    1000,
+	})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name  string
+		event dto.GHEvent
+		rule  string
+	}{
+		{name: "kept", event: filterEvent("kubernetes/kubernetes", "dev", 10)},
+		{name: "owner case", event: filterEvent("GoLang/go", "dev", 10)},
+		{name: "not allowed", event: filterEvent("other/repo", "dev", 10), rule: RuleOwnerNotAllowed},
+		{name: "denied", event: filterEvent("spam/repo", "dev", 10), rule: RuleOwnerDenied},
+		{name: "excluded repo", event: filterEvent("golang/go-mirror", "dev", 10), rule: RuleRepoExcluded},
+		{name: "bot", event: filterEvent("golang/go", "dependabot[bot]", 10), rule: RuleBotActor},
+		{name: "blocked", event: filterEvent("golang/go", "farmer", 10), rule: RuleBlockedActor},
+		{name: "new account", event: filterEvent("golang/go", "dev", 1001), rule: RuleNewAccount},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok := filter.Check(tc.event)
+			require.Equal(t, tc.rule == "", ok)
+			require.Equal(t, tc.rule, rule)
+		})
+	}
+}
+
+func TestEventFilter_IncludeRepos(t *testing.T) {
+	filter, err := NewEventFilter(config.FilterConfig{IncludeRepos: []string{`^golang/`}})
+	require.NoError(t, err)
+
+	rule, ok := filter.Check(filterEvent("rust-lang/rust", "dev", 10))
+	require.False(t, ok)
+	require.Equal(t, RuleRepoNotIncluded, rule)
+
+	_, err = NewEventFilter(config.FilterConfig{ExcludeRepos: []string{"("}})
+	require.Error(t, err)
+}
+
+func TestPublishEvents_CountsFiltered(t *testing.T) {
+	filter, err := NewEventFilter(config.FilterConfig{ExcludeBots: true})
+	require.NoError(t, err)
+
+	events := make(chan lineEvent, 2)
+	events <- lineEvent{event: filterEvent("org/repo", "dev", 10)}
+	bot := filterEvent("org/repo", "ci[bot]", 11)
+	bot.ID = "2"
+	events <- lineEvent{line: 1, event: bot}
+	close(events)
+
+	producer := &fakeProducer{}
+	tracker := newLineTracker(0)
+	stats := publishEvents(context.Background(), producer, filter, 1, events, tracker)
+	require.Equal(t, PublishStats{Produced: 1, Filtered: 1}, stats)
+	require.Equal(t, []string{"1"}, producer.sortedKeys())
+	require.Equal(t, int64(2), tracker.offset())
+}
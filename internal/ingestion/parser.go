@@ -2,54 +2,504 @@ package ingestion
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"sync"
 
 	"github.com/kun1ts4/stars-analytics/internal/dto"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 )
 
-// ParseStream reads a gzipped JSON stream and sends events to the channel
-func ParseStream(r io.Reader, events chan<- dto.GHEvent) error {
-	gz, err := gzip.NewReader(r)
-	if err != nil {
-		return fmt.Errorf("gzip reader: %w", err)
+// gzipMagic содержит два байта, с которых начинается любой поток gzip.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+const (
+	// DefaultMaxLineSize задает наибольшую длину строки в байтах, если лимит не настроен.
+	DefaultMaxLineSize = 16 << 20
+	// readerBufferSize задает размер буферов чтения из пула.
+	readerBufferSize = 64 << 10
+	// maxPooledLineSize задает наибольший буфер строки, возвращаемый в пул, чтобы
+	// одна огромная строка не удерживала память в следующих часах.
+	maxPooledLineSize = 1 << 20
+	// batchLines и batchBytes ограничивают пачку строк, передаваемую декодеру.
+	batchLines = 512
+	batchBytes = 1 << 20
+)
+
+var (
+	// errLineTooLong передается обработчику для строки длиннее лимита.
+	errLineTooLong = errors.New("line too long")
+	// errIrrelevant передается обработчику для события типа, не дающего метрик.
+	errIrrelevant = errors.New("irrelevant event type")
+)
+
+var (
+	readerPool = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, readerBufferSize) }}
+	linePool   = sync.Pool{New: func() any { buf := make([]byte, 0, readerBufferSize); return &buf }}
+	batchPool  = sync.Pool{New: func() any { return &lineBatch{} }}
+	gzipPool   sync.Pool
+)
+
+// ParseStats содержит счетчики строк, прочитанных ParseStream.
+type ParseStats struct {
+	// Lines считает прочитанные строки, включая не разобранные.
+	Lines    int64
+	Failures int64
+	// Oversized считает строки, пропущенные из-за превышения длины.
+	Oversized int64
+	// Filtered считает строки, пропущенные по типу без декодирования.
+	Filtered int64
+	// Truncated означает, что поток оборвался поврежденными данными gzip; тогда
+	// Lines считает строки, прочитанные до повреждения.
+	Truncated bool
+}
+
+// ParseStream читает поток JSON-строк, сжатый gzip или нет, и отправляет события в канал.
+// События типов, не дающих метрик, отбрасываются без декодирования, а порядок
+// отправки событий не гарантируется. Чтение прекращается при отмене ctx.
+func ParseStream(ctx context.Context, r io.Reader, events chan<- dto.GHEvent) (ParseStats, error) {
+	return scanLines(ctx, r, 0, scanOptions{}, func(_ int64, event dto.GHEvent, err error) error {
+		if err != nil {
+			return nil
+		}
+		select {
+		case events <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// lineHandler получает событие строки с номером от нуля или причину, по которой
+// строка не разобрана. Вызывается одновременно из нескольких декодеров.
+type lineHandler func(line int64, event dto.GHEvent, err error) error
+
+// scanOptions настраивает scanLines; нулевые значения выбирают значения по умолчанию.
+type scanOptions struct {
+	// maxLine задает наибольшую длину строки в байтах; длинные передаются как errLineTooLong.
+	maxLine int
+	// decoders задает число горутин, декодирующих строки; по умолчанию GOMAXPROCS.
+	decoders int
+}
+
+func (o scanOptions) withDefaults() scanOptions {
+	if o.maxLine <= 0 {
+		o.maxLine = DefaultMaxLineSize
+	}
+	if o.decoders <= 0 {
+		o.decoders = runtime.GOMAXPROCS(0)
+	}
+	return o
+}
+
+// scanLines читает поток JSON-строк, пропускает первые skip строк и передает
+// остальные в handle. Распаковка и разбиение на строки идут в вызывающей горутине,
+// а opts.decoders горутин отбрасывают строки по типу, декодируют их и вызывают
+// handle. Слишком длинные, некорректные и ненужные строки передаются с ошибкой.
+// Поврежденный хвост gzip завершает поток без ошибки, а ошибка самого r
+// возвращается. Чтение прекращается на первой ошибке handle или при отмене ctx.
+func scanLines(ctx context.Context, r io.Reader, skip int64, opts scanOptions, handle lineHandler) (ParseStats, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	batches := make(chan *lineBatch, opts.decoders*2)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		decoded ParseStats
+	)
+	for i := 0; i < opts.decoders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := decodeBatches(ctx, batches, handle, cancel)
+			mu.Lock()
+			decoded.Failures += local.Failures
+			decoded.Filtered += local.Filtered
+			mu.Unlock()
+		}()
+	}
+
+	stats, err := readLines(ctx, r, skip, opts.maxLine, batches)
+	close(batches)
+	wg.Wait()
+	stats.Failures = decoded.Failures
+	stats.Filtered = decoded.Filtered
+
+	if stats.Lines == stats.Failures+stats.Oversized {
+		logger.Warn("no events found in the stream")
+	}
+	if cause := context.Cause(ctx); cause != nil {
+		return stats, cause
+	}
+	return stats, err
+}
+
+// readLines при необходимости распаковывает r, разбивает его на строки и отправляет
+// их пачками в batches, пропуская первые skip строк. Считает строки и слишком
+// длинные строки и распознает поврежденный хвост gzip; итоги разбора считают декодеры.
+func readLines(ctx context.Context, r io.Reader, skip int64, maxLine int, batches chan<- *lineBatch) (ParseStats, error) {
+	stats := ParseStats{}
+
+	src := &sourceReader{r: r}
+	br := getReader(src)
+	defer putReader(br)
+
+	lines := br
+	compressed := false
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := getGzipReader(br)
+		if err != nil {
+			return stats, fmt.Errorf("gzip reader: %w", err)
+		}
+		defer gzipPool.Put(gz)
+		lines = getReader(gz)
+		defer putReader(lines)
+		compressed = true
 	}
+
+	lr := newLineReader(lines, maxLine)
+	defer lr.release()
+
+	batch := batchPool.Get().(*lineBatch)
 	defer func() {
-		if err := gz.Close(); err != nil {
-			logger.WithError(err).Warn("failed to close gzip reader")
+		if batch != nil {
+			batch.release()
 		}
 	}()
+	flush := func() error {
+		if len(batch.lines) == 0 {
+			return nil
+		}
+		select {
+		case batches <- batch:
+			batch = batchPool.Get().(*lineBatch)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
-	scanner := bufio.NewScanner(gz)
-	const maxCapacity = 50 * 1024 * 1024 // 50MB
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
+	for line := int64(0); ; line++ {
+		data, err := lr.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, errLineTooLong) {
+			if compressed && src.err == nil && isCorruptGzip(err) {
+				stats.Truncated = true
+				logger.WithError(err).WithField("salvaged_lines", line).Warn("corrupt gzip stream, skipping the rest")
+				break
+			}
+			return stats, fmt.Errorf("reading line %d: %w", line, err)
+		}
+		if line < skip {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
 
-	count := 0
-	for scanner.Scan() {
-		event, err := ParseEvent(scanner.Bytes())
+		stats.Lines++
 		if err != nil {
-			logger.WithError(err).Warn("failed to parse event")
+			stats.Oversized++
+			logger.WithError(err).WithField("line", line).Warn("skipping oversized line")
+			batch.addOversized(line)
+		} else {
+			batch.add(line, data)
+		}
+		if batch.full() {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	return stats, flush()
+}
+
+// decodeBatches обрабатывает строки пачек до закрытия канала. После первой
+// ошибки обработчика отменяет чтение и только вычитывает оставшиеся пачки.
+func decodeBatches(
+	ctx context.Context,
+	batches <-chan *lineBatch,
+	handle lineHandler,
+	cancel context.CancelCauseFunc,
+) ParseStats {
+	stats := ParseStats{}
+	for batch := range batches {
+		if ctx.Err() == nil {
+			if err := decodeBatch(batch, handle, &stats); err != nil {
+				cancel(err)
+			}
+		}
+		batch.release()
+	}
+	return stats
+}
+
+// decodeBatch отбрасывает по типу и декодирует строки пачки и передает их в handle.
+func decodeBatch(batch *lineBatch, handle lineHandler, stats *ParseStats) error {
+	for _, line := range batch.lines {
+		event := dto.GHEvent{}
+		var err error
+		switch {
+		case line.oversized:
+			err = errLineTooLong
+		default:
+			data := batch.data[line.start:line.end]
+			if eventType, ok := peekType(data); ok && !dto.IsSupportedType(eventType) {
+				stats.Filtered++
+				err = errIrrelevant
+				break
+			}
+			if event, err = ParseEvent(data); err != nil {
+				stats.Failures++
+				logger.WithError(err).Warn("failed to parse event")
+			}
+		}
+		if err := handle(line.number, event, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineBatch содержит подряд идущие строки, скопированные из lineReader.
+type lineBatch struct {
+	data  []byte
+	lines []batchLine
+}
+
+// batchLine указывает положение строки в lineBatch.data.
+type batchLine struct {
+	number     int64
+	start, end int
+	oversized  bool
+}
+
+func (b *lineBatch) add(number int64, line []byte) {
+	start := len(b.data)
+	b.data = append(b.data, line...)
+	b.lines = append(b.lines, batchLine{number: number, start: start, end: len(b.data)})
+}
+
+func (b *lineBatch) addOversized(number int64) {
+	b.lines = append(b.lines, batchLine{number: number, oversized: true})
+}
+
+func (b *lineBatch) full() bool {
+	return len(b.lines) >= batchLines || len(b.data) >= batchBytes
+}
+
+// release возвращает пачку в пул, если огромная строка не раздула ее буфер.
+func (b *lineBatch) release() {
+	if cap(b.data) > batchBytes+maxPooledLineSize {
+		return
+	}
+	b.data = b.data[:0]
+	b.lines = b.lines[:0]
+	batchPool.Put(b)
+}
+
+// peekType возвращает значение поля "type" верхнего уровня без декодирования строки.
+// Поля вложенных объектов не учитываются. Возвращает false, если поля нет, оно
+// содержит экранирование или строка слишком некорректна, чтобы его найти.
+func peekType(line []byte) (string, bool) {
+	depth := 0
+	expectKey := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '{':
+			depth++
+			expectKey = depth == 1
+		case '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		case '"':
+			end := stringEnd(line, i)
+			if end < 0 {
+				return "", false
+			}
+			if depth == 1 && expectKey {
+				expectKey = false
+				if string(line[i+1:end]) == "type" {
+					return stringValue(line, end+1)
+				}
+			}
+			i = end
+		}
+	}
+	return "", false
+}
+
+// stringValue читает строковое значение ключа, заканчивающегося перед from.
+func stringValue(line []byte, from int) (string, bool) {
+	i := skipSpace(line, from)
+	if i >= len(line) || line[i] != ':' {
+		return "", false
+	}
+	i = skipSpace(line, i+1)
+	if i >= len(line) || line[i] != '"' {
+		return "", false
+	}
+	end := stringEnd(line, i)
+	if end < 0 {
+		return "", false
+	}
+	value := line[i+1 : end]
+	if bytes.IndexByte(value, '\\') >= 0 {
+		return "", false
+	}
+	return string(value), true
+}
+
+// stringEnd возвращает индекс кавычки, закрывающей строку, открытую в start, или -1.
+func stringEnd(line []byte, start int) int {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func skipSpace(line []byte, i int) int {
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\r' || line[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// lineReader читает строки до перевода строки, не длиннее лимита, в буфер из пула.
+type lineReader struct {
+	br  *bufio.Reader
+	max int
+	buf *[]byte
+}
+
+func newLineReader(br *bufio.Reader, maxLine int) *lineReader {
+	buf := linePool.Get().(*[]byte)
+	return &lineReader{br: br, max: maxLine, buf: buf}
+}
+
+// next возвращает следующую строку без перевода строки. Срез действителен до
+// следующего вызова. Строка длиннее лимита вычитывается и возвращается как
+// errLineTooLong; io.EOF означает конец потока.
+func (r *lineReader) next() ([]byte, error) {
+	line := (*r.buf)[:0]
+	oversized := false
+	defer func() { *r.buf = line[:0] }()
+
+	for {
+		chunk, err := r.br.ReadSlice('\n')
+		if !oversized {
+			// Лишний байт оставляет место для самого перевода строки
+			if len(line)+len(chunk) > r.max+1 {
+				oversized = true
+				line = line[:0]
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
 			continue
+		case err == nil, errors.Is(err, io.EOF):
+			if errors.Is(err, io.EOF) && !oversized && len(line) == 0 {
+				return nil, io.EOF
+			}
+			line = dropLineEnding(line)
+			if oversized || len(line) > r.max {
+				return nil, errLineTooLong
+			}
+			return line, nil
+		default:
+			return nil, err
 		}
-		events <- event
-		count++
 	}
+}
 
-	if count == 0 {
-		logger.Warn("no events found in the stream")
+// release возвращает буфер строки в пул, если он не стал слишком большим.
+func (r *lineReader) release() {
+	if cap(*r.buf) <= maxPooledLineSize {
+		linePool.Put(r.buf)
+	}
+}
+
+// dropLineEnding удаляет завершающие "\n" или "\r\n".
+func dropLineEnding(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+// sourceReader запоминает первую ошибку исходного reader, чтобы оборванная
+// загрузка не принималась за поврежденный архив.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && s.err == nil {
+		s.err = err
 	}
+	return n, err
+}
+
+// isCorruptGzip сообщает, вызвана ли err поврежденными или обрезанными данными gzip.
+func isCorruptGzip(err error) bool {
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, gzip.ErrHeader) ||
+		errors.As(err, &corrupt)
+}
+
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
 
-	return scanner.Err()
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
+
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	gz, ok := gzipPool.Get().(*gzip.Reader)
+	if !ok {
+		return gzip.NewReader(r)
+	}
+	if err := gz.Reset(r); err != nil {
+		gzipPool.Put(gz)
+		return nil, err
+	}
+	return gz, nil
 }
 
 // ParseEvent парсит JSON-строку события GitHub в структуру GHEvent.
-func ParseEvent(bytes []byte) (dto.GHEvent, error) {
+func ParseEvent(data []byte) (dto.GHEvent, error) {
 	event := dto.GHEvent{}
-	err := json.Unmarshal(bytes, &event)
+	err := json.Unmarshal(data, &event)
 	if err != nil {
 		return event, fmt.Errorf("unmarshal event: %w", err)
 	}
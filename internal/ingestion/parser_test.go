@@ -1,6 +1,17 @@
 package ingestion
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,9 +45,7 @@ func TestParseEvent(t *testing.T) {
 			Name: "alexylem/projectpage",
 			URL:  "https://api.github.com/repos/alexylem/projectpage",
 		},
-		Payload: struct {
-			Action string `json:"action"`
-		}{
+		Payload: dto.GHPayload{
 			Action: "started",
 		},
 		CreatedAt: time.Date(2016, 1, 2, 15, 0, 3, 0, time.UTC),
@@ -46,3 +55,226 @@ func TestParseEvent(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, exp, got)
 }
+
+// collectLines запускает scanLines и возвращает отсортированные ID разобранных событий.
+func collectLines(t *testing.T, r io.Reader, maxLine int) ([]string, ParseStats, error) {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		ids []string
+	)
+	stats, err := scanLines(context.Background(), r, 0, scanOptions{maxLine: maxLine}, func(_ int64, event dto.GHEvent, err error) error {
+		if err == nil {
+			mu.Lock()
+			ids = append(ids, event.ID)
+			mu.Unlock()
+		}
+		return nil
+	})
+	sort.Strings(ids)
+	return ids, stats, err
+}
+
+func TestScanLines_SkipsOversizedLines(t *testing.T) {
+	now := time.Now().UTC()
+	long := starLine("2", now) + strings.Repeat(" ", 200)
+	input := starLine("1", now) + "\r\n" + long + "\n" + starLine("3", now)
+
+	ids, stats, err := collectLines(t, strings.NewReader(input), len(long)-1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "3"}, ids)
+	require.Equal(t, ParseStats{Lines: 3, Oversized: 1}, stats)
+}
+
+func TestScanLines_SalvagesCorruptGzipTail(t *testing.T) {
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < 100; i++ {
+		_, err := gz.Write([]byte(starLine(strconv.Itoa(i), now) + "\n"))
+		require.NoError(t, err)
+		if i == 49 {
+			require.NoError(t, gz.Flush())
+		}
+	}
+	require.NoError(t, gz.Close())
+	data := buf.Bytes()
+
+	ids, stats, err := collectLines(t, bytes.NewReader(data[:len(data)-20]), DefaultMaxLineSize)
+	require.NoError(t, err)
+	require.True(t, stats.Truncated)
+	require.GreaterOrEqual(t, len(ids), 50)
+	require.Less(t, len(ids), 100)
+	require.Equal(t, int64(len(ids)), stats.Lines)
+}
+
+// failingReader отдает свои данные, а затем возвращает ошибку err.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestScanLines_ReturnsSourceError(t *testing.T) {
+	data := gzipLines(t, starLine("1", time.Now().UTC()), starLine("2", time.Now().UTC()))
+	cause := errors.New("connection reset")
+
+	_, stats, err := collectLines(t, &failingReader{data: data[:len(data)/2], err: cause}, DefaultMaxLineSize)
+	require.ErrorIs(t, err, cause)
+	require.False(t, stats.Truncated)
+}
+
+func TestPeekType(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		want string
+		ok   bool
+	}{
+		{name: "top level", line: `{"id":"1","type":"WatchEvent"}`, want: "WatchEvent", ok: true},
+		{name: "spaces", line: `{ "id" : "1" , "type" : "PushEvent" }`, want: "PushEvent", ok: true},
+		{
+			name: "nested type first",
+			line: `{"actor":{"type":"User","tags":["type",{"type":"x"}]},"note":"\"type\":\"Fake\"","type":"ForkEvent"}`,
+			want: "ForkEvent",
+			ok:   true,
+		},
+		{name: "value named type", line: `{"kind":"type","type":"IssuesEvent"}`, want: "IssuesEvent", ok: true},
+		{name: "missing", line: `{"id":"1","payload":{"type":"WatchEvent"}}`},
+		{name: "escaped", line: `{"type":"Watch\u0045vent"}`},
+		{name: "not a string", line: `{"type":1}`},
+		{name: "unterminated", line: `{"id":"1`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := peekType([]byte(tc.line))
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestScanLines_FiltersIrrelevantTypes(t *testing.T) {
+	now := time.Now().UTC()
+	push := `{"id":"9","type":"PushEvent","actor":{"id":1,"login":"user"},"repo":{"id":2,"name":"org/repo"}}`
+	data := gzipLines(t, starLine("1", now), push, "{broken", starLine("2", now))
+
+	ids, stats, err := collectLines(t, bytes.NewReader(data), DefaultMaxLineSize)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, ids)
+	require.Equal(t, ParseStats{Lines: 4, Failures: 1, Filtered: 1}, stats)
+}
+
+func TestScanLines_StopsOnHandlerError(t *testing.T) {
+	now := time.Now().UTC()
+	lines := make([]string, 3*batchLines)
+	for i := range lines {
+		lines[i] = starLine(strconv.Itoa(i), now)
+	}
+	stop := errors.New("stop")
+
+	_, err := scanLines(context.Background(), bytes.NewReader(gzipLines(t, lines...)), 0, scanOptions{decoders: 2},
+		func(line int64, _ dto.GHEvent, _ error) error {
+			if line == 10 {
+				return stop
+			}
+			return nil
+		})
+	require.ErrorIs(t, err, stop)
+}
+
+// archiveFixture собирает сжатый час со смесью типов событий, как в GH Archive:
+// в основном push с вложенными payload и лишь несколько процентов звезд.
+func archiveFixture(b *testing.B, lines int) (data []byte, raw int) {
+	b.Helper()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	commit := `{"sha":"` + strings.Repeat("a", 40) + `","author":{"email":"dev@example.com","name":"Dev"},` +
+		`"message":"` + strings.Repeat("fix things ", 20) + `","distinct":true,"url":"https://api.github.com/x"}`
+	payloads := []struct {
+		eventType string
+		payload   string
+		weight    int
+	}{
+		{"PushEvent", `{"push_id":1,"size":3,"ref":"refs/heads/main","commits":[` +
+			strings.Join([]string{commit, commit, commit}, ",") + `]}`, 55},
+		{"CreateEvent", `{"ref":"main","ref_type":"branch","master_branch":"main","pusher_type":"user"}`, 15},
+		{"IssueCommentEvent", `{"action":"created","comment":{"body":"` + strings.Repeat("lgtm ", 60) +
+			`","user":{"login":"dev","type":"User"}}}`, 12},
+		{"WatchEvent", `{"action":"started"}`, 8},
+		{"PullRequestEvent", `{"action":"opened","pull_request":{"merged":false,"body":"` + strings.Repeat("change ", 80) +
+			`","user":{"login":"dev","type":"User"},"head":{"repo":{"type":"x"}}}}`, 7},
+		{"ForkEvent", `{"forkee":{"id":5,"name":"repo","owner":{"login":"dev","type":"User"}}}`, 3},
+	}
+
+	var plain bytes.Buffer
+	for i := 0; i < lines; {
+		for _, p := range payloads {
+			for w := 0; w < p.weight && i < lines; w, i = w+1, i+1 {
+				_, _ = fmt.Fprintf(&plain,
+					`{"id":"%d","type":%q,"actor":{"id":%d,"login":"user%d","url":"https://api.github.com/users/u"},`+
+						`"repo":{"id":%d,"name":"org/repo%d","url":"https://api.github.com/repos/org/r"},`+
+						`"payload":%s,"public":true,"created_at":%q,"org":{"id":1,"login":"org"}}`+"\n",
+					i, p.eventType, i+1, i, i%1000+1, i%1000, p.payload, created)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(plain.Bytes())
+	require.NoError(b, err)
+	require.NoError(b, gz.Close())
+	return buf.Bytes(), plain.Len()
+}
+
+// BenchmarkParse_FullDecode измеряет прежний подход: одна горутина декодирует
+// каждую строку, прежде чем посмотреть на ее тип.
+func BenchmarkParse_FullDecode(b *testing.B) {
+	data, raw := archiveFixture(b, 20000)
+	b.SetBytes(int64(raw))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(b, err)
+		scanner := bufio.NewScanner(gz)
+		scanner.Buffer(make([]byte, 1<<20), DefaultMaxLineSize)
+		for scanner.Scan() {
+			event, err := ParseEvent(scanner.Bytes())
+			if err == nil && dto.IsSupportedType(event.Type) {
+				_ = event
+			}
+		}
+		require.NoError(b, scanner.Err())
+	}
+}
+
+func BenchmarkScanLines_Prefilter(b *testing.B) {
+	benchmarkScanLines(b, 1)
+}
+
+func BenchmarkScanLines_Parallel(b *testing.B) {
+	benchmarkScanLines(b, 0)
+}
+
+func benchmarkScanLines(b *testing.B, decoders int) {
+	data, raw := archiveFixture(b, 20000)
+	b.SetBytes(int64(raw))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := scanLines(context.Background(), bytes.NewReader(data), 0, scanOptions{decoders: decoders},
+			func(int64, dto.GHEvent, error) error { return nil })
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,188 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// ErrHourNotFound означает, что дамп часа еще не опубликован или отсутствует в источнике.
+var ErrHourNotFound = errors.New("hour not found")
+
+// EventSource отдает часовые дампы событий в формате GH Archive.
+type EventSource interface {
+	// Name возвращает название источника для логов.
+	Name() string
+	// Open открывает поток событий часа hour: NDJSON, сжатый gzip или нет.
+	// Если дампа нет, возвращается ошибка, оборачивающая ErrHourNotFound.
+	Open(ctx context.Context, hour time.Time) (io.ReadCloser, error)
+}
+
+// NewEventSource создает источник событий согласно конфигурации.
+func NewEventSource(httpClient *http.Client, cfg config.IngestionConfig) (EventSource, error) {
+	switch cfg.Source.Type {
+	case "http", "":
+		return NewHTTPArchiveSource(httpClient, cfg.GHArchiveURL), nil
+	case "dir":
+		return NewDirSource(cfg.Source.Dir), nil
+	default:
+		return nil, fmt.Errorf("unknown event source: %s", cfg.Source.Type)
+	}
+}
+
+// HTTPArchiveSource скачивает часы с GH Archive или его HTTP-зеркала.
+type HTTPArchiveSource struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewHTTPArchiveSource создает новый HTTPArchiveSource.
+func NewHTTPArchiveSource(httpClient *http.Client, baseURL string) *HTTPArchiveSource {
+	return &HTTPArchiveSource{httpClient: httpClient, baseURL: baseURL}
+}
+
+// Name возвращает адрес архива.
+func (s *HTTPArchiveSource) Name() string {
+	return s.baseURL
+}
+
+// Open скачивает дамп часа hour.
+func (s *HTTPArchiveSource) Open(ctx context.Context, hour time.Time) (io.ReadCloser, error) {
+	url := fmt.Sprintf(
+		"%s%s-%02d.json.gz",
+		s.baseURL,
+		hour.Format("2006-01-02"),
+		hour.Hour(),
+	)
+
+	logger.WithFields(logrus.Fields{
+		"url": url,
+	}).Info("downloading")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if err := resp.Body.Close(); err != nil {
+			logger.WithError(err).Warn("failed to close response body")
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrHourNotFound, url)
+		}
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DirSource читает часы из локального каталога с файлами вида
+// YYYY-MM-DD-H.json.gz или YYYY-MM-DD-H.json (час допускается и с ведущим нулем).
+type DirSource struct {
+	dir string
+}
+
+// NewDirSource создает новый DirSource.
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir: dir}
+}
+
+// Name возвращает путь к каталогу.
+func (s *DirSource) Name() string {
+	return s.dir
+}
+
+// Open открывает файл часа hour.
+func (s *DirSource) Open(_ context.Context, hour time.Time) (io.ReadCloser, error) {
+	for _, name := range hourFileNames(hour) {
+		file, err := os.Open(filepath.Join(s.dir, name))
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("opening hour file: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("%w: no file for %s in %s", ErrHourNotFound, hour.Format(HourLayout), s.dir)
+}
+
+// Hours возвращает часы, для которых в каталоге есть файлы, в порядке возрастания.
+func (s *DirSource) Hours() ([]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading source dir: %w", err)
+	}
+
+	seen := make(map[time.Time]struct{}, len(entries))
+	hours := make([]time.Time, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		hour, ok := parseHourFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		if _, dup := seen[hour]; dup {
+			continue
+		}
+		seen[hour] = struct{}{}
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	return hours, nil
+}
+
+// hourFileNames возвращает допустимые имена файла часа в порядке предпочтения.
+func hourFileNames(hour time.Time) []string {
+	day := hour.Format("2006-01-02")
+	var names []string
+	for _, suffix := range []string{".json.gz", ".json"} {
+		names = append(names,
+			fmt.Sprintf("%s-%d%s", day, hour.Hour(), suffix),
+			fmt.Sprintf("%s-%02d%s", day, hour.Hour(), suffix),
+		)
+	}
+	return names
+}
+
+// parseHourFileName разбирает час из имени файла дампа.
+func parseHourFileName(name string) (time.Time, bool) {
+	base, ok := strings.CutSuffix(name, ".json.gz")
+	if !ok {
+		if base, ok = strings.CutSuffix(name, ".json"); !ok {
+			return time.Time{}, false
+		}
+	}
+
+	cut := strings.LastIndexByte(base, '-')
+	if cut < 0 {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006-01-02", base[:cut])
+	if err != nil {
+		return time.Time{}, false
+	}
+	digits := base[cut+1:]
+	hour, err := strconv.Atoi(digits)
+	if err != nil || len(digits) > 2 || hour < 0 || hour > 23 {
+		return time.Time{}, false
+	}
+	return day.Add(time.Duration(hour) * time.Hour), true
+}
@@ -0,0 +1,70 @@
+package ingestion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	files := map[string][]byte{
+		"2024-01-01-10.json.gz": gzipLines(t, starLine("10", day.Add(10*time.Hour))),
+		"2024-01-01-9.json":     []byte(starLine("9", day.Add(9*time.Hour)) + "\n"),
+		"2024-01-01-0.json.gz":  gzipLines(t, starLine("0", day)),
+		"README.md":             []byte("not an hour"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+
+	source := NewDirSource(dir)
+
+	hours, err := source.Hours()
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{day, day.Add(9 * time.Hour), day.Add(10 * time.Hour)}, hours)
+
+	_, err = source.Open(context.Background(), day.Add(time.Hour))
+	require.Error(t, err)
+
+	producer := &fakeProducer{}
+	fetcher := NewGHArchiveFetcher(source, day, producer, nil, nil, nil, config.IngestionConfig{
+		Workers:     1,
+		ChannelSize: 1,
+	})
+	for _, hour := range hours {
+		stats, err := fetcher.ingestHour(context.Background(), hour)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), stats.EventsProduced)
+	}
+	require.Equal(t, []string{"0", "10", "9"}, producer.sortedKeys())
+}
+
+func TestParseHourFileName(t *testing.T) {
+	cases := []struct {
+		name string
+		want time.Time
+		ok   bool
+	}{
+		{name: "2024-03-05-7.json.gz", want: time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC), ok: true},
+		{name: "2024-03-05-07.json", want: time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC), ok: true},
+		{name: "2024-03-05-24.json.gz"},
+		{name: "2024-03-05.json.gz"},
+		{name: "2024-03-05-7.txt"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := parseHourFileName(c.name)
+			require.Equal(t, c.ok, ok)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
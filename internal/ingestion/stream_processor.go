@@ -3,57 +3,221 @@ package ingestion
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/kun1ts4/stars-analytics/internal/domain"
 	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/internal/prometheus"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 )
 
-func (f *GHArchiveFetcher) processStream(gzStream io.Reader) error {
-	events := make(chan dto.GHEvent, f.config.ChannelSize)
+// ErrSendFailed означает, что часть событий часа не удалось отправить в Kafka.
+// Смещение часа не продвигается дальше первой неотправленной строки, поэтому
+// повторная попытка отправляет их заново.
+var ErrSendFailed = errors.New("failed to send events")
 
+// lineEvent представляет событие вместе с номером строки дампа, из которой оно прочитано.
+type lineEvent struct {
+	line  int64
+	event dto.GHEvent
+}
+
+// processStream разбирает поток событий часа, пропуская первые skip строк, публикует
+// события и заполняет счетчики stats. Обработанные строки отмечаются в tracker.
+func (f *GHArchiveFetcher) processStream(
+	ctx context.Context,
+	stream io.Reader,
+	skip int64,
+	tracker *lineTracker,
+	stats *domain.HourStats,
+) error {
+	events := make(chan lineEvent, f.config.ChannelSize)
+
+	done := make(chan PublishStats, 1)
+	go func() {
+		done <- publishEvents(ctx, f.producer, f.filter, f.config.Workers, events, tracker)
+	}()
+
+	opts := scanOptions{maxLine: f.config.MaxLineKB << 10, decoders: f.config.DecodeWorkers}
+	parsed, err := scanLines(ctx, stream, skip, opts, func(line int64, event dto.GHEvent, err error) error {
+		if err != nil {
+			tracker.markDone(line)
+			return nil
+		}
+		select {
+		case events <- lineEvent{line: line, event: event}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(events)
+	published := <-done
+
+	stats.LinesParsed = parsed.Lines
+	stats.ParseFailures = parsed.Failures
+	stats.OversizedLines = parsed.Oversized
+	stats.Truncated = parsed.Truncated
+	stats.EventsProduced = published.Produced
+	stats.SendFailures = published.SendFailures
+	stats.FilteredEvents = published.Filtered
+	if err == nil {
+		// Отмена во время отправки оставляет час незавершенным, даже если поток прочитан целиком
+		err = ctx.Err()
+	}
+	if err == nil && published.SendFailures > 0 {
+		err = fmt.Errorf("%w: %d events", ErrSendFailed, published.SendFailures)
+	}
+	return err
+}
+
+// PublishStats считает результаты публикации событий.
+type PublishStats struct {
+	Produced     int64
+	SendFailures int64
+	// Filtered считает события, отброшенные правилами фильтра.
+	Filtered int64
+}
+
+// publishCounters накапливает PublishStats из нескольких горутин.
+type publishCounters struct {
+	produced, sendFailures, filtered atomic.Int64
+}
+
+func (c *publishCounters) stats() PublishStats {
+	return PublishStats{
+		Produced:     c.produced.Load(),
+		SendFailures: c.sendFailures.Load(),
+		Filtered:     c.filtered.Load(),
+	}
+}
+
+// publishEvents конвертирует события из канала и отправляет их в Kafka в workers
+// горутинах, пока канал не будет закрыт. Неучитываемые события и события,
+// отброшенные filter, пропускаются. Строки обработанных событий отмечаются в
+// tracker, если он задан; событие, которое не удалось отправить, не отмечается
+// и будет прочитано повторно.
+func publishEvents(
+	ctx context.Context,
+	producer KafkaProducer,
+	filter *EventFilter,
+	workers int,
+	events <-chan lineEvent,
+	tracker *lineTracker,
+) PublishStats {
+	counters := &publishCounters{}
 	var wg sync.WaitGroup
-	for i := 0; i < f.config.Workers; i++ {
+	for i := 0; i < max(workers, 1); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for event := range events {
-				if event.Type == "WatchEvent" && event.Payload.Action == "started" {
-					if err := event.Validate(); err != nil {
-						logger.WithError(err).WithFields(logrus.Fields{
-							"event_id": event.ID,
-						}).Warn("invalid event")
-						continue
-					}
-					kafkaMessage, err := dto.ToKafkaEvent(event)
-					if err != nil {
-						logger.WithError(err).WithFields(logrus.Fields{
-							"event_id": event.ID,
-						}).Warn("failed to convert event to kafka message")
-						continue
-					}
-					data, err := json.Marshal(kafkaMessage)
-					if err != nil {
-						logger.WithError(err).WithFields(logrus.Fields{
-							"event_id": event.ID,
-						}).Warn("failed to marshal event")
-						continue
-					}
-					if err := f.producer.Send(context.Background(), event.ID, data); err != nil {
-						logger.WithError(err).WithFields(logrus.Fields{
-							"event_id": event.ID,
-						}).Warn("failed to send event to kafka")
-					}
+			for item := range events {
+				if publishEvent(ctx, producer, filter, item.event, counters) {
+					tracker.markDone(item.line)
 				}
 			}
 		}()
 	}
-
-	err := ParseStream(gzStream, events)
-	close(events)
 	wg.Wait()
-	return err
+
+	return counters.stats()
+}
+
+// publishEvent отправляет одно событие и возвращает true, если оно обработано
+// окончательно: опубликовано или пропущено. Неудачная отправка возвращает false.
+func publishEvent(
+	ctx context.Context,
+	producer KafkaProducer,
+	filter *EventFilter,
+	event dto.GHEvent,
+	counters *publishCounters,
+) bool {
+	kafkaMessage, err := dto.ToKafkaEvent(event)
+	if errors.Is(err, dto.ErrUnsupportedEvent) {
+		return true
+	}
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"event_id": event.ID,
+		}).Warn("failed to convert event to kafka message")
+		return true
+	}
+	if err := event.Validate(); err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"event_id": event.ID,
+		}).Warn("invalid event")
+		return true
+	}
+	if rule, ok := filter.Check(event); !ok {
+		counters.filtered.Add(1)
+		prometheus.IngestionFiltered.WithLabelValues(rule).Inc()
+		return true
+	}
+	data, err := json.Marshal(kafkaMessage)
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"event_id": event.ID,
+		}).Warn("failed to marshal event")
+		return true
+	}
+	if err := producer.Send(ctx, event.ID, data); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		counters.sendFailures.Add(1)
+		logger.WithError(err).WithFields(logrus.Fields{
+			"event_id": event.ID,
+		}).Warn("failed to send event to kafka")
+		return false
+	}
+	counters.produced.Add(1)
+	return true
+}
+
+// lineTracker отслеживает обработанные строки дампа и вычисляет смещение, до
+// которого все строки обработаны. Nil-трекер ничего не отслеживает.
+type lineTracker struct {
+	mu   sync.Mutex
+	next int64
+	done map[int64]struct{}
+}
+
+// newLineTracker создает lineTracker, считающий первые offset строк обработанными.
+func newLineTracker(offset int64) *lineTracker {
+	return &lineTracker{next: offset, done: make(map[int64]struct{})}
+}
+
+// markDone отмечает строку line обработанной.
+func (t *lineTracker) markDone(line int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if line != t.next {
+		t.done[line] = struct{}{}
+		return
+	}
+	t.next++
+	for {
+		if _, ok := t.done[t.next]; !ok {
+			return
+		}
+		delete(t.done, t.next)
+		t.next++
+	}
+}
+
+// offset возвращает число строк от начала дампа, обработанных без пропусков.
+func (t *lineTracker) offset() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
 }
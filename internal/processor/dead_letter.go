@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// deadLetterSource является значением поля Source для сообщений processor.
+const deadLetterSource = "processor"
+
+// decodedEvent связывает доменное событие с исходным сообщением Kafka.
+type decodedEvent struct {
+	msg   kafka.Message
+	event domain.Event
+}
+
+// domainEvents возвращает доменные события пачки.
+func domainEvents(events []decodedEvent) []domain.Event {
+	batch := make([]domain.Event, len(events))
+	for i, event := range events {
+		batch[i] = event.event
+	}
+	return batch
+}
+
+// decodeBatch декодирует сообщения пачки. Некорректные сообщения уходят в
+// dead-letter топик, а без него пропускаются. Ошибка возвращается только при
+// отмене контекста.
+func (p *Processor) decodeBatch(ctx context.Context, msgs []kafka.Message) ([]decodedEvent, error) {
+	events := make([]decodedEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaEvent := dto.KafkaEvent{}
+		if err := json.Unmarshal(msg.Value, &kafkaEvent); err != nil {
+			logger.WithError(err).WithFields(messageFields(msg)).Error("error unmarshalling message")
+			if err := p.deadLetter(ctx, msg, dto.DeadLetterDecode, err, 1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		events = append(events, decodedEvent{msg: msg, event: kafkaEvent.ToDomain()})
+	}
+	return events, nil
+}
+
+// isolateFailures записывает события по одному и отправляет в dead-letter
+// топик те, которые учесть не удалось.
+func (p *Processor) isolateFailures(ctx context.Context, events []decodedEvent, attempts int) error {
+	for _, event := range events {
+		err := p.ProcessEvents([]domain.Event{event.event})
+		if err == nil {
+			continue
+		}
+		if err := p.deadLetter(ctx, event.msg, dto.DeadLetterProcess, err, attempts+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadLetter отправляет сообщение в dead-letter топик, повторяя отправку до
+// успеха. Без dead-letter топика сообщение только логируется. Ошибка
+// возвращается только при отмене контекста.
+func (p *Processor) deadLetter(
+	ctx context.Context,
+	msg kafka.Message,
+	errorType dto.DeadLetterErrorType,
+	cause error,
+	attempts int,
+) error {
+	if p.DeadLetters == nil {
+		return nil
+	}
+
+	letter, err := json.Marshal(dto.DeadLetter{
+		Payload:   msg.Value,
+		Key:       string(msg.Key),
+		ErrorType: errorType,
+		Error:     cause.Error(),
+		Source:    deadLetterSource,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Attempts:  attempts,
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling dead letter: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := p.DeadLetters.Send(ctx, string(msg.Key), letter)
+		if err == nil {
+			logger.WithError(cause).WithFields(messageFields(msg)).
+				WithField("error_type", errorType).Warn("message routed to dead-letter topic")
+			return nil
+		}
+		logger.WithError(err).WithFields(messageFields(msg)).Error("error sending to dead-letter topic")
+
+		if err := backoff.Sleep(ctx, p.retryDelay(attempt)); err != nil {
+			return err
+		}
+	}
+}
@@ -3,73 +3,335 @@ package processor
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/antispam"
 	"github.com/kun1ts4/stars-analytics/internal/domain"
-	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
 	"github.com/kun1ts4/stars-analytics/pkg/logger"
 )
 
 // KafkaConsumer определяет интерфейс для потребителя Kafka.
 type KafkaConsumer interface {
-	Read(ctx context.Context) ([]byte, error)
+	Fetch(ctx context.Context) (kafka.Message, error)
+	Commit(ctx context.Context, msgs ...kafka.Message) error
 	Close() error
 }
 
+// KafkaProducer определяет интерфейс для производителя dead-letter топика.
+type KafkaProducer interface {
+	Send(ctx context.Context, key string, value []byte) error
+}
+
+const (
+	// pruneInterval задает период очистки записей дедупликации и событий звезд.
+	pruneInterval = time.Hour
+	// retryDelay задает паузу перед повторной обработкой пачки, если Backoff не задан.
+	retryDelay = time.Second
+	// shutdownFlushTimeout ограничивает фиксацию смещений последней пачки при остановке.
+	shutdownFlushTimeout = 10 * time.Second
+)
+
 // Processor обрабатывает события.
 type Processor struct {
 	Consumer  KafkaConsumer
 	StatsRepo domain.StatsRepo
+	// DedupRetention задает, сколько хранятся ID учтенных событий после их
+	// создания и учета; нулевое значение отключает очистку.
+	DedupRetention time.Duration
+	// StarEventRetention задает, сколько хранятся события звезд;
+	// нулевое значение отключает удаление.
+	StarEventRetention time.Duration
+	// BatchSize задает максимальный размер пачки; по умолчанию 1.
+	BatchSize int
+	// FlushInterval задает максимальное время накопления пачки.
+	FlushInterval time.Duration
+	// DeadLetters получает сообщения, которые не удалось декодировать или учесть
+	// за MaxAttempts попыток; nil означает бесконечные повторы без dead-letter топика.
+	DeadLetters KafkaProducer
+	// MaxAttempts задает число попыток записи пачки перед dead-letter.
+	MaxAttempts int
+	// Backoff задает задержки между попытками.
+	Backoff backoff.Backoff
+	// Detector помечает накрученные звезды; nil отключает проверку.
+	Detector *antispam.Detector
 }
 
-// Run запускает обработку событий.
+// Run запускает обработку событий. Сообщения копятся в пачку, которая
+// записывается при достижении BatchSize или по истечении FlushInterval.
+// Смещения фиксируются только после успешной записи пачки.
 func (p *Processor) Run(ctx context.Context) error {
+	if p.DedupRetention > 0 || p.StarEventRetention > 0 {
+		go p.runPruner(ctx)
+	}
+
+	batchSize := max(p.BatchSize, 1)
+	batch := make([]kafka.Message, 0, batchSize)
+	var deadline time.Time
+	fetchFailures := 0
+
 	for {
-		select {
-		case <-ctx.Done():
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-
-			done := make(chan struct{})
-			go func() {
-				if err := p.Consumer.Close(); err != nil {
-					logger.WithError(err).Error("error closing consumer")
-				}
-				close(done)
-			}()
-
-			select {
-			case <-done:
-				logger.Info("consumer closed successfully")
-			case <-shutdownCtx.Done():
-				logger.Warn("consumer close timeout exceeded")
-			}
+		if ctx.Err() != nil {
+			p.flushOnShutdown(batch)
+			return p.shutdown(ctx)
+		}
 
-			return ctx.Err()
-		default:
-			msg, err := p.Consumer.Read(ctx)
-			if err != nil {
-				logger.WithError(err).Error("error reading message")
+		if len(batch) >= batchSize || (len(batch) > 0 && !time.Now().Before(deadline)) {
+			if err := p.flush(ctx, batch); err != nil {
+				// Контекст отменен до успешной записи: пачка будет дописана
+				// при остановке или прочитана повторно после перезапуска.
 				continue
 			}
-			kafkaEvent := dto.KafkaEvent{}
-			err = json.Unmarshal(msg, &kafkaEvent)
-			if err != nil {
-				logger.WithError(err).Error("error unmarshalling message")
-				continue
+			batch = batch[:0]
+		}
+
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(batch) > 0 {
+			fetchCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		msg, err := p.Consumer.Fetch(fetchCtx)
+		cancel()
+		if err != nil {
+			if fetchCtx.Err() == nil {
+				// Брокер недоступен: следующая попытка откладывается, чтобы не
+				// крутить цикл и не засыпать лог ошибками.
+				fetchFailures++
+				logger.WithError(err).WithField("attempt", fetchFailures).Error("error reading message")
+				_ = backoff.Sleep(ctx, p.retryDelay(fetchFailures))
 			}
-			event := kafkaEvent.ToDomain()
-			err = p.ProcessEvent(event)
-			if err != nil {
-				logger.WithError(err).Error("error processing event")
-				continue
+			continue
+		}
+		fetchFailures = 0
+
+		if len(batch) == 0 {
+			deadline = time.Now().Add(p.FlushInterval)
+		}
+		batch = append(batch, msg)
+	}
+}
+
+// flush записывает пачку и фиксирует смещения. Ошибка возвращается только
+// при отмене контекста, в этом случае смещения не фиксируются.
+func (p *Processor) flush(ctx context.Context, msgs []kafka.Message) error {
+	events, err := p.decodeBatch(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	if err := p.processWithRetry(ctx, events); err != nil {
+		return err
+	}
+
+	if err := p.Consumer.Commit(ctx, msgs...); err != nil {
+		logger.WithError(err).WithField("batch_size", len(msgs)).Error("error committing offsets")
+	}
+	return nil
+}
+
+// processWithRetry записывает события, повторяя запись с задержкой. После
+// MaxAttempts неудач события записываются по одному, а не учтенные уходят
+// в dead-letter топик.
+func (p *Processor) processWithRetry(ctx context.Context, events []decodedEvent) error {
+	batch := domainEvents(events)
+	var verdict antispam.Verdict
+	analyzed := false
+
+	for attempt := 1; ; attempt++ {
+		var err error
+		if !analyzed {
+			verdict, err = p.analyze(events, batch)
+			analyzed = err == nil
+		}
+		if err == nil {
+			err = p.ProcessEvents(batch)
+		}
+		if err == nil {
+			p.saveSpamFlags(verdict)
+			return nil
+		}
+		logger.WithError(err).WithFields(logrus.Fields{
+			"batch_size": len(batch),
+			"attempt":    attempt,
+		}).Error("error processing batch")
+
+		if p.DeadLetters != nil && attempt >= p.MaxAttempts {
+			if err := p.isolateFailures(ctx, events, attempt); err != nil {
+				return err
 			}
+			p.saveSpamFlags(verdict)
+			return nil
+		}
+		if err := backoff.Sleep(ctx, p.retryDelay(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// analyze проверяет пачку на накрутку звезд один раз до записи, чтобы повторные
+// попытки не сдвигали окна детектора. Детектор видит только еще не учтенные события:
+// повторно доставленные звезды не должны влиять на флаги. Флаги проставляются в batch
+// и копируются в events для записи по одному.
+func (p *Processor) analyze(events []decodedEvent, batch []domain.Event) (antispam.Verdict, error) {
+	if p.Detector == nil {
+		return antispam.Verdict{}, nil
+	}
+	fresh, err := p.StatsRepo.FreshEvents(batch)
+	if err != nil {
+		return antispam.Verdict{}, err
+	}
+	verdict := p.Detector.Analyze(fresh)
+
+	flagged := make(map[string]bool)
+	for _, event := range fresh {
+		if event.Flagged {
+			flagged[event.ID] = true
+		}
+	}
+	for i := range batch {
+		batch[i].Flagged = flagged[batch[i].ID]
+		events[i].event.Flagged = batch[i].Flagged
+	}
+	return verdict, nil
+}
+
+// saveSpamFlags сохраняет звезды, помеченные задним числом, и подозрительные аккаунты.
+// Ошибка не повторяется: флаги влияют только на топ со снижением веса звезд.
+func (p *Processor) saveSpamFlags(verdict antispam.Verdict) {
+	if verdict.Empty() {
+		return
+	}
+	if err := p.StatsRepo.SaveSpamFlags(verdict.Stars, verdict.Actors); err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"stars":  len(verdict.Stars),
+			"actors": len(verdict.Actors),
+		}).Warn("failed to save spam flags")
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"stars":  len(verdict.Stars),
+		"actors": len(verdict.Actors),
+	}).Info("saved spam flags")
+}
+
+// retryDelay возвращает задержку после неудачной попытки attempt.
+func (p *Processor) retryDelay(attempt int) time.Duration {
+	if p.Backoff.Initial <= 0 {
+		return retryDelay
+	}
+	return p.Backoff.Delay(attempt)
+}
+
+// flushOnShutdown делает одну попытку записать накопленную пачку при остановке.
+func (p *Processor) flushOnShutdown(batch []kafka.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+
+	events, err := p.decodeBatch(ctx, batch)
+	var verdict antispam.Verdict
+	if err == nil {
+		decoded := domainEvents(events)
+		if verdict, err = p.analyze(events, decoded); err == nil {
+			err = p.ProcessEvents(decoded)
+		}
+	}
+	if err != nil {
+		logger.WithError(err).WithField("batch_size", len(batch)).
+			Warn("failed to flush batch on shutdown, it will be reprocessed")
+		return
+	}
+	p.saveSpamFlags(verdict)
+	if err := p.Consumer.Commit(ctx, batch...); err != nil {
+		logger.WithError(err).WithField("batch_size", len(batch)).Error("error committing offsets")
+	}
+}
+
+// shutdown закрывает потребителя с ограничением по времени.
+func (p *Processor) shutdown(ctx context.Context) error {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		if err := p.Consumer.Close(); err != nil {
+			logger.WithError(err).Error("error closing consumer")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("consumer closed successfully")
+	case <-shutdownCtx.Done():
+		logger.Warn("consumer close timeout exceeded")
+	}
+
+	return ctx.Err()
+}
+
+// ProcessEvents учитывает пачку событий. Повторно полученные события пропускаются.
+func (p *Processor) ProcessEvents(events []domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	counted, err := p.StatsRepo.UpdateCountsBatch(events)
+	if err != nil {
+		return err
+	}
+	if skipped := len(events) - counted; skipped > 0 {
+		logger.WithField("skipped", skipped).Debug("skipping duplicate events")
+	}
+	return nil
+}
+
+// runPruner периодически удаляет устаревшие записи дедупликации и события звезд.
+func (p *Processor) runPruner(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.prune(time.Now().UTC())
 		}
 	}
 }
 
-// ProcessEvent обрабатывает отдельное событие.
-func (p *Processor) ProcessEvent(event domain.Event) error {
-	return p.StatsRepo.UpdateCounts(event)
+// prune удаляет данные, устаревшие к моменту now.
+func (p *Processor) prune(now time.Time) {
+	if p.DedupRetention > 0 {
+		deleted, err := p.StatsRepo.PruneProcessedEvents(now.Add(-p.DedupRetention))
+		if err != nil {
+			logger.WithError(err).Warn("failed to prune processed events")
+		} else {
+			logger.WithField("deleted", deleted).Info("pruned processed events")
+		}
+	}
+
+	if p.StarEventRetention > 0 {
+		dropped, err := p.StatsRepo.PruneStarEvents(now.Add(-p.StarEventRetention))
+		if err != nil {
+			logger.WithError(err).Warn("failed to prune star events")
+		} else if dropped > 0 {
+			logger.WithField("partitions", dropped).Info("pruned star events")
+		}
+	}
+}
+
+// messageFields возвращает поля лога с метаданными сообщения.
+func messageFields(msg kafka.Message) logrus.Fields {
+	return logrus.Fields{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+		"key":       string(msg.Key),
+	}
 }
@@ -0,0 +1,344 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/antispam"
+	"github.com/kun1ts4/stars-analytics/internal/config"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/backoff"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsumer отдает сообщения из очереди и отменяет контекст, когда очередь пуста.
+type fakeConsumer struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []int64
+	cancel    context.CancelFunc
+}
+
+func (c *fakeConsumer) Fetch(ctx context.Context) (kafka.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.messages) == 0 {
+		c.cancel()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := c.messages[0]
+	c.messages = c.messages[1:]
+	return msg, nil
+}
+
+func (c *fakeConsumer) Commit(_ context.Context, msgs ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range msgs {
+		c.committed = append(c.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (c *fakeConsumer) Close() error { return nil }
+
+// blockingConsumer отдает сообщения из очереди, а затем блокируется до отмены контекста.
+type blockingConsumer struct {
+	fakeConsumer
+}
+
+func (c *blockingConsumer) Fetch(ctx context.Context) (kafka.Message, error) {
+	c.mu.Lock()
+	if len(c.messages) > 0 {
+		msg := c.messages[0]
+		c.messages = c.messages[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+// fakeRepo реализует только запись событий и флагов из domain.StatsRepo.
+type fakeRepo struct {
+	domain.StatsRepo
+	errs      map[string]error
+	processed map[string]bool
+	batches   [][]string
+	// flagged и spamStars содержат ID звезд, помеченных при учете и задним числом.
+	flagged   []string
+	spamStars []string
+}
+
+func (r *fakeRepo) FreshEvents(events []domain.Event) ([]domain.Event, error) {
+	var fresh []domain.Event
+	for _, event := range events {
+		if !r.processed[event.ID] {
+			fresh = append(fresh, event)
+		}
+	}
+	return fresh, nil
+}
+
+func (r *fakeRepo) SaveSpamFlags(stars []domain.StarFlag, _ []domain.ActorFlag) error {
+	for _, flag := range stars {
+		r.spamStars = append(r.spamStars, flag.EventIDs...)
+	}
+	return nil
+}
+
+func (r *fakeRepo) UpdateCountsBatch(events []domain.Event) (int, error) {
+	var ids []string
+	for _, event := range events {
+		if err, ok := r.errs[event.ID]; ok {
+			return 0, err
+		}
+		ids = append(ids, event.ID)
+	}
+
+	counted := 0
+	for _, event := range events {
+		if !r.processed[event.ID] {
+			r.processed[event.ID] = true
+			counted++
+			if event.Flagged {
+				r.flagged = append(r.flagged, event.ID)
+			}
+		}
+	}
+	r.batches = append(r.batches, ids)
+	return counted, nil
+}
+
+func eventMessage(t *testing.T, offset int64, id string) kafka.Message {
+	return starMessage(t, offset, id, 1)
+}
+
+func starMessage(t *testing.T, offset int64, id string, repoID int64) kafka.Message {
+	value, err := json.Marshal(dto.KafkaEvent{
+		EventID:   id,
+		Action:    domain.ActionStarred,
+		RepoID:    repoID,
+		RepoName:  fmt.Sprintf("test/repo%d", repoID),
+		UserLogin: "user",
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	return kafka.Message{Topic: "events", Offset: offset, Key: []byte(id), Value: value}
+}
+
+func TestRun_CommitsProcessedBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &fakeConsumer{
+		messages: []kafka.Message{
+			eventMessage(t, 1, "a"),
+			{Topic: "events", Offset: 2, Value: []byte("not json")},
+			eventMessage(t, 3, "dup"),
+			eventMessage(t, 4, "b"),
+			eventMessage(t, 5, "c"),
+		},
+		cancel: cancel,
+	}
+	repo := &fakeRepo{processed: map[string]bool{"dup": true}}
+	proc := Processor{Consumer: consumer, StatsRepo: repo, BatchSize: 3, FlushInterval: time.Minute}
+
+	err := proc.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Первая пачка записана по размеру, остаток дописан при остановке
+	require.Equal(t, [][]string{{"a", "dup"}, {"b", "c"}}, repo.batches)
+	require.Equal(t, []int64{1, 2, 3, 4, 5}, consumer.committed)
+}
+
+func TestRun_FlagsOnlyFreshStars(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &fakeConsumer{
+		messages: []kafka.Message{
+			starMessage(t, 1, "dup", 1),
+			starMessage(t, 2, "b", 2),
+			starMessage(t, 3, "c", 3),
+		},
+		cancel: cancel,
+	}
+	repo := &fakeRepo{processed: map[string]bool{"dup": true}}
+	proc := Processor{
+		Consumer:      consumer,
+		StatsRepo:     repo,
+		BatchSize:     2,
+		FlushInterval: time.Minute,
+		Detector:      antispam.NewDetector(config.AntispamConfig{ActorWindowMinutes: 10, ActorBurstStars: 2}),
+	}
+
+	err := proc.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Повторно доставленная звезда не попадает в детектор, поэтому первая
+	// пачка не помечается; b помечается задним числом вместе с c.
+	require.Equal(t, []string{"c"}, repo.flagged)
+	require.Equal(t, []string{"b"}, repo.spamStars)
+}
+
+func TestRun_FlushesByInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &blockingConsumer{fakeConsumer{messages: []kafka.Message{eventMessage(t, 1, "a")}}}
+	repo := &fakeRepo{processed: map[string]bool{}}
+	proc := Processor{Consumer: consumer, StatsRepo: repo, BatchSize: 100, FlushInterval: 20 * time.Millisecond}
+
+	done := make(chan error)
+	go func() { done <- proc.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		consumer.mu.Lock()
+		defer consumer.mu.Unlock()
+		return len(consumer.committed) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Equal(t, [][]string{{"a"}}, repo.batches)
+}
+
+func TestRun_DoesNotCommitFailedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &fakeConsumer{
+		messages: []kafka.Message{eventMessage(t, 1, "a"), eventMessage(t, 2, "broken")},
+		cancel:   cancel,
+	}
+	repo := &fakeRepo{processed: map[string]bool{}, errs: map[string]error{"broken": errors.New("db is down")}}
+	proc := Processor{Consumer: consumer, StatsRepo: repo, BatchSize: 1}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	err := proc.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Equal(t, []int64{1}, consumer.committed)
+}
+
+// failingConsumer возвращает ошибку чтения, пока не исчерпает failures.
+type failingConsumer struct {
+	fakeConsumer
+	failures int
+	fetches  []time.Time
+}
+
+func (c *failingConsumer) Fetch(ctx context.Context) (kafka.Message, error) {
+	c.mu.Lock()
+	c.fetches = append(c.fetches, time.Now())
+	if c.failures > 0 {
+		c.failures--
+		c.mu.Unlock()
+		return kafka.Message{}, errors.New("broker is down")
+	}
+	c.mu.Unlock()
+	return c.fakeConsumer.Fetch(ctx)
+}
+
+func TestRun_BacksOffOnFetchErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &failingConsumer{
+		fakeConsumer: fakeConsumer{messages: []kafka.Message{eventMessage(t, 1, "a")}, cancel: cancel},
+		failures:     3,
+	}
+	repo := &fakeRepo{processed: map[string]bool{}}
+	proc := Processor{
+		Consumer:  consumer,
+		StatsRepo: repo,
+		BatchSize: 1,
+		Backoff:   backoff.Backoff{Initial: 20 * time.Millisecond, Max: 20 * time.Millisecond},
+	}
+
+	err := proc.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Каждая повторная попытка чтения ждет задержку, после чего сообщение обрабатывается
+	require.Len(t, consumer.fetches, 5)
+	for i := 1; i <= 3; i++ {
+		require.GreaterOrEqual(t, consumer.fetches[i].Sub(consumer.fetches[i-1]), 10*time.Millisecond)
+	}
+	require.Equal(t, []int64{1}, consumer.committed)
+}
+
+// fakeDeadLetters запоминает отправленные в dead-letter топик сообщения.
+type fakeDeadLetters struct {
+	letters []dto.DeadLetter
+}
+
+func (d *fakeDeadLetters) Send(_ context.Context, _ string, value []byte) error {
+	var letter dto.DeadLetter
+	if err := json.Unmarshal(value, &letter); err != nil {
+		return err
+	}
+	d.letters = append(d.letters, letter)
+	return nil
+}
+
+func TestRun_RoutesFailuresToDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer := &fakeConsumer{
+		messages: []kafka.Message{
+			eventMessage(t, 1, "a"),
+			{Topic: "events", Partition: 2, Offset: 2, Key: []byte("x"), Value: []byte("not json")},
+			eventMessage(t, 3, "broken"),
+			eventMessage(t, 4, "b"),
+		},
+		cancel: cancel,
+	}
+	repo := &fakeRepo{processed: map[string]bool{}, errs: map[string]error{"broken": errors.New("constraint violation")}}
+	deadLetters := &fakeDeadLetters{}
+	proc := Processor{
+		Consumer:      consumer,
+		StatsRepo:     repo,
+		BatchSize:     4,
+		FlushInterval: time.Minute,
+		DeadLetters:   deadLetters,
+		MaxAttempts:   2,
+		Backoff:       backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+	}
+
+	err := proc.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Пачка целиком не записалась, поэтому события учтены по одному
+	require.Equal(t, [][]string{{"a"}, {"b"}}, repo.batches)
+	require.Equal(t, []int64{1, 2, 3, 4}, consumer.committed)
+
+	require.Len(t, deadLetters.letters, 2)
+
+	decode := deadLetters.letters[0]
+	require.Equal(t, dto.DeadLetterDecode, decode.ErrorType)
+	require.Equal(t, []byte("not json"), decode.Payload)
+	require.Equal(t, 2, decode.Partition)
+	require.Equal(t, int64(2), decode.Offset)
+	require.Equal(t, 1, decode.Attempts)
+
+	process := deadLetters.letters[1]
+	require.Equal(t, dto.DeadLetterProcess, process.ErrorType)
+	require.Equal(t, "constraint violation", process.Error)
+	require.Equal(t, "broken", process.Key)
+	require.Equal(t, int64(3), process.Offset)
+	require.Equal(t, 3, process.Attempts)
+}
@@ -75,6 +75,15 @@ var ExternalErrors = prometheus.NewCounterVec(
 	[]string{"service", "method", "code"},
 )
 
+// IngestionFiltered is the total number of events dropped by ingestion filter rules.
+var IngestionFiltered = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "app_ingestion_filtered_events_total",
+		Help: "Total events dropped by ingestion filter rules",
+	},
+	[]string{"rule"},
+)
+
 // Init registers prometheus with the default Prometheus registry.
 func Init() {
 	prometheus.MustRegister(
@@ -88,6 +97,11 @@ func Init() {
 	)
 }
 
+// InitIngestion registers the ingestion metrics with the default Prometheus registry.
+func InitIngestion() {
+	prometheus.MustRegister(IngestionFiltered)
+}
+
 // RegisterDBStats registers SQL connection pool prometheus.
 func RegisterDBStats(db *sql.DB) {
 	prometheus.MustRegister(prometheus.NewGaugeFunc(
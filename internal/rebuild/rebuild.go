@@ -0,0 +1,156 @@
+// Package rebuild пересчитывает агрегаты диапазона часов из сохраненных
+// событий или повторно прочитанных часов архива.
+package rebuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/antispam"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnsettledRange означает, что замена запрошена для часов, события которых
+// processor еще может учитывать: учтенное между копированием и заменой потерялось бы.
+var ErrUnsettledRange = errors.New("range includes hours the processor may still be writing")
+
+// Source отдает события диапазона для пересчета.
+type Source interface {
+	// Metrics возвращает метрики, события которых отдает источник; остальные
+	// метрики диапазона сохраняют текущие значения.
+	Metrics() []domain.Metric
+	// Read передает события диапазона window в handle пачками по возрастанию времени.
+	Read(ctx context.Context, window domain.TimeRange, handle func([]domain.Event) error) error
+}
+
+// Store хранит пересчитываемые агрегаты отдельно от текущих до замены.
+type Store interface {
+	Prepare(ctx context.Context, window domain.TimeRange, metrics []domain.Metric) error
+	Add(ctx context.Context, events []domain.Event, flags []domain.StarFlag) error
+	Diff(ctx context.Context, window domain.TimeRange) ([]domain.RepoDiff, error)
+	Swap(ctx context.Context, window domain.TimeRange) ([]domain.RepoDiff, error)
+	Discard(ctx context.Context) error
+}
+
+// Report содержит итоги пересчета.
+type Report struct {
+	Window domain.TimeRange
+	// Events содержит число учтенных событий.
+	Events int
+	// Duplicates содержит число отброшенных повторов ID.
+	Duplicates int
+	// Outside содержит число событий источника вне диапазона.
+	Outside int
+	// Diffs содержит репозитории, агрегаты которых изменились.
+	Diffs []domain.RepoDiff
+	// Applied сообщает, что пересчитанные агрегаты заменили текущие.
+	Applied bool
+}
+
+// Rebuilder пересчитывает агрегаты диапазона и сравнивает или заменяет ими текущие.
+type Rebuilder struct {
+	source   Source
+	store    Store
+	detector *antispam.Detector
+	lag      time.Duration
+}
+
+// NewRebuilder создает новый Rebuilder. Если задан detector, звезды заново
+// проверяются на накрутку; иначе сохраняются флаги событий источника.
+// lag задает, сколько после конца часа processor еще учитывает его события.
+func NewRebuilder(source Source, store Store, detector *antispam.Detector, lag time.Duration) *Rebuilder {
+	return &Rebuilder{source: source, store: store, detector: detector, lag: lag}
+}
+
+// Run пересчитывает агрегаты часов, пересекающих window. Без apply текущие
+// данные не меняются, а отчет содержит только разницу. Замена часов, которые
+// закончились меньше lag назад, отклоняется с ErrUnsettledRange.
+func (r *Rebuilder) Run(ctx context.Context, window domain.TimeRange, apply bool) (report Report, err error) {
+	window = window.Align(domain.GranularityHour)
+	report.Window = window
+
+	// Теневые таблицы копируют текущие агрегаты до чтения источника, а замена
+	// происходит после: события, учтенные между ними, потерялись бы.
+	if settled := time.Now().Add(-r.lag); apply && window.To.After(settled) {
+		return report, fmt.Errorf("%w: rebuild hours before %s",
+			ErrUnsettledRange, settled.UTC().Truncate(time.Hour).Format(time.RFC3339))
+	}
+
+	if err := r.store.Prepare(ctx, window, r.source.Metrics()); err != nil {
+		return report, err
+	}
+	swapped := false
+	defer func() {
+		if swapped {
+			return
+		}
+		// Теневые таблицы удаляются и при отмене ctx.
+		if discardErr := r.store.Discard(context.WithoutCancel(ctx)); discardErr != nil {
+			logger.WithError(discardErr).Warn("failed to discard rebuild tables")
+		}
+	}()
+
+	seen := make(map[string]struct{})
+	err = r.source.Read(ctx, window, func(batch []domain.Event) error {
+		events := make([]domain.Event, 0, len(batch))
+		for _, event := range batch {
+			if event.CreatedAt.Before(window.From) || !event.CreatedAt.Before(window.To) {
+				report.Outside++
+				continue
+			}
+			if _, ok := seen[event.ID]; ok {
+				report.Duplicates++
+				continue
+			}
+			seen[event.ID] = struct{}{}
+			events = append(events, event)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		verdict := r.detector.Analyze(events)
+		if err := r.store.Add(ctx, events, verdict.Stars); err != nil {
+			return err
+		}
+		report.Events += len(events)
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("reading events: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"events":     report.Events,
+		"duplicates": report.Duplicates,
+		"outside":    report.Outside,
+	}).Info("rebuilt aggregates")
+
+	if !apply {
+		report.Diffs, err = r.store.Diff(ctx, window)
+		return report, err
+	}
+
+	report.Diffs, err = r.store.Swap(ctx, window)
+	if err != nil {
+		return report, err
+	}
+	swapped = true
+	report.Applied = true
+	return report, nil
+}
+
+// sortByTime упорядочивает события по времени и ID, чтобы детектор видел их по порядку.
+func sortByTime(events []domain.Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.Before(events[j].CreatedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+}
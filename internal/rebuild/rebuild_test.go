@@ -0,0 +1,216 @@
+package rebuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/ingestion"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	batches [][]domain.Event
+	err     error
+}
+
+func (s *fakeSource) Metrics() []domain.Metric {
+	return []domain.Metric{domain.MetricStars}
+}
+
+func (s *fakeSource) Read(_ context.Context, _ domain.TimeRange, handle func([]domain.Event) error) error {
+	for _, batch := range s.batches {
+		if err := handle(batch); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+type fakeStore struct {
+	prepared domain.TimeRange
+	metrics  []domain.Metric
+	added    []domain.Event
+	diffs    []domain.RepoDiff
+	calls    []string
+}
+
+func (s *fakeStore) Prepare(_ context.Context, window domain.TimeRange, metrics []domain.Metric) error {
+	s.prepared, s.metrics = window, metrics
+	s.calls = append(s.calls, "prepare")
+	return nil
+}
+
+func (s *fakeStore) Add(_ context.Context, events []domain.Event, _ []domain.StarFlag) error {
+	s.added = append(s.added, events...)
+	return nil
+}
+
+func (s *fakeStore) Diff(context.Context, domain.TimeRange) ([]domain.RepoDiff, error) {
+	s.calls = append(s.calls, "diff")
+	return s.diffs, nil
+}
+
+func (s *fakeStore) Swap(context.Context, domain.TimeRange) ([]domain.RepoDiff, error) {
+	s.calls = append(s.calls, "swap")
+	return s.diffs, nil
+}
+
+func (s *fakeStore) Discard(context.Context) error {
+	s.calls = append(s.calls, "discard")
+	return nil
+}
+
+func star(id string, at time.Time) domain.Event {
+	return domain.Event{ID: id, Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", ActorLogin: "u" + id, CreatedAt: at}
+}
+
+func TestRebuilderRun_DryRun(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := &fakeSource{batches: [][]domain.Event{
+		{star("1", from), star("2", from.Add(time.Minute)), star("1", from)},
+		{star("3", from.Add(-time.Minute)), star("4", from.Add(2*time.Hour))},
+	}}
+	store := &fakeStore{diffs: []domain.RepoDiff{{RepoID: 1}}}
+
+	report, err := NewRebuilder(source, store, nil, time.Hour).Run(context.Background(), domain.TimeRange{
+		From: from.Add(30 * time.Second),
+		To:   from.Add(90 * time.Minute),
+	}, false)
+	require.NoError(t, err)
+
+	// Диапазон расширяется до целых часов
+	window := domain.TimeRange{From: from, To: from.Add(2 * time.Hour)}
+	assert.Equal(t, window, store.prepared)
+	assert.Equal(t, []domain.Metric{domain.MetricStars}, store.metrics)
+	assert.Equal(t, []domain.Event{star("1", from), star("2", from.Add(time.Minute))}, store.added)
+	assert.Equal(t, []string{"prepare", "diff", "discard"}, store.calls)
+	assert.Equal(t, Report{
+		Window:     window,
+		Events:     2,
+		Duplicates: 1,
+		Outside:    2,
+		Diffs:      store.diffs,
+	}, report)
+}
+
+func TestRebuilderRun_Apply(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := &fakeSource{batches: [][]domain.Event{{star("1", from)}}}
+	store := &fakeStore{}
+
+	report, err := NewRebuilder(source, store, nil, time.Hour).Run(context.Background(), domain.TimeRange{
+		From: from,
+		To:   from.Add(time.Hour),
+	}, true)
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+	assert.Equal(t, []string{"prepare", "swap"}, store.calls)
+}
+
+func TestRebuilderRun_DiscardsOnSourceError(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := &fakeSource{err: errors.New("boom")}
+	store := &fakeStore{}
+
+	_, err := NewRebuilder(source, store, nil, time.Hour).Run(context.Background(), domain.TimeRange{
+		From: from,
+		To:   from.Add(time.Hour),
+	}, true)
+	require.Error(t, err)
+	assert.Equal(t, []string{"prepare", "discard"}, store.calls)
+}
+
+func TestRebuilderRun_RefusesUnsettledHours(t *testing.T) {
+	from := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	source := &fakeSource{}
+	store := &fakeStore{}
+	rebuilder := NewRebuilder(source, store, nil, time.Hour)
+
+	_, err := rebuilder.Run(context.Background(), domain.TimeRange{From: from, To: from.Add(2 * time.Hour)}, true)
+	require.ErrorIs(t, err, ErrUnsettledRange)
+	assert.Empty(t, store.calls)
+
+	// Без замены текущие агрегаты не меняются, поэтому сравнение разрешено
+	_, err = rebuilder.Run(context.Background(), domain.TimeRange{From: from, To: from.Add(2 * time.Hour)}, false)
+	require.NoError(t, err)
+
+	_, err = rebuilder.Run(context.Background(), domain.TimeRange{From: from, To: from.Add(time.Hour)}, true)
+	require.NoError(t, err)
+}
+
+type fakeLister struct {
+	events  []domain.Event
+	queries []domain.StarEventQuery
+}
+
+func (l *fakeLister) ListStarEvents(query domain.StarEventQuery) ([]domain.Event, error) {
+	l.queries = append(l.queries, query)
+	start := 0
+	if query.After != nil {
+		for i, event := range l.events {
+			if event.ID == query.After.ID {
+				start = i + 1
+			}
+		}
+	}
+	return l.events[start:min(start+query.Limit, len(l.events))], nil
+}
+
+func TestStoreSource_Pages(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	lister := &fakeLister{}
+	for i := range 5 {
+		lister.events = append(lister.events, star(fmt.Sprint(i), from.Add(time.Duration(i)*time.Minute)))
+	}
+
+	var read []domain.Event
+	err := NewStoreSource(lister, 2).Read(context.Background(), domain.TimeRange{From: from, To: from.Add(time.Hour)},
+		func(events []domain.Event) error {
+			read = append(read, events...)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, lister.events, read)
+	require.Len(t, lister.queries, 3)
+	assert.Equal(t, &domain.StarEventCursor{CreatedAt: from.Add(3 * time.Minute), ID: "3"}, lister.queries[2].After)
+}
+
+func TestArchiveSource_ReadsHours(t *testing.T) {
+	dir := t.TempDir()
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	lines := fmt.Sprintf(
+		`{"id":"2","type":"WatchEvent","actor":{"id":1,"login":"b"},"repo":{"id":2,"name":"org/a"},`+
+			`"payload":{"action":"started"},"created_at":%[2]q}`+"\n"+
+			`{"id":"1","type":"ForkEvent","actor":{"id":1,"login":"a"},"repo":{"id":2,"name":"org/a"},`+
+			`"payload":{},"created_at":%[1]q}`+"\n"+
+			`{"id":"3","type":"PushEvent","actor":{"id":1,"login":"a"},"repo":{"id":2,"name":"org/a"},`+
+			`"payload":{},"created_at":%[1]q}`+"\n",
+		from.Format(time.RFC3339), from.Add(time.Minute).Format(time.RFC3339),
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01-01-10.json"), []byte(lines), 0o600))
+
+	source := NewArchiveSource(ingestion.NewDirSource(dir), nil)
+
+	var read []domain.Event
+	err := source.Read(context.Background(), domain.TimeRange{From: from, To: from.Add(time.Hour)},
+		func(events []domain.Event) error {
+			read = append(read, events...)
+			return nil
+		})
+	require.NoError(t, err)
+	require.Len(t, read, 2)
+	assert.Equal(t, domain.ActionForked, read[0].Action)
+	assert.Equal(t, domain.ActionStarred, read[1].Action)
+
+	// Отсутствующий час прерывает пересчет
+	err = source.Read(context.Background(), domain.TimeRange{From: from, To: from.Add(2 * time.Hour)},
+		func([]domain.Event) error { return nil })
+	assert.ErrorIs(t, err, ingestion.ErrHourNotFound)
+}
@@ -0,0 +1,160 @@
+package rebuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/internal/ingestion"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPageSize задает размер страницы событий звезд, читаемых из хранилища.
+const DefaultPageSize = 5000
+
+// StarEventLister читает сохраненные события звезд.
+type StarEventLister interface {
+	ListStarEvents(query domain.StarEventQuery) ([]domain.Event, error)
+}
+
+// StoreSource отдает события звезд, сохраненные processor в star_events.
+// Пересчитываются только звезды, флаги накрутки берутся из хранилища. Часы
+// старше срока хранения star_events останутся без звезд: для них нужен архив.
+type StoreSource struct {
+	events   StarEventLister
+	pageSize int
+}
+
+// NewStoreSource создает новый StoreSource; pageSize <= 0 означает DefaultPageSize.
+func NewStoreSource(events StarEventLister, pageSize int) *StoreSource {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &StoreSource{events: events, pageSize: pageSize}
+}
+
+// Metrics возвращает метрики, пересчитываемые по star_events.
+func (s *StoreSource) Metrics() []domain.Metric {
+	return []domain.Metric{domain.MetricStars}
+}
+
+// Read передает сохраненные события звезд диапазона постранично.
+func (s *StoreSource) Read(ctx context.Context, window domain.TimeRange, handle func([]domain.Event) error) error {
+	query := domain.StarEventQuery{Window: window, Limit: s.pageSize}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		events, err := s.events.ListStarEvents(query)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		if err := handle(events); err != nil {
+			return err
+		}
+		if len(events) < s.pageSize {
+			return nil
+		}
+		last := events[len(events)-1]
+		query.After = &domain.StarEventCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// ArchiveSource заново читает часы GH Archive (или локального каталога) и
+// отбирает события так же, как ingestion: пересчитываются все метрики.
+type ArchiveSource struct {
+	source ingestion.EventSource
+	filter *ingestion.EventFilter
+}
+
+// NewArchiveSource создает новый ArchiveSource; nil filter пропускает все события.
+func NewArchiveSource(source ingestion.EventSource, filter *ingestion.EventFilter) *ArchiveSource {
+	return &ArchiveSource{source: source, filter: filter}
+}
+
+// Metrics возвращает все метрики.
+func (s *ArchiveSource) Metrics() []domain.Metric {
+	return domain.Metrics
+}
+
+// Read передает события каждого часа диапазона одной пачкой. Отсутствующий
+// час прерывает чтение: иначе его агрегаты были бы обнулены.
+func (s *ArchiveSource) Read(ctx context.Context, window domain.TimeRange, handle func([]domain.Event) error) error {
+	for hour := window.From; hour.Before(window.To); hour = hour.Add(time.Hour) {
+		events, err := s.readHour(ctx, hour)
+		if err != nil {
+			return fmt.Errorf("reading hour %s: %w", hour.Format(ingestion.HourLayout), err)
+		}
+		sortByTime(events)
+		if err := handle(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHour читает учитываемые события часа hour.
+func (s *ArchiveSource) readHour(ctx context.Context, hour time.Time) ([]domain.Event, error) {
+	body, err := s.source.Open(ctx, hour)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			logger.WithError(err).Warn("failed to close body")
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parsed := make(chan dto.GHEvent, 1000)
+	type parseResult struct {
+		stats ingestion.ParseStats
+		err   error
+	}
+	done := make(chan parseResult, 1)
+	go func() {
+		stats, err := ingestion.ParseStream(ctx, body, parsed)
+		close(parsed)
+		done <- parseResult{stats: stats, err: err}
+	}()
+
+	var events []domain.Event
+	filtered := 0
+	for gh := range parsed {
+		event, err := dto.ToKafkaEvent(gh)
+		if errors.Is(err, dto.ErrUnsupportedEvent) {
+			continue
+		}
+		if err != nil || gh.Validate() != nil || event.Validate() != nil {
+			continue
+		}
+		if _, ok := s.filter.Check(gh); !ok {
+			filtered++
+			continue
+		}
+		events = append(events, event.ToDomain())
+	}
+
+	result := <-done
+	if result.err != nil {
+		return nil, result.err
+	}
+	logger.WithFields(logrus.Fields{
+		"hour":           hour.Format(ingestion.HourLayout),
+		"lines":          result.stats.Lines,
+		"parse_failures": result.stats.Failures,
+		"filtered":       filtered,
+		"events":         len(events),
+		"truncated":      result.stats.Truncated,
+	}).Info("read archive hour")
+	return events, nil
+}
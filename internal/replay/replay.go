@@ -0,0 +1,253 @@
+// Package replay повторно публикует сообщения из dead-letter (или любого другого) топика.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+)
+
+// Source определяет интерфейс для чтения сообщений исходного топика.
+type Source interface {
+	Fetch(ctx context.Context) (kafka.Message, error)
+	Commit(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Sink определяет интерфейс для публикации сообщений в основной топик.
+type Sink interface {
+	Send(ctx context.Context, key string, value []byte) error
+}
+
+// Filter задает условия отбора сообщений; пустые поля не ограничивают отбор.
+type Filter struct {
+	ErrorTypes []dto.DeadLetterErrorType
+	// Since и Until ограничивают время ошибки (или время сообщения, если оно
+	// прочитано не из dead-letter топика) полуинтервалом [Since, Until).
+	Since time.Time
+	Until time.Time
+	Repo  string
+}
+
+// Candidate представляет сообщение, подготовленное к повторной публикации.
+type Candidate struct {
+	Event     dto.KafkaEvent          `json:"event"`
+	ErrorType dto.DeadLetterErrorType `json:"error_type,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+	FailedAt  time.Time               `json:"failed_at"`
+	Partition int                     `json:"partition"`
+	Offset    int64                   `json:"offset"`
+}
+
+// Report содержит итоги прогона replay.
+type Report struct {
+	Read     int
+	Replayed int
+	Filtered int
+	Invalid  int
+	// Uncommitted считает опубликованные сообщения, смещения которых не
+	// зафиксированы, потому что раньше в их партиции есть непереданное сообщение.
+	Uncommitted int
+}
+
+// Replayer читает сообщения, отбирает их фильтром, проверяет и публикует заново.
+type Replayer struct {
+	source      Source
+	sink        Sink
+	filter      Filter
+	dryRun      bool
+	idleTimeout time.Duration
+	out         io.Writer
+}
+
+// NewReplayer создает новый Replayer. В режиме dryRun сообщения не публикуются,
+// смещения не фиксируются, а кандидаты печатаются в out построчно в JSON.
+func NewReplayer(
+	source Source,
+	sink Sink,
+	filter Filter,
+	dryRun bool,
+	idleTimeout time.Duration,
+	out io.Writer,
+) *Replayer {
+	return &Replayer{
+		source:      source,
+		sink:        sink,
+		filter:      filter,
+		dryRun:      dryRun,
+		idleTimeout: idleTimeout,
+		out:         out,
+	}
+}
+
+// Run обрабатывает сообщения, пока в течение idleTimeout не перестанут
+// приходить новые, что означает достижение конца топика.
+//
+// Фиксируются только смещения опубликованных сообщений. Смещение в Kafka
+// фиксируется для партиции целиком, поэтому после первого отфильтрованного или
+// некорректного сообщения фиксация в его партиции прекращается до конца прогона:
+// такое сообщение остается доступным следующему прогону с другим фильтром, а
+// опубликованные после него будут опубликованы повторно, что допускает
+// дедупликация processor.
+func (r *Replayer) Run(ctx context.Context) (Report, error) {
+	report := Report{}
+	encoder := json.NewEncoder(r.out)
+	// held содержит партиции, в которых встретилось неопубликованное сообщение.
+	held := make(map[int]bool)
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, r.idleTimeout)
+		msg, err := r.source.Fetch(fetchCtx)
+		idle := errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			if idle {
+				return report, nil
+			}
+			return report, err
+		}
+		report.Read++
+
+		candidate, err := Decode(msg)
+		switch {
+		case err != nil:
+			report.Invalid++
+			r.hold(held, msg)
+			logger.WithError(err).WithFields(logrus.Fields{
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+			}).Warn("skipping invalid message")
+			continue
+		case !r.filter.Match(candidate):
+			report.Filtered++
+			r.hold(held, msg)
+			continue
+		case r.dryRun:
+			report.Replayed++
+			if err := encoder.Encode(candidate); err != nil {
+				return report, fmt.Errorf("printing candidate: %w", err)
+			}
+			continue
+		}
+
+		if err := r.publish(ctx, candidate); err != nil {
+			return report, err
+		}
+		report.Replayed++
+		if held[msg.Partition] {
+			report.Uncommitted++
+			continue
+		}
+		if err := r.source.Commit(ctx, msg); err != nil {
+			return report, err
+		}
+	}
+}
+
+// hold прекращает фиксацию смещений в партиции сообщения msg.
+func (r *Replayer) hold(held map[int]bool, msg kafka.Message) {
+	if r.dryRun || held[msg.Partition] {
+		return
+	}
+	held[msg.Partition] = true
+	logger.WithFields(logrus.Fields{
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	}).Info("message not replayed, stopping offset commits in partition")
+}
+
+// publish отправляет событие в основной топик.
+func (r *Replayer) publish(ctx context.Context, candidate Candidate) error {
+	data, err := json.Marshal(candidate.Event)
+	if err != nil {
+		return fmt.Errorf("marshalling event: %w", err)
+	}
+	if err := r.sink.Send(ctx, candidate.Event.EventID, data); err != nil {
+		return fmt.Errorf("republishing event %s: %w", candidate.Event.EventID, err)
+	}
+	return nil
+}
+
+// Match проверяет, подходит ли кандидат под фильтр.
+func (f Filter) Match(c Candidate) bool {
+	if len(f.ErrorTypes) > 0 && !slices.Contains(f.ErrorTypes, c.ErrorType) {
+		return false
+	}
+	if !f.Since.IsZero() && c.FailedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !c.FailedAt.Before(f.Until) {
+		return false
+	}
+	if f.Repo != "" && c.Event.RepoName != f.Repo {
+		return false
+	}
+	return true
+}
+
+// Decode разбирает сообщение: конверт dto.DeadLetter или исходное событие,
+// которое может быть dto.KafkaEvent или dto.GHEvent. Событие проверяется
+// и приводится к dto.KafkaEvent.
+func Decode(msg kafka.Message) (Candidate, error) {
+	candidate := Candidate{
+		FailedAt:  msg.Time,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}
+	payload := msg.Value
+
+	var letter dto.DeadLetter
+	if err := json.Unmarshal(msg.Value, &letter); err == nil && letter.ErrorType != "" {
+		candidate.ErrorType = letter.ErrorType
+		candidate.Error = letter.Error
+		candidate.FailedAt = letter.FailedAt
+		payload = letter.Payload
+	}
+
+	event, err := decodeEvent(payload)
+	if err != nil {
+		return Candidate{}, err
+	}
+	candidate.Event = *event
+	return candidate, nil
+}
+
+// decodeEvent разбирает и проверяет событие в формате dto.KafkaEvent или dto.GHEvent.
+func decodeEvent(payload []byte) (*dto.KafkaEvent, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("decoding payload: %w", err)
+	}
+
+	if _, ok := fields["event_id"]; ok {
+		var event dto.KafkaEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("decoding kafka event: %w", err)
+		}
+		if err := event.Validate(); err != nil {
+			return nil, fmt.Errorf("validating kafka event: %w", err)
+		}
+		return &event, nil
+	}
+
+	var gh dto.GHEvent
+	if err := json.Unmarshal(payload, &gh); err != nil {
+		return nil, fmt.Errorf("decoding github event: %w", err)
+	}
+	if err := gh.Validate(); err != nil {
+		return nil, fmt.Errorf("validating github event: %w", err)
+	}
+	return dto.ToKafkaEvent(gh)
+}
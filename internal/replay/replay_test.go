@@ -0,0 +1,200 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/dto"
+	"github.com/kun1ts4/stars-analytics/pkg/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource отдает сообщения из очереди, а затем блокируется до отмены контекста.
+type fakeSource struct {
+	messages  []kafka.Message
+	committed []int64
+}
+
+func (s *fakeSource) Fetch(ctx context.Context) (kafka.Message, error) {
+	if len(s.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	return msg, nil
+}
+
+func (s *fakeSource) Commit(_ context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		s.committed = append(s.committed, msg.Offset)
+	}
+	return nil
+}
+
+type fakeSink struct {
+	keys []string
+}
+
+func (s *fakeSink) Send(_ context.Context, key string, _ []byte) error {
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+var failedAt = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func kafkaEvent(id, repo string) dto.KafkaEvent {
+	return dto.KafkaEvent{
+		EventID:   id,
+		Action:    domain.ActionStarred,
+		RepoID:    1,
+		RepoName:  repo,
+		UserLogin: "user",
+		Timestamp: failedAt.Add(-time.Hour),
+	}
+}
+
+func deadLetterMessage(t *testing.T, offset int64, errorType dto.DeadLetterErrorType, payload any) kafka.Message {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	letter, err := json.Marshal(dto.DeadLetter{
+		Payload:   data,
+		ErrorType: errorType,
+		Error:     "boom",
+		FailedAt:  failedAt,
+	})
+	require.NoError(t, err)
+	return kafka.Message{Offset: offset, Value: letter}
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("DeadLetterWithKafkaEvent", func(t *testing.T) {
+		msg := deadLetterMessage(t, 1, dto.DeadLetterProcess, kafkaEvent("1", "owner/repo"))
+
+		candidate, err := Decode(msg)
+
+		require.NoError(t, err)
+		require.Equal(t, dto.DeadLetterProcess, candidate.ErrorType)
+		require.Equal(t, failedAt, candidate.FailedAt)
+		require.Equal(t, "1", candidate.Event.EventID)
+	})
+
+	t.Run("RawGitHubEvent", func(t *testing.T) {
+		raw := `{"id":"2","type":"WatchEvent","actor":{"id":1,"login":"user"},` +
+			`"repo":{"id":5,"name":"owner/repo"},"payload":{"action":"started"},` +
+			`"created_at":"2024-01-01T11:00:00Z"}`
+
+		candidate, err := Decode(kafka.Message{Value: []byte(raw), Time: failedAt})
+
+		require.NoError(t, err)
+		require.Equal(t, "2", candidate.Event.EventID)
+		require.Equal(t, int64(5), candidate.Event.RepoID)
+		require.Equal(t, failedAt, candidate.FailedAt)
+	})
+
+	t.Run("InvalidEvent", func(t *testing.T) {
+		event := kafkaEvent("3", "")
+		msg := deadLetterMessage(t, 1, dto.DeadLetterProcess, event)
+
+		_, err := Decode(msg)
+
+		require.Error(t, err)
+	})
+
+	t.Run("Garbage", func(t *testing.T) {
+		_, err := Decode(kafka.Message{Value: []byte("not json")})
+
+		require.Error(t, err)
+	})
+}
+
+func TestFilterMatch(t *testing.T) {
+	candidate := Candidate{
+		Event:     kafkaEvent("1", "owner/repo"),
+		ErrorType: dto.DeadLetterDecode,
+		FailedAt:  failedAt,
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"Empty", Filter{}, true},
+		{"ErrorTypeMatches", Filter{ErrorTypes: []dto.DeadLetterErrorType{dto.DeadLetterDecode}}, true},
+		{"ErrorTypeDiffers", Filter{ErrorTypes: []dto.DeadLetterErrorType{dto.DeadLetterPublish}}, false},
+		{"SinceInclusive", Filter{Since: failedAt}, true},
+		{"UntilExclusive", Filter{Until: failedAt}, false},
+		{"RepoDiffers", Filter{Repo: "other/repo"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.filter.Match(candidate))
+		})
+	}
+}
+
+func TestReplayer_Run(t *testing.T) {
+	messages := func(t *testing.T) []kafka.Message {
+		return []kafka.Message{
+			deadLetterMessage(t, 1, dto.DeadLetterProcess, kafkaEvent("1", "owner/repo")),
+			deadLetterMessage(t, 2, dto.DeadLetterProcess, kafkaEvent("2", "other/repo")),
+			{Offset: 3, Value: []byte("not json")},
+		}
+	}
+
+	t.Run("Republishes", func(t *testing.T) {
+		source := &fakeSource{messages: messages(t)}
+		sink := &fakeSink{}
+		replayer := NewReplayer(source, sink, Filter{Repo: "owner/repo"}, false, 10*time.Millisecond, &bytes.Buffer{})
+
+		report, err := replayer.Run(context.Background())
+
+		require.NoError(t, err)
+		require.Equal(t, Report{Read: 3, Replayed: 1, Filtered: 1, Invalid: 1}, report)
+		require.Equal(t, []string{"1"}, sink.keys)
+		// Отфильтрованное и некорректное сообщения не фиксируются
+		require.Equal(t, []int64{1}, source.committed)
+	})
+
+	t.Run("StopsCommittingAfterSkippedMessage", func(t *testing.T) {
+		source := &fakeSource{messages: []kafka.Message{
+			deadLetterMessage(t, 1, dto.DeadLetterDecode, kafkaEvent("1", "owner/repo")),
+			deadLetterMessage(t, 2, dto.DeadLetterProcess, kafkaEvent("2", "owner/repo")),
+			{Partition: 1, Offset: 1, Value: deadLetterMessage(t, 0, dto.DeadLetterProcess, kafkaEvent("3", "owner/repo")).Value},
+		}}
+		sink := &fakeSink{}
+		filter := Filter{ErrorTypes: []dto.DeadLetterErrorType{dto.DeadLetterProcess}}
+		replayer := NewReplayer(source, sink, filter, false, 10*time.Millisecond, &bytes.Buffer{})
+
+		report, err := replayer.Run(context.Background())
+
+		require.NoError(t, err)
+		require.Equal(t, Report{Read: 3, Replayed: 2, Filtered: 1, Uncommitted: 1}, report)
+		require.Equal(t, []string{"2", "3"}, sink.keys)
+		// Фиксация в партиции 0 остановлена на отфильтрованном сообщении
+		require.Equal(t, []int64{1}, source.committed)
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		source := &fakeSource{messages: messages(t)}
+		sink := &fakeSink{}
+		out := &bytes.Buffer{}
+		replayer := NewReplayer(source, sink, Filter{}, true, 10*time.Millisecond, out)
+
+		report, err := replayer.Run(context.Background())
+
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Replayed)
+		require.Empty(t, sink.keys)
+		require.Empty(t, source.committed)
+		require.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 2)
+	})
+}
@@ -0,0 +1,51 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CheckpointRepo хранит checkpoint ingestion в Postgres.
+type CheckpointRepo struct {
+	db     *gorm.DB
+	source string
+}
+
+// NewCheckpointRepo создает новый CheckpointRepo для источника source.
+func NewCheckpointRepo(db *gorm.DB, source string) *CheckpointRepo {
+	return &CheckpointRepo{db: db, source: source}
+}
+
+// Load возвращает сохраненный час источника.
+func (r *CheckpointRepo) Load(ctx context.Context) (time.Time, bool, error) {
+	var checkpoint models.IngestionCheckpoint
+	err := r.db.WithContext(ctx).Where("source = ?", r.source).Take(&checkpoint).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("loading checkpoint: %w", err)
+	}
+	return checkpoint.Hour.UTC(), true, nil
+}
+
+// Save сохраняет час источника.
+func (r *CheckpointRepo) Save(ctx context.Context, hour time.Time) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hour", "updated_at"}),
+	}).Create(&models.IngestionCheckpoint{
+		Source: r.source,
+		Hour:   hour.UTC(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointRepo_LoadMissing(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCheckpointRepo(db, "gharchive")
+
+	mock.ExpectQuery(`SELECT \* FROM "ingestion_checkpoints" WHERE source = \$1 LIMIT \$2`).
+		WithArgs("gharchive", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"source", "hour", "updated_at"}))
+
+	_, ok, err := repo.Load(context.Background())
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckpointRepo_SaveAndLoad(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCheckpointRepo(db, "gharchive")
+
+	hour := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "ingestion_checkpoints" .* ON CONFLICT \("source"\) DO UPDATE`).
+		WithArgs("gharchive", hour, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT \* FROM "ingestion_checkpoints"`).
+		WithArgs("gharchive", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"source", "hour", "updated_at"}).
+			AddRow("gharchive", hour, time.Now()))
+
+	require.NoError(t, repo.Save(context.Background(), hour))
+
+	got, ok, err := repo.Load(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, hour, got)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
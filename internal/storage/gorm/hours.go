@@ -0,0 +1,196 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"github.com/kun1ts4/stars-analytics/pkg/pb/github.com/kun1ts4/stars-analytics/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HourRepo хранит статусы обработанных и неудачных часов GH Archive в Postgres.
+type HourRepo struct {
+	db *gorm.DB
+}
+
+// NewHourRepo создает новый HourRepo.
+func NewHourRepo(db *gorm.DB) *HourRepo {
+	return &HourRepo{db: db}
+}
+
+// CompletedHours возвращает завершенные часы диапазона [from, to).
+func (r *HourRepo) CompletedHours(ctx context.Context, from, to time.Time) ([]time.Time, error) {
+	var hours []time.Time
+	err := r.db.WithContext(ctx).Model(&models.IngestedHour{}).
+		Where("status = ? AND hour >= ? AND hour < ?", string(domain.IngestedHourCompleted), from, to).
+		Order("hour").
+		Pluck("hour", &hours).Error
+	if err != nil {
+		return nil, fmt.Errorf("getting completed hours: %w", err)
+	}
+	return hours, nil
+}
+
+// LoadProgress возвращает сохраненное смещение строки часа, если час не завершен.
+func (r *HourRepo) LoadProgress(ctx context.Context, hour time.Time) (int64, error) {
+	var offsets []int64
+	err := r.db.WithContext(ctx).Model(&models.IngestedHour{}).
+		Where("hour = ? AND status <> ?", hour.UTC(), string(domain.IngestedHourCompleted)).
+		Pluck("line_offset", &offsets).Error
+	if err != nil {
+		return 0, fmt.Errorf("getting hour progress: %w", err)
+	}
+	if len(offsets) == 0 {
+		return 0, nil
+	}
+	return offsets[0], nil
+}
+
+// SaveProgress сохраняет смещение строки часа. Новый час получает статус
+// in_progress, статус существующей записи не меняется.
+func (r *HourRepo) SaveProgress(ctx context.Context, hour time.Time, offset int64) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hour"}},
+		DoUpdates: clause.AssignmentColumns([]string{"line_offset", "updated_at"}),
+	}).Create(&models.IngestedHour{
+		Hour:       hour.UTC(),
+		Status:     string(domain.IngestedHourInProgress),
+		LineOffset: offset,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("saving hour progress: %w", err)
+	}
+	return nil
+}
+
+// MarkCompleted отмечает час завершенным, сохраняет счетчики загрузки и сбрасывает смещение.
+func (r *HourRepo) MarkCompleted(ctx context.Context, hour time.Time, stats domain.HourStats) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "hour"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"status", "line_offset", "bytes_downloaded", "lines_parsed", "parse_failures",
+			"events_produced", "send_failures", "duration_ms", "filtered_events", "oversized_lines", "truncated", "updated_at",
+		}),
+	}).Create(&models.IngestedHour{
+		Hour:      hour.UTC(),
+		Status:    string(domain.IngestedHourCompleted),
+		HourStats: models.HourStats(stats),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("marking hour completed: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed отмечает час неудачным, прибавляя attempts к числу попыток.
+func (r *HourRepo) MarkFailed(ctx context.Context, hour time.Time, attempts int, cause error) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":     gorm.Expr("excluded.status"),
+			"attempts":   gorm.Expr("ingested_hours.attempts + excluded.attempts"),
+			"last_error": gorm.Expr("excluded.last_error"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&models.IngestedHour{
+		Hour:      hour.UTC(),
+		Status:    string(domain.IngestedHourFailed),
+		Attempts:  attempts,
+		LastError: cause.Error(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("marking hour failed: %w", err)
+	}
+	return nil
+}
+
+// FailedHours возвращает неудачные часы по возрастанию.
+func (r *HourRepo) FailedHours(ctx context.Context) ([]domain.IngestedHour, error) {
+	var hours []models.IngestedHour
+	err := r.db.WithContext(ctx).
+		Where("status = ?", string(domain.IngestedHourFailed)).
+		Order("hour").
+		Find(&hours).Error
+	if err != nil {
+		return nil, fmt.Errorf("getting failed hours: %w", err)
+	}
+	return toDomainHours(hours), nil
+}
+
+// Hours возвращает записи журнала для часов диапазона [from, to) по возрастанию.
+func (r *HourRepo) Hours(ctx context.Context, from, to time.Time) ([]domain.IngestedHour, error) {
+	var hours []models.IngestedHour
+	err := r.db.WithContext(ctx).
+		Where("hour >= ? AND hour < ?", from, to).
+		Order("hour").
+		Find(&hours).Error
+	if err != nil {
+		return nil, fmt.Errorf("getting ingested hours: %w", err)
+	}
+	return toDomainHours(hours), nil
+}
+
+// toDomainHours преобразует записи журнала загрузки в доменные значения.
+func toDomainHours(rows []models.IngestedHour) []domain.IngestedHour {
+	hours := make([]domain.IngestedHour, len(rows))
+	for i, row := range rows {
+		hours[i] = domain.IngestedHour{
+			Hour:       row.Hour,
+			Status:     domain.IngestedHourStatus(row.Status),
+			Attempts:   row.Attempts,
+			LastError:  row.LastError,
+			LineOffset: row.LineOffset,
+			HourStats:  domain.HourStats(row.HourStats),
+			UpdatedAt:  row.UpdatedAt,
+		}
+	}
+	return hours
+}
+
+// IngestionStatus возвращает журнал загрузки за окно window и часы без записей.
+func (r *HourRepo) IngestionStatus(
+	ctx context.Context,
+	window domain.TimeRange,
+) (*proto.IngestionStatusResponse, error) {
+	window = window.Align(domain.GranularityHour)
+
+	hours, err := r.Hours(ctx, window.From, window.To)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &proto.IngestionStatusResponse{Hours: make([]*proto.IngestedHour, len(hours))}
+	recorded := make(map[time.Time]struct{}, len(hours))
+	for i, hour := range hours {
+		recorded[hour.Hour.UTC()] = struct{}{}
+		resp.Hours[i] = &proto.IngestedHour{
+			Hour:            timestamppb.New(hour.Hour),
+			Status:          string(hour.Status),
+			Attempts:        uint32(hour.Attempts),
+			LastError:       hour.LastError,
+			BytesDownloaded: uint64(hour.BytesDownloaded),
+			LinesParsed:     uint64(hour.LinesParsed),
+			ParseFailures:   uint64(hour.ParseFailures),
+			EventsProduced:  uint64(hour.EventsProduced),
+			SendFailures:    uint64(hour.SendFailures),
+			DurationMs:      uint64(hour.DurationMs),
+			UpdatedAt:       timestamppb.New(hour.UpdatedAt),
+			FilteredEvents:  uint64(hour.FilteredEvents),
+			OversizedLines:  uint64(hour.OversizedLines),
+			Truncated:       hour.Truncated,
+		}
+	}
+
+	for hour := window.From; hour.Before(window.To); hour = hour.Add(time.Hour) {
+		if _, ok := recorded[hour]; !ok {
+			resp.Missing = append(resp.Missing, timestamppb.New(hour))
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHourRepo_CompletedHours(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewHourRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	mock.ExpectQuery(`SELECT "hour" FROM "ingested_hours" WHERE status = \$1 AND hour >= \$2 AND hour < \$3`).
+		WithArgs("completed", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"hour"}).
+			AddRow(from).
+			AddRow(from.Add(2 * time.Hour)))
+
+	hours, err := repo.CompletedHours(context.Background(), from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{from, from.Add(2 * time.Hour)}, hours)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHourRepo_MarkCompleted(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewHourRepo(db)
+
+	hour := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "ingested_hours" .* ON CONFLICT \("hour"\) DO UPDATE`).
+		WithArgs(hour, "completed", 0, "", int64(0), int64(1024), int64(10), int64(1), int64(3), int64(0), int64(250),
+			int64(0), int64(0), false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	stats := domain.HourStats{
+		BytesDownloaded: 1024,
+		LinesParsed:     10,
+		ParseFailures:   1,
+		EventsProduced:  3,
+		DurationMs:      250,
+	}
+	require.NoError(t, repo.MarkCompleted(context.Background(), hour, stats))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHourRepo_MarkFailed(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewHourRepo(db)
+
+	hour := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "ingested_hours" .* ON CONFLICT \("hour"\) DO UPDATE SET `+
+		`"attempts"=ingested_hours.attempts \+ excluded.attempts,"last_error"=excluded.last_error,`+
+		`"status"=excluded.status`).
+		WithArgs(hour, "failed", 3, "status 503", int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0),
+			int64(0), int64(0), false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.MarkFailed(context.Background(), hour, 3, errors.New("status 503")))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHourRepo_IngestionStatus(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewHourRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: from, To: from.Add(3 * time.Hour)}
+
+	mock.ExpectQuery(`SELECT \* FROM "ingested_hours" WHERE hour >= \$1 AND hour < \$2 ORDER BY hour`).
+		WithArgs(window.From, window.To).
+		WillReturnRows(sqlmock.NewRows([]string{"hour", "status", "events_produced"}).
+			AddRow(from, "completed", 42).
+			AddRow(from.Add(2*time.Hour), "failed", 0))
+
+	resp, err := repo.IngestionStatus(context.Background(), window)
+	require.NoError(t, err)
+
+	require.Len(t, resp.Hours, 2)
+	assert.Equal(t, "completed", resp.Hours[0].Status)
+	assert.Equal(t, uint64(42), resp.Hours[0].EventsProduced)
+	require.Len(t, resp.Missing, 1)
+	assert.Equal(t, from.Add(time.Hour), resp.Missing[0].AsTime())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
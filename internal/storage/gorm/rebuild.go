@@ -0,0 +1,309 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// hourlyShadowTable содержит пересчитываемые часовые агрегаты.
+	hourlyShadowTable = hourlyTable + "_rebuild"
+	// stargazersShadowTable содержит пересчитываемые счетчики уникальных аккаунтов.
+	stargazersShadowTable = stargazersTable + "_rebuild"
+)
+
+// RebuildRepo пересчитывает агрегаты диапазона часов в теневых таблицах
+// и подменяет ими текущие данные. Одновременно выполняется только один пересчет:
+// теневые таблицы общие.
+type RebuildRepo struct {
+	db *gorm.DB
+}
+
+// NewRebuildRepo создает новый RebuildRepo.
+func NewRebuildRepo(db *gorm.DB) *RebuildRepo {
+	return &RebuildRepo{db: db}
+}
+
+// Prepare создает теневые таблицы диапазона window. Метрики вне metrics
+// не пересчитываются: их значения копируются из текущих агрегатов.
+func (r *RebuildRepo) Prepare(ctx context.Context, window domain.TimeRange, metrics []domain.Metric) error {
+	db := r.db.WithContext(ctx)
+
+	// Часовые агрегаты свернутых суток могут быть удалены: пересчет части часов
+	// таких суток заменил бы их свертку неполной суммой.
+	watermarks, err := rollupWatermarks(db)
+	if err != nil {
+		return err
+	}
+	if pruned, ok := watermarks[domain.GranularityHour]; ok && window.From.Before(pruned) {
+		return errors.New("range starts before the retained hourly aggregates, rebuild only hours after the retention horizon")
+	}
+
+	for _, table := range []string{hourlyShadowTable, stargazersShadowTable} {
+		source := strings.TrimSuffix(table, "_rebuild")
+		statements := []string{
+			"DROP TABLE IF EXISTS " + table,
+			fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING INDEXES)", table, source),
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("creating %s: %w", table, err)
+			}
+		}
+	}
+
+	covered := make([]string, 0, len(metrics)+1)
+	for _, metric := range metrics {
+		covered = append(covered, metricColumns[metric]+" = 0")
+	}
+	if len(covered) == len(metricColumns) {
+		return nil
+	}
+
+	err = db.Exec(
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE hour >= ? AND hour < ?", hourlyShadowTable, hourlyTable),
+		window.From, window.To,
+	).Error
+	if err != nil {
+		return fmt.Errorf("copying hourly aggregates: %w", err)
+	}
+
+	// Звезды пересчитываются вместе со своими флагами и счетчиками аккаунтов.
+	if slices.Contains(metrics, domain.MetricStars) {
+		covered = append(covered, flaggedColumn+" = 0")
+	} else {
+		err := db.Exec(
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE hour >= ? AND hour < ?", stargazersShadowTable, stargazersTable),
+			window.From, window.To,
+		).Error
+		if err != nil {
+			return fmt.Errorf("copying stargazer sketches: %w", err)
+		}
+	}
+	if len(covered) == 0 {
+		return nil
+	}
+
+	err = db.Exec(fmt.Sprintf("UPDATE %s SET %s", hourlyShadowTable, strings.Join(covered, ", "))).Error
+	if err != nil {
+		return fmt.Errorf("resetting rebuilt metrics: %w", err)
+	}
+	return nil
+}
+
+// Add учитывает пачку событий и звезды, помеченные задним числом, в теневых таблицах.
+// Повторы ID не отбрасываются: это делает вызывающий.
+func (r *RebuildRepo) Add(ctx context.Context, events []domain.Event, flags []domain.StarFlag) error {
+	hourly, _ := aggregate(events)
+	if len(hourly) == 0 && len(flags) == 0 {
+		return nil
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(hourly) > 0 {
+			err := tx.Table(hourlyShadowTable).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "repo_id"}, {Name: "hour"}},
+				DoUpdates: counterAssignments(hourlyShadowTable, "", flaggedColumn),
+			}).CreateInBatches(hourly, insertChunkSize).Error
+			if err != nil {
+				return fmt.Errorf("upserting rebuilt aggregates: %w", err)
+			}
+		}
+		if err := mergeStargazers(tx, stargazersShadowTable, events); err != nil {
+			return err
+		}
+		return addFlaggedStars(tx, hourlyShadowTable, flags)
+	})
+}
+
+// Diff сравнивает пересчитанные агрегаты диапазона window с текущими и
+// возвращает репозитории, у которых отличается хотя бы одна метрика.
+func (r *RebuildRepo) Diff(ctx context.Context, window domain.TimeRange) ([]domain.RepoDiff, error) {
+	return diffAggregates(r.db.WithContext(ctx), window)
+}
+
+// Swap атомарно заменяет агрегаты и счетчики аккаунтов диапазона window
+// пересчитанными, пересчитывает затронутые свертки, поправляет итоги
+// репозиториев на разницу и удаляет теневые таблицы. Запись processor в эти таблицы на время замены блокируется.
+func (r *RebuildRepo) Swap(ctx context.Context, window domain.TimeRange) ([]domain.RepoDiff, error) {
+	var diffs []domain.RepoDiff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked := []string{hourlyTable, stargazersTable, stargazerRollupsTable, "repo_totals", "rollup_watermarks"}
+		for _, g := range []domain.Granularity{domain.GranularityDay, domain.GranularityWeek, domain.GranularityMonth} {
+			locked = append(locked, rollupTables[g])
+		}
+		err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", strings.Join(locked, ", "))).Error
+		if err != nil {
+			return fmt.Errorf("locking aggregates: %w", err)
+		}
+
+		diffs, err = diffAggregates(tx, window)
+		if err != nil {
+			return err
+		}
+
+		counters := append([]string{flaggedColumn}, sortedMetricColumns()...)
+		nonZero := make([]string, len(counters))
+		for i, column := range counters {
+			nonZero[i] = column + " <> 0"
+		}
+		statements := []struct {
+			query  string
+			target string
+		}{
+			{fmt.Sprintf("DELETE FROM %s WHERE hour >= ? AND hour < ?", hourlyTable), hourlyTable},
+			{fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE hour >= ? AND hour < ? AND (%s)",
+				hourlyTable, hourlyShadowTable, strings.Join(nonZero, " OR ")), hourlyTable},
+			{fmt.Sprintf("DELETE FROM %s WHERE hour >= ? AND hour < ?", stargazersTable), stargazersTable},
+			{fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE hour >= ? AND hour < ?",
+				stargazersTable, stargazersShadowTable), stargazersTable},
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement.query, window.From, window.To).Error; err != nil {
+				return fmt.Errorf("replacing %s: %w", statement.target, err)
+			}
+		}
+
+		if err := recompactOverlapping(tx, window); err != nil {
+			return err
+		}
+		if err := adjustTotals(tx, diffs); err != nil {
+			return err
+		}
+		return dropShadows(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// Discard удаляет теневые таблицы, не меняя текущие данные.
+func (r *RebuildRepo) Discard(ctx context.Context) error {
+	return dropShadows(r.db.WithContext(ctx))
+}
+
+// dropShadows удаляет теневые таблицы пересчета.
+func dropShadows(db *gorm.DB) error {
+	err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s, %s", hourlyShadowTable, stargazersShadowTable)).Error
+	if err != nil {
+		return fmt.Errorf("dropping rebuild tables: %w", err)
+	}
+	return nil
+}
+
+// sortedMetricColumns возвращает колонки метрик в порядке domain.Metrics.
+func sortedMetricColumns() []string {
+	columns := make([]string, len(domain.Metrics))
+	for i, metric := range domain.Metrics {
+		columns[i] = metricColumns[metric]
+	}
+	return columns
+}
+
+// diffAggregates суммирует метрики репозиториев за window в текущей и теневой
+// таблицах и возвращает отличающиеся, упорядоченные по repo_id.
+func diffAggregates(db *gorm.DB, window domain.TimeRange) ([]domain.RepoDiff, error) {
+	columns := sortedMetricColumns()
+	sums := make([]string, len(columns))
+	oldValues := make([]string, len(columns))
+	newValues := make([]string, len(columns))
+	changed := make([]string, len(columns))
+	for i, column := range columns {
+		sums[i] = fmt.Sprintf("SUM(%s) AS %s", column, column)
+		oldValues[i] = fmt.Sprintf("COALESCE(o.%s, 0)", column)
+		newValues[i] = fmt.Sprintf("COALESCE(n.%s, 0)", column)
+		changed[i] = oldValues[i] + " <> " + newValues[i]
+	}
+	rangeSums := func(table string) string {
+		return fmt.Sprintf(
+			"SELECT repo_id, MAX(repo_name) AS repo_name, %s FROM %s WHERE hour >= @from AND hour < @to GROUP BY repo_id",
+			strings.Join(sums, ", "), table,
+		)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(n.repo_id, o.repo_id), COALESCE(n.repo_name, o.repo_name), %s, %s
+		FROM (%s) o
+		FULL OUTER JOIN (%s) n ON n.repo_id = o.repo_id
+		WHERE %s
+		ORDER BY 1
+	`,
+		strings.Join(oldValues, ", "), strings.Join(newValues, ", "),
+		rangeSums(hourlyTable), rangeSums(hourlyShadowTable),
+		strings.Join(changed, " OR "),
+	)
+
+	rows, err := db.Raw(query, map[string]interface{}{"from": window.From, "to": window.To}).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("comparing aggregates: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var diffs []domain.RepoDiff
+	for rows.Next() {
+		diff := domain.RepoDiff{
+			Old: make(domain.MetricCounts, len(domain.Metrics)),
+			New: make(domain.MetricCounts, len(domain.Metrics)),
+		}
+		values := make([]int64, 2*len(domain.Metrics))
+		dest := []interface{}{&diff.RepoID, &diff.RepoName}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scanning aggregate diff: %w", err)
+		}
+		for i, metric := range domain.Metrics {
+			diff.Old[metric] = values[i]
+			diff.New[metric] = values[len(domain.Metrics)+i]
+		}
+		diffs = append(diffs, diff)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading aggregate diff: %w", err)
+	}
+	return diffs, nil
+}
+
+// adjustTotals прибавляет к итогам репозиториев изменение метрик после пересчета.
+// Имя репозитория в итогах не меняется: оно может быть новее пересчитанного диапазона.
+func adjustTotals(tx *gorm.DB, diffs []domain.RepoDiff) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	totals := make([]models.RepoTotal, len(diffs))
+	for i, diff := range diffs {
+		totals[i] = models.RepoTotal{
+			RepoID:                  diff.RepoID,
+			RepoName:                diff.RepoName,
+			TotalStars:              diff.Delta(domain.MetricStars),
+			TotalForks:              diff.Delta(domain.MetricForks),
+			TotalPullRequestsOpened: diff.Delta(domain.MetricPRsOpened),
+			TotalPullRequestsMerged: diff.Delta(domain.MetricPRsMerged),
+			TotalIssuesOpened:       diff.Delta(domain.MetricIssuesOpened),
+			TotalReleases:           diff.Delta(domain.MetricReleases),
+		}
+	}
+
+	assignments := slices.DeleteFunc(counterAssignments("repo_totals", totalPrefix), func(a clause.Assignment) bool {
+		return a.Column.Name == "repo_name"
+	})
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "repo_id"}},
+		DoUpdates: assignments,
+	}).CreateInBatches(totals, insertChunkSize).Error
+	if err != nil {
+		return fmt.Errorf("adjusting repo totals: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildPrepare_CopiesMetricsNotRebuilt(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewRebuildRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+
+	mock.ExpectQuery(`SELECT \* FROM "rollup_watermarks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"granularity", "compacted_until"}).
+			AddRow("hour", from.AddDate(0, 0, -1)))
+	mock.ExpectExec(`DROP TABLE IF EXISTS hourly_aggregates_rebuild`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE hourly_aggregates_rebuild \(LIKE hourly_aggregates INCLUDING DEFAULTS INCLUDING INDEXES\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP TABLE IF EXISTS stargazer_sketches_rebuild`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE stargazer_sketches_rebuild \(LIKE stargazer_sketches INCLUDING DEFAULTS INCLUDING INDEXES\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO hourly_aggregates_rebuild SELECT \* FROM hourly_aggregates WHERE hour >= \$1 AND hour < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE hourly_aggregates_rebuild SET stars = 0, flagged_stars = 0`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := repo.Prepare(context.Background(), window, []domain.Metric{domain.MetricStars})
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRebuildSwap(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewRebuildRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`LOCK TABLE hourly_aggregates, stargazer_sketches, stargazer_rollups, repo_totals, rollup_watermarks, ` +
+		`daily_aggregates, weekly_aggregates, monthly_aggregates IN SHARE ROW EXCLUSIVE MODE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM \(SELECT repo_id, MAX\(repo_name\) AS repo_name, SUM\(stars\) AS stars, .* FROM hourly_aggregates WHERE .*\) o `+
+		`FULL OUTER JOIN \(SELECT .* FROM hourly_aggregates_rebuild WHERE .*\) n ON n.repo_id = o.repo_id`).
+		WithArgs(window.From, window.To, window.From, window.To).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"repo_id", "repo_name",
+			"old_stars", "old_forks", "old_prs_opened", "old_prs_merged", "old_issues", "old_releases",
+			"new_stars", "new_forks", "new_prs_opened", "new_prs_merged", "new_issues", "new_releases",
+		}).AddRow(1, "org/a", 10, 2, 0, 0, 0, 0, 7, 2, 0, 0, 0, 0))
+	mock.ExpectExec(`DELETE FROM hourly_aggregates WHERE hour >= \$1 AND hour < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`INSERT INTO hourly_aggregates SELECT \* FROM hourly_aggregates_rebuild WHERE hour >= \$1 AND hour < \$2 `+
+		`AND \(flagged_stars <> 0 OR stars <> 0 OR forks <> 0 .*\)`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`DELETE FROM stargazer_sketches WHERE hour >= \$1 AND hour < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`INSERT INTO stargazer_sketches SELECT \* FROM stargazer_sketches_rebuild WHERE hour >= \$1 AND hour < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	// Свернуты только сутки диапазона, недели и месяцы еще нет
+	mock.ExpectQuery(`SELECT \* FROM "rollup_watermarks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"granularity", "compacted_until"}).
+			AddRow("day", from.Add(24*time.Hour)))
+	mock.ExpectExec(`DELETE FROM daily_aggregates WHERE bucket >= \$1 AND bucket < \$2`).
+		WithArgs(from, from.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO daily_aggregates \(repo_id, repo_name, bucket, stars, .*, flagged_stars, updated_at\) `+
+		`SELECT repo_id, MAX\(repo_name\), date_trunc\('day', hour, 'UTC'\), SUM\(stars\), .* FROM hourly_aggregates `+
+		`WHERE hour >= \$1 AND hour < \$2 GROUP BY repo_id, 3`).
+		WithArgs(from, from.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "stargazer_rollups"`).
+		WithArgs("day", from, from.Add(24*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches"`).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}).
+			AddRow(1, from, mustMarshal(t, sketchOf("a"))))
+	mock.ExpectExec(`INSERT INTO "stargazer_rollups"`).
+		WithArgs("day", int64(1), from, sqlmock.AnyArg(), int64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "repo_totals" .* ON CONFLICT \("repo_id"\) DO UPDATE SET `+
+		`"total_forks"=repo_totals.total_forks \+ excluded.total_forks,.*"updated_at"=excluded.updated_at`).
+		WithArgs(int64(1), "org/a", int64(-3), int64(0), int64(0), int64(0), int64(0), int64(0), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DROP TABLE IF EXISTS hourly_aggregates_rebuild, stargazer_sketches_rebuild`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	diffs, err := repo.Swap(context.Background(), window)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, int64(1), diffs[0].RepoID)
+	assert.Equal(t, int64(10), diffs[0].Old[domain.MetricStars])
+	assert.Equal(t, int64(-3), diffs[0].Delta(domain.MetricStars))
+	assert.Equal(t, int64(0), diffs[0].Delta(domain.MetricForks))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
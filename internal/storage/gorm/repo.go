@@ -2,20 +2,34 @@
 package gorm
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/kun1ts4/stars-analytics/internal/domain"
 	"github.com/kun1ts4/stars-analytics/internal/storage/models"
 	"github.com/kun1ts4/stars-analytics/pkg/pb/github.com/kun1ts4/stars-analytics/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// hourlyTable содержит часовые агрегаты.
+const hourlyTable = "hourly_aggregates"
+
+// insertChunkSize ограничивает число строк в одном INSERT, чтобы не превысить
+// лимит параметров запроса Postgres.
+const insertChunkSize = 1000
+
 // StatsRepo реализует domain.StatsRepo с использованием GORM.
 type StatsRepo struct {
 	db *gorm.DB
-	mu sync.Mutex
+	// partitions содержит дни уже созданных секций star_events.
+	partitions sync.Map
 }
 
 // NewStatsRepo создаёт новый репозиторий статистики.
@@ -23,50 +37,610 @@ func NewStatsRepo(db *gorm.DB) domain.StatsRepo {
 	return &StatsRepo{db: db}
 }
 
-// UpdateCounts обновляет счетчики для события.
+// UpdateCounts обновляет часовой и общий счетчики для одного события.
+// Событие с уже учтенным ID не меняет счетчики и возвращает domain.ErrDuplicateEvent.
 func (r *StatsRepo) UpdateCounts(event domain.Event) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	counted, err := r.UpdateCountsBatch([]domain.Event{event})
+	if err != nil {
+		return err
+	}
+	if counted == 0 {
+		return domain.ErrDuplicateEvent
+	}
+	return nil
+}
 
-	hourBucket := event.CreatedAt.Truncate(time.Hour)
+// UpdateCountsBatch учитывает пачку событий в одной транзакции: отбрасывает уже
+// учтенные ID, агрегирует оставшиеся в памяти и прибавляет суммы через
+// INSERT ... ON CONFLICT DO UPDATE. Учтенные звезды сохраняются в star_events.
+// Возвращает число учтенных событий.
+func (r *StatsRepo) UpdateCountsBatch(events []domain.Event) (int, error) {
+	events = uniqueEvents(events)
+	if len(events) == 0 {
+		return 0, nil
+	}
 
-	result := r.db.Model(&models.HourlyAggregate{}).
-		Where("repo_id = ? AND hour = ?", event.RepoID, hourBucket).
-		Update("stars", gorm.Expr("stars + ?", 1))
-	if result.Error != nil {
-		return fmt.Errorf("updating repo stars: %w", result.Error)
+	counted := 0
+	var partitions []time.Time
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		fresh, err := markProcessed(tx, events)
+		if err != nil {
+			return err
+		}
+		counted = len(fresh)
+		if counted == 0 {
+			return nil
+		}
+
+		hourly, totals := aggregate(fresh)
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "repo_id"}, {Name: "hour"}},
+			DoUpdates: counterAssignments(hourlyTable, "", flaggedColumn),
+		}).CreateInBatches(hourly, insertChunkSize).Error
+		if err != nil {
+			return fmt.Errorf("upserting hourly aggregates: %w", err)
+		}
+		hours := make([]time.Time, len(hourly))
+		for i, row := range hourly {
+			hours[i] = row.Hour
+		}
+		if err := markDirtyDays(tx, hours); err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "repo_id"}},
+			DoUpdates: counterAssignments("repo_totals", totalPrefix),
+		}).CreateInBatches(totals, insertChunkSize).Error
+		if err != nil {
+			return fmt.Errorf("upserting repo totals: %w", err)
+		}
+
+		if err := mergeStargazers(tx, stargazersTable, fresh); err != nil {
+			return err
+		}
+
+		partitions, err = r.saveStarEvents(tx, fresh)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+	r.rememberPartitions(partitions)
 
-	if result.RowsAffected == 0 {
-		r.db.Create(&models.HourlyAggregate{
-			RepoID:   event.RepoID,
-			RepoName: event.RepoName,
-			Stars:    1,
-			Hour:     hourBucket,
-		})
+	return counted, nil
+}
+
+// totalPrefix отличает колонки repo_totals от колонок hourly_aggregates.
+const totalPrefix = "total_"
+
+// metricColumns сопоставляет метрику с колонкой hourly_aggregates; колонка
+// repo_totals получается добавлением totalPrefix.
+var metricColumns = map[domain.Metric]string{
+	domain.MetricStars:        "stars",
+	domain.MetricForks:        "forks",
+	domain.MetricPRsOpened:    "pull_requests_opened",
+	domain.MetricPRsMerged:    "pull_requests_merged",
+	domain.MetricIssuesOpened: "issues_opened",
+	domain.MetricReleases:     "releases",
+}
+
+// flaggedColumn содержит число подозрительных звезд в hourly_aggregates.
+const flaggedColumn = "flagged_stars"
+
+// counterAssignments возвращает обновления для upsert, прибавляющие
+// счетчики метрик и колонки extra новой строки к существующим.
+func counterAssignments(table, prefix string, extra ...string) clause.Set {
+	updates := map[string]interface{}{
+		"repo_name":  gorm.Expr("excluded.repo_name"),
+		"updated_at": gorm.Expr("excluded.updated_at"),
+	}
+	columns := extra
+	for _, column := range metricColumns {
+		columns = append(columns, prefix+column)
+	}
+	for _, column := range columns {
+		updates[column] = gorm.Expr(fmt.Sprintf("%s.%s + excluded.%s", table, column, column))
+	}
+	return clause.Assignments(updates)
+}
+
+// uniqueEvents убирает повторы ID внутри пачки, сохраняя порядок.
+func uniqueEvents(events []domain.Event) []domain.Event {
+	seen := make(map[string]struct{}, len(events))
+	unique := make([]domain.Event, 0, len(events))
+	for _, event := range events {
+		if _, ok := seen[event.ID]; ok {
+			continue
+		}
+		seen[event.ID] = struct{}{}
+		unique = append(unique, event)
+	}
+	return unique
+}
+
+// FreshEvents возвращает события пачки, которые еще не были учтены.
+func (r *StatsRepo) FreshEvents(events []domain.Event) ([]domain.Event, error) {
+	processed := make(map[string]struct{})
+	for start := 0; start < len(events); start += insertChunkSize {
+		chunk := events[start:min(start+insertChunkSize, len(events))]
+
+		ids := make([]string, len(chunk))
+		for i, event := range chunk {
+			ids[i] = event.ID
+		}
+		var found []string
+		err := r.db.Raw("SELECT event_id FROM processed_events WHERE event_id IN ?", ids).Scan(&found).Error
+		if err != nil {
+			return nil, fmt.Errorf("getting processed events: %w", err)
+		}
+		for _, id := range found {
+			processed[id] = struct{}{}
+		}
+	}
+
+	fresh := make([]domain.Event, 0, len(events)-len(processed))
+	for _, event := range events {
+		if _, ok := processed[event.ID]; !ok {
+			fresh = append(fresh, event)
+		}
+	}
+	return fresh, nil
+}
+
+// markProcessed записывает ID событий в processed_events и возвращает только
+// те события, которые не были учтены ранее.
+func markProcessed(tx *gorm.DB, events []domain.Event) ([]domain.Event, error) {
+	now := time.Now().UTC()
+	inserted := make(map[string]struct{}, len(events))
+
+	for start := 0; start < len(events); start += insertChunkSize {
+		chunk := events[start:min(start+insertChunkSize, len(events))]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*3)
+		for i, event := range chunk {
+			placeholders[i] = "(?, ?, ?)"
+			args = append(args, event.ID, event.CreatedAt, now)
+		}
+
+		var ids []string
+		err := tx.Raw(
+			"INSERT INTO processed_events (event_id, event_created_at, processed_at) VALUES "+
+				strings.Join(placeholders, ", ")+
+				" ON CONFLICT DO NOTHING RETURNING event_id",
+			args...,
+		).Scan(&ids).Error
+		if err != nil {
+			return nil, fmt.Errorf("marking events processed: %w", err)
+		}
+		for _, id := range ids {
+			inserted[id] = struct{}{}
+		}
+	}
+
+	fresh := make([]domain.Event, 0, len(inserted))
+	for _, event := range events {
+		if _, ok := inserted[event.ID]; ok {
+			fresh = append(fresh, event)
+		}
+	}
+	return fresh, nil
+}
+
+// hourKey идентифицирует строку часового агрегата.
+type hourKey struct {
+	repoID int64
+	hour   time.Time
+}
+
+// aggregate суммирует события по (репозиторий, час) и по репозиторию.
+// События с действием, не соответствующим метрике, не учитываются.
+// Строки отсортированы по ключу, чтобы параллельные транзакции брали
+// блокировки в одном порядке.
+func aggregate(events []domain.Event) ([]models.HourlyAggregate, []models.RepoTotal) {
+	hourly := make(map[hourKey]*models.HourlyAggregate)
+	totals := make(map[int64]*models.RepoTotal)
+
+	for _, event := range events {
+		metric, ok := event.Action.Metric()
+		if !ok {
+			continue
+		}
+
+		key := hourKey{repoID: event.RepoID, hour: event.CreatedAt.UTC().Truncate(time.Hour)}
+		agg, ok := hourly[key]
+		if !ok {
+			agg = &models.HourlyAggregate{RepoID: key.repoID, Hour: key.hour}
+			hourly[key] = agg
+		}
+		agg.RepoName = event.RepoName
+
+		total, ok := totals[event.RepoID]
+		if !ok {
+			total = &models.RepoTotal{RepoID: event.RepoID}
+			totals[event.RepoID] = total
+		}
+		total.RepoName = event.RepoName
+
+		increment(agg, total, metric)
+		if event.Flagged && metric == domain.MetricStars {
+			agg.FlaggedStars++
+		}
+	}
+
+	hourlyRows := make([]models.HourlyAggregate, 0, len(hourly))
+	for _, agg := range hourly {
+		hourlyRows = append(hourlyRows, *agg)
+	}
+	sort.Slice(hourlyRows, func(i, j int) bool {
+		if hourlyRows[i].RepoID != hourlyRows[j].RepoID {
+			return hourlyRows[i].RepoID < hourlyRows[j].RepoID
+		}
+		return hourlyRows[i].Hour.Before(hourlyRows[j].Hour)
+	})
+
+	totalRows := make([]models.RepoTotal, 0, len(totals))
+	for _, total := range totals {
+		totalRows = append(totalRows, *total)
+	}
+	sort.Slice(totalRows, func(i, j int) bool {
+		return totalRows[i].RepoID < totalRows[j].RepoID
+	})
+
+	return hourlyRows, totalRows
+}
+
+// increment увеличивает счетчики метрики в часовом агрегате и итогах.
+func increment(agg *models.HourlyAggregate, total *models.RepoTotal, metric domain.Metric) {
+	switch metric {
+	case domain.MetricStars:
+		agg.Stars++
+		total.TotalStars++
+	case domain.MetricForks:
+		agg.Forks++
+		total.TotalForks++
+	case domain.MetricPRsOpened:
+		agg.PullRequestsOpened++
+		total.TotalPullRequestsOpened++
+	case domain.MetricPRsMerged:
+		agg.PullRequestsMerged++
+		total.TotalPullRequestsMerged++
+	case domain.MetricIssuesOpened:
+		agg.IssuesOpened++
+		total.TotalIssuesOpened++
+	case domain.MetricReleases:
+		agg.Releases++
+		total.TotalReleases++
+	}
+}
+
+// SaveSpamFlags помечает звезды, признанные подозрительными задним числом, в star_events,
+// прибавляет их к flagged_stars часовых агрегатов и сохраняет подозрительные аккаунты.
+// Учитываются только сохраненные и еще не помеченные звезды, а уже свернутые сутки
+// отмечаются для повторной свертки.
+func (r *StatsRepo) SaveSpamFlags(stars []domain.StarFlag, actors []domain.ActorFlag) error {
+	if len(stars) == 0 && len(actors) == 0 {
+		return nil
+	}
+
+	suspicious := make([]models.SuspiciousActor, len(actors))
+	for i, actor := range actors {
+		suspicious[i] = models.SuspiciousActor{
+			Login:          actor.Login,
+			Reason:         string(actor.Reason),
+			FlaggedStars:   int64(actor.Stars),
+			FirstFlaggedAt: actor.FlaggedAt.UTC(),
+			LastFlaggedAt:  actor.FlaggedAt.UTC(),
+		}
+	}
+	sort.Slice(suspicious, func(i, j int) bool { return suspicious[i].Login < suspicious[j].Login })
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		flagged, err := flagStarEvents(tx, stars)
+		if err != nil {
+			return err
+		}
+		if err := addFlaggedStars(tx, hourlyTable, flagged); err != nil {
+			return err
+		}
+		hours := make([]time.Time, len(flagged))
+		for i, flag := range flagged {
+			hours[i] = flag.Hour
+		}
+		if err := markDirtyDays(tx, hours); err != nil {
+			return err
+		}
+
+		if len(suspicious) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "login"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"reason":          gorm.Expr("excluded.reason"),
+					"flagged_stars":   gorm.Expr("suspicious_actors.flagged_stars + excluded.flagged_stars"),
+					"last_flagged_at": gorm.Expr("GREATEST(suspicious_actors.last_flagged_at, excluded.last_flagged_at)"),
+				}),
+			}).CreateInBatches(suspicious, insertChunkSize).Error
+			if err != nil {
+				return fmt.Errorf("saving suspicious actors: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// flagStarEvents помечает звезды stars в star_events и возвращает помеченные
+// звезды по часам. Звезды, которых нет в star_events или которые уже помечены,
+// пропускаются, чтобы flagged_stars не превышал учтенные звезды.
+func flagStarEvents(tx *gorm.DB, stars []domain.StarFlag) ([]domain.StarFlag, error) {
+	var ids []string
+	var from, to time.Time
+	for _, flag := range stars {
+		ids = append(ids, flag.EventIDs...)
+		hour := flag.Hour.UTC()
+		if from.IsZero() || hour.Before(from) {
+			from = hour
+		}
+		if hour.Add(time.Hour).After(to) {
+			to = hour.Add(time.Hour)
+		}
+	}
+
+	counts := make(map[hourKey]*domain.StarFlag)
+	for start := 0; start < len(ids); start += insertChunkSize {
+		chunk := ids[start:min(start+insertChunkSize, len(ids))]
+
+		var rows []models.StarEvent
+		// Границы по created_at ограничивают обновление секциями часов флагов.
+		err := tx.Raw(
+			"UPDATE "+starEventsTable+" SET flagged = true"+
+				" WHERE event_id IN ? AND created_at >= ? AND created_at < ? AND NOT flagged"+
+				" RETURNING repo_id, repo_name, created_at",
+			chunk, from, to,
+		).Scan(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("flagging star events: %w", err)
+		}
+		for _, row := range rows {
+			key := hourKey{repoID: row.RepoID, hour: row.CreatedAt.UTC().Truncate(time.Hour)}
+			flag := counts[key]
+			if flag == nil {
+				flag = &domain.StarFlag{RepoID: row.RepoID, RepoName: row.RepoName, Hour: key.hour}
+				counts[key] = flag
+			}
+			flag.Stars++
+		}
+	}
+
+	flagged := make([]domain.StarFlag, 0, len(counts))
+	for _, flag := range counts {
+		flagged = append(flagged, *flag)
 	}
+	sort.Slice(flagged, func(i, j int) bool {
+		if flagged[i].RepoID != flagged[j].RepoID {
+			return flagged[i].RepoID < flagged[j].RepoID
+		}
+		return flagged[i].Hour.Before(flagged[j].Hour)
+	})
+	return flagged, nil
+}
 
+// addFlaggedStars прибавляет звезды stars к flagged_stars часовых агрегатов таблицы table.
+func addFlaggedStars(tx *gorm.DB, table string, stars []domain.StarFlag) error {
+	if len(stars) == 0 {
+		return nil
+	}
+
+	hourly := make([]models.HourlyAggregate, len(stars))
+	for i, flag := range stars {
+		hourly[i] = models.HourlyAggregate{
+			RepoID:       flag.RepoID,
+			RepoName:     flag.RepoName,
+			Hour:         flag.Hour.UTC(),
+			FlaggedStars: flag.Stars,
+		}
+	}
+	sort.Slice(hourly, func(i, j int) bool {
+		if hourly[i].RepoID != hourly[j].RepoID {
+			return hourly[i].RepoID < hourly[j].RepoID
+		}
+		return hourly[i].Hour.Before(hourly[j].Hour)
+	})
+
+	err := tx.Table(table).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "repo_id"}, {Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			flaggedColumn: gorm.Expr(fmt.Sprintf("%s.%s + excluded.%s", table, flaggedColumn, flaggedColumn)),
+			"updated_at":  gorm.Expr("excluded.updated_at"),
+		}),
+	}).CreateInBatches(hourly, insertChunkSize).Error
+	if err != nil {
+		return fmt.Errorf("flagging stars: %w", err)
+	}
 	return nil
 }
 
-// GetTopN возвращает топ N репозиториев.
-func (r *StatsRepo) GetTopN(count int) ([]*proto.Repo, error) {
-	hourBucket := time.Now().UTC().Add(time.Hour * -1).Truncate(time.Hour)
+// PruneProcessedEvents удаляет записи дедупликации событий, созданных и
+// учтенных раньше before. Запись события, повторно загруженного backfill, хранится
+// не меньше срока хранения после последнего учета, даже если событие старое.
+func (r *StatsRepo) PruneProcessedEvents(before time.Time) (int64, error) {
+	result := r.db.Where("processed_at < ? AND event_created_at < ?", before, before).
+		Delete(&models.ProcessedEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("pruning processed events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// topRow представляет строку результата запроса топа репозиториев.
+type topRow struct {
+	RepoID       int64
+	RepoName     string
+	Stars        int64
+	FlaggedStars int64
+	TotalStars   int64
+	Count        int64
+	TotalCount   int64
+}
+
+// GetTopN возвращает топ N репозиториев по сумме метрики metric за окно window.
+// Свернутые сутки, недели и месяцы окна читаются из сверток.
+// Репозитории без событий метрики в окне не попадают в топ. Политика spam меняет
+// вклад подозрительных звезд в звезды окна и, для метрики звезд, в значение метрики.
+func (r *StatsRepo) GetTopN(
+	count int,
+	window domain.TimeRange,
+	metric domain.Metric,
+	spam domain.SpamPolicy,
+) ([]*proto.Repo, error) {
+	column, ok := metricColumns[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric: %s", metric)
+	}
 
-	var aggregates []models.HourlyAggregate
-	result := r.db.Where("hour = ?", hourBucket).Limit(count).Order("stars desc").Find(&aggregates)
+	stars := "SUM(h.stars)"
+	if discount := 1 - spam.FlaggedWeight(); discount > 0 {
+		stars = fmt.Sprintf("GREATEST(ROUND(SUM(h.stars) - SUM(h.%s) * %s), 0)",
+			flaggedColumn, strconv.FormatFloat(discount, 'f', -1, 64))
+	}
+	countExpr := fmt.Sprintf("SUM(h.%s)", column)
+	if metric == domain.MetricStars {
+		countExpr = stars
+	}
+
+	segments, err := planQuery(r.db, window, topRollups)
+	if err != nil {
+		return nil, err
+	}
+	query := r.db.Table("hourly_aggregates AS h").Where("h.hour >= ? AND h.hour < ?", window.From, window.To)
+	if len(segments) > 1 || segments[0].granularity != domain.GranularityHour {
+		source, args := segmentsSource(segments)
+		query = r.db.Table(source, args...)
+	}
+
+	var rows []topRow
+	result := query.
+		Select(fmt.Sprintf("h.repo_id AS repo_id, MAX(h.repo_name) AS repo_name, "+
+			"%[3]s AS stars, SUM(h.%[5]s) AS flagged_stars, "+
+			"COALESCE(MAX(t.total_stars), 0) AS total_stars, %[4]s AS count, "+
+			"COALESCE(MAX(t.%[2]s%[1]s), 0) AS total_count", column, totalPrefix, stars, countExpr, flaggedColumn)).
+		Joins("LEFT JOIN repo_totals AS t ON t.repo_id = h.repo_id").
+		Group("h.repo_id").
+		Having(countExpr + " > 0").
+		Order("count desc").
+		Limit(count).
+		Scan(&rows)
 	if result.Error != nil {
 		return nil, fmt.Errorf("getting top n: %w", result.Error)
 	}
 
-	repos := make([]*proto.Repo, len(aggregates))
-	for i, agg := range aggregates {
+	repoIDs := make([]int64, len(rows))
+	for i, row := range rows {
+		repoIDs[i] = row.RepoID
+	}
+	uniques, err := uniqueStargazers(r.db, repoIDs, segments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сумма звезд окна отрицательна, если снятых звезд больше поставленных.
+	repos := make([]*proto.Repo, len(rows))
+	for i, row := range rows {
 		repos[i] = &proto.Repo{
-			Name:          agg.RepoName,
-			StarsLastHour: uint64(agg.Stars),
-			TotalStars:    10000, // TODO total
+			Name:             row.RepoName,
+			WindowStars:      uint64(max(row.Stars, 0)),
+			TotalStars:       uint64(row.TotalStars),
+			WindowCount:      uint64(row.Count),
+			TotalCount:       uint64(row.TotalCount),
+			FlaggedStars:     uint64(row.FlaggedStars),
+			UniqueStargazers: uniques[row.RepoID],
 		}
 	}
 
 	return repos, nil
 }
+
+// GetTimeSeries возвращает временной ряд звезд репозитория с нулями в пустых корзинах.
+// Корзины, вложенные в свернутые сутки, недели или месяцы, читаются из сверток.
+func (r *StatsRepo) GetTimeSeries(
+	ref domain.RepoRef,
+	window domain.TimeRange,
+	granularity domain.Granularity,
+) (*proto.TimeSeriesResponse, error) {
+	total, err := r.findRepo(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	window = window.Align(granularity)
+
+	segments, err := planQuery(r.db, window, seriesRollups[granularity])
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[time.Time]uint64)
+	for _, s := range segments {
+		if s.granularity == domain.GranularityHour {
+			var aggregates []models.HourlyAggregate
+			result := r.db.Select("hour", "stars").
+				Where("repo_id = ? AND hour >= ? AND hour < ?", total.RepoID, s.window.From, s.window.To).
+				Order("hour").
+				Find(&aggregates)
+			if result.Error != nil {
+				return nil, fmt.Errorf("getting time series: %w", result.Error)
+			}
+			for _, agg := range aggregates {
+				sums[granularity.Truncate(agg.Hour)] += uint64(agg.Stars)
+			}
+			continue
+		}
+
+		var rollups []models.RollupAggregate
+		result := r.db.Table(s.table()).Select("bucket", "stars").
+			Where("repo_id = ? AND bucket >= ? AND bucket < ?", total.RepoID, s.window.From, s.window.To).
+			Order("bucket").
+			Find(&rollups)
+		if result.Error != nil {
+			return nil, fmt.Errorf("getting time series: %w", result.Error)
+		}
+		for _, rollup := range rollups {
+			sums[granularity.Truncate(rollup.Bucket)] += uint64(rollup.Stars)
+		}
+	}
+
+	points := make([]*proto.TimeSeriesPoint, 0, window.Buckets(granularity))
+	for bucket := window.From; bucket.Before(window.To); bucket = granularity.Next(bucket) {
+		points = append(points, &proto.TimeSeriesPoint{
+			Bucket: timestamppb.New(bucket),
+			Stars:  sums[bucket],
+		})
+	}
+
+	return &proto.TimeSeriesResponse{
+		RepoId: total.RepoID,
+		Name:   total.RepoName,
+		Points: points,
+	}, nil
+}
+
+// findRepo находит репозиторий по ID или по последнему известному имени.
+func (r *StatsRepo) findRepo(ref domain.RepoRef) (*models.RepoTotal, error) {
+	query := r.db.Model(&models.RepoTotal{})
+	if ref.ID != 0 {
+		query = query.Where("repo_id = ?", ref.ID)
+	} else {
+		query = query.Where("repo_name = ?", ref.Name).Order("updated_at desc")
+	}
+
+	var total models.RepoTotal
+	if err := query.Take(&total).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrRepoNotFound
+		}
+		return nil, fmt.Errorf("finding repo: %w", err)
+	}
+
+	return &total, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/pkg/hll"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
@@ -24,6 +25,20 @@ func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
 	return gormDB, mock
 }
 
+func mustMarshal(t *testing.T, sketch *hll.Sketch) []byte {
+	data, err := sketch.MarshalBinary()
+	require.NoError(t, err)
+	return data
+}
+
+func sketchOf(logins ...string) *hll.Sketch {
+	sketch := hll.New()
+	for _, login := range logins {
+		sketch.Add(login)
+	}
+	return sketch
+}
+
 func TestNewStatsRepo(t *testing.T) {
 	db, _ := setupTestDB(t)
 	repo := NewStatsRepo(db)
@@ -45,18 +60,52 @@ func TestUpdateCounts_NewRecord(t *testing.T) {
 
 	hourBucket := event.CreatedAt.Truncate(time.Hour)
 
-	// Ожидаем UPDATE который не найдет записей (GORM добавляет updated_at)
 	mock.ExpectBegin()
-	mock.ExpectExec(`UPDATE "hourly_aggregates"`).
-		WithArgs(1, sqlmock.AnyArg(), 1, hourBucket).
+	mock.ExpectQuery(`INSERT INTO processed_events .* ON CONFLICT DO NOTHING RETURNING event_id`).
+		WithArgs(event.ID, event.CreatedAt, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow(event.ID))
+
+	// Часовой агрегат прибавляется через upsert
+	mock.ExpectQuery(`INSERT INTO "hourly_aggregates" .* ON CONFLICT \("repo_id","hour"\) DO UPDATE SET `+
+		`"flagged_stars"=hourly_aggregates.flagged_stars \+ excluded.flagged_stars,`+
+		`"forks"=hourly_aggregates.forks \+ excluded.forks,.*`+
+		`"repo_name"=excluded.repo_name,"stars"=hourly_aggregates.stars \+ excluded.stars`).
+		WithArgs(event.RepoID, event.RepoName, 1, 0, 0, 0, 0, 0, 0, hourBucket, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	// Сутки часа отмечаются для повторной свертки, если уже свернуты
+	mock.ExpectExec(`INSERT INTO rollup_dirty_days \(day, marked_at\) SELECT .* FROM \(VALUES \(\$1::timestamptz\)\) AS v\(day\) ` +
+		`JOIN rollup_watermarks AS w ON w.granularity = 'day' AND v.day < w.compacted_until ON CONFLICT \(day\) DO NOTHING`).
+		WithArgs(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).
 		WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectCommit()
 
-	// Ожидаем INSERT новой записи
-	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO "hourly_aggregates"`).
-		WithArgs(event.RepoID, event.RepoName, 1, hourBucket, sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	// Общий счетчик увеличивается в той же транзакции
+	mock.ExpectExec(`INSERT INTO "repo_totals" .* ON CONFLICT \("repo_id"\) DO UPDATE SET `+
+		`"repo_name"=excluded.repo_name,.*"total_stars"=repo_totals.total_stars \+ excluded.total_stars`).
+		WithArgs(event.RepoID, event.RepoName, 1, 0, 0, 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Счетчик уникальных аккаунтов объединяется с сохраненным
+	stored, merged := hll.New(), hll.New()
+	stored.Add("other")
+	merged.Add("other")
+	merged.Add(event.ActorLogin)
+	mock.ExpectQuery(`SELECT \* FROM "stargazer_sketches" WHERE \(repo_id, hour\) IN \(\(\$1,\$2\)\)`).
+		WithArgs(event.RepoID, hourBucket).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "hour", "sketch", "uniques"}).
+			AddRow(event.RepoID, hourBucket, mustMarshal(t, stored), 1))
+	mock.ExpectExec(`INSERT INTO "stargazer_sketches" .* ON CONFLICT \("repo_id","hour"\) DO UPDATE SET `+
+		`"sketch"="excluded"."sketch","uniques"="excluded"."uniques"`).
+		WithArgs(event.RepoID, hourBucket, mustMarshal(t, merged), int64(2), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Звезда сохраняется в дневную секцию star_events
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS star_events_p20240101 PARTITION OF star_events ` +
+		`FOR VALUES FROM \('2024-01-01T00:00:00Z'\) TO \('2024-01-02T00:00:00Z'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "star_events" .* ON CONFLICT DO NOTHING`).
+		WithArgs(event.ID, event.RepoID, event.RepoName, event.ActorLogin, event.CreatedAt, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	err := repo.UpdateCounts(event)
@@ -65,30 +114,28 @@ func TestUpdateCounts_NewRecord(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestUpdateCounts_ExistingRecord(t *testing.T) {
+func TestUpdateCounts_DuplicateEvent(t *testing.T) {
 	db, mock := setupTestDB(t)
 	repo := NewStatsRepo(db)
 
-	hourBucket := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
-
 	event := domain.Event{
-		ID:         "456",
+		ID:         "123",
 		Action:     domain.ActionStarred,
 		RepoID:     1,
 		RepoName:   "test/repo",
-		ActorLogin: "user2",
-		CreatedAt:  hourBucket.Add(30 * time.Minute),
+		ActorLogin: "user",
+		CreatedAt:  time.Date(2024, 1, 1, 15, 30, 0, 0, time.UTC),
 	}
 
-	// Ожидаем UPDATE который обновит 1 запись (GORM добавляет updated_at)
+	// Событие уже учтено: счетчики не трогаем
 	mock.ExpectBegin()
-	mock.ExpectExec(`UPDATE "hourly_aggregates"`).
-		WithArgs(1, sqlmock.AnyArg(), 1, hourBucket).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO processed_events`).
+		WithArgs(event.ID, event.CreatedAt, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}))
 	mock.ExpectCommit()
 
 	err := repo.UpdateCounts(event)
-	require.NoError(t, err)
+	assert.ErrorIs(t, err, domain.ErrDuplicateEvent)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -105,12 +152,39 @@ func TestUpdateCounts_DatabaseError(t *testing.T) {
 		CreatedAt:  time.Now(),
 	}
 
-	hourBucket := event.CreatedAt.Truncate(time.Hour)
+	// Симулируем ошибку базы данных
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO processed_events`).
+		WillReturnError(gorm.ErrInvalidDB)
+	mock.ExpectRollback()
+
+	err := repo.UpdateCounts(event)
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateCounts_TotalsError(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	event := domain.Event{
+		ID:         "789",
+		Action:     domain.ActionStarred,
+		RepoID:     1,
+		RepoName:   "test/repo",
+		ActorLogin: "user3",
+		CreatedAt:  time.Date(2024, 1, 1, 15, 10, 0, 0, time.UTC),
+	}
 
-	// Симулируем ошибку базы данных (GORM добавляет updated_at)
+	// Ошибка при обновлении общего счетчика откатывает и часовой агрегат
 	mock.ExpectBegin()
-	mock.ExpectExec(`UPDATE "hourly_aggregates"`).
-		WithArgs(1, sqlmock.AnyArg(), 1, hourBucket).
+	mock.ExpectQuery(`INSERT INTO processed_events`).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow(event.ID))
+	mock.ExpectQuery(`INSERT INTO "hourly_aggregates"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO rollup_dirty_days`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "repo_totals"`).
 		WillReturnError(gorm.ErrInvalidDB)
 	mock.ExpectRollback()
 
@@ -120,34 +194,223 @@ func TestUpdateCounts_DatabaseError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUpdateCountsBatch_Aggregates(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	hour := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	events := []domain.Event{
+		{ID: "1", Action: domain.ActionStarred, RepoID: 2, RepoName: "org/b", CreatedAt: hour.Add(time.Minute)},
+		{ID: "2", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", CreatedAt: hour.Add(2 * time.Minute)},
+		{ID: "2", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", CreatedAt: hour.Add(2 * time.Minute)},
+		{ID: "3", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", CreatedAt: hour.Add(3 * time.Minute),
+			Flagged: true},
+		{ID: "4", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", CreatedAt: hour.Add(61 * time.Minute)},
+		{ID: "5", Action: domain.ActionStarred, RepoID: 2, RepoName: "org/b", CreatedAt: hour.Add(4 * time.Minute)},
+	}
+
+	// Повтор "2" внутри пачки отбрасывается до запроса, "5" уже учтен ранее
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO processed_events .* VALUES \(\$1, \$2, \$3\), .* \(\$13, \$14, \$15\) ON CONFLICT`).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).
+			AddRow("1").AddRow("2").AddRow("3").AddRow("4"))
+
+	// Строки отсортированы по (repo_id, hour) и уже просуммированы
+	mock.ExpectQuery(`INSERT INTO "hourly_aggregates"`).
+		WithArgs(
+			int64(1), "org/a", 2, 0, 0, 0, 0, 0, 1, hour, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			int64(1), "org/a", 1, 0, 0, 0, 0, 0, 0, hour.Add(time.Hour), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			int64(2), "org/b", 1, 0, 0, 0, 0, 0, 0, hour, sqlmock.AnyArg(), sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectExec(`INSERT INTO rollup_dirty_days`).
+		WithArgs(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "repo_totals"`).
+		WithArgs(
+			int64(1), "org/a", int64(3), int64(0), int64(0), int64(0), int64(0), int64(0),
+			sqlmock.AnyArg(), sqlmock.AnyArg(),
+			int64(2), "org/b", int64(1), int64(0), int64(0), int64(0), int64(0), int64(0),
+			sqlmock.AnyArg(), sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS star_events_p20240101 PARTITION OF star_events`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "star_events"`).
+		WithArgs(
+			"1", int64(2), "org/b", "", hour.Add(time.Minute), false,
+			"2", int64(1), "org/a", "", hour.Add(2*time.Minute), false,
+			"3", int64(1), "org/a", "", hour.Add(3*time.Minute), true,
+			"4", int64(1), "org/a", "", hour.Add(61*time.Minute), false,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	counted, err := repo.UpdateCountsBatch(events)
+	require.NoError(t, err)
+	assert.Equal(t, 4, counted)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAggregate_Metrics(t *testing.T) {
+	hour := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	events := []domain.Event{
+		{ID: "1", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", CreatedAt: hour},
+		{ID: "2", Action: domain.ActionForked, RepoID: 1, RepoName: "org/a", CreatedAt: hour},
+		{ID: "3", Action: domain.ActionPRMerged, RepoID: 1, RepoName: "org/a", CreatedAt: hour},
+		{ID: "4", Action: domain.ActionReleasePublished, RepoID: 1, RepoName: "org/a", CreatedAt: hour},
+		{ID: "5", Action: "pushed", RepoID: 1, RepoName: "org/a", CreatedAt: hour},
+	}
+
+	hourly, totals := aggregate(events)
+
+	require.Len(t, hourly, 1)
+	assert.Equal(t, 1, hourly[0].Stars)
+	assert.Equal(t, 1, hourly[0].Forks)
+	assert.Equal(t, 1, hourly[0].PullRequestsMerged)
+	assert.Equal(t, 0, hourly[0].PullRequestsOpened)
+	assert.Equal(t, 1, hourly[0].Releases)
+
+	require.Len(t, totals, 1)
+	assert.Equal(t, int64(1), totals[0].TotalForks)
+	assert.Equal(t, int64(1), totals[0].TotalReleases)
+}
+
+func TestPruneProcessedEvents(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "processed_events" WHERE processed_at < \$1 AND event_created_at < \$2`).
+		WithArgs(before, before).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectCommit()
+
+	deleted, err := repo.PruneProcessedEvents(before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), deleted)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFreshEvents(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	mock.ExpectQuery(`SELECT event_id FROM processed_events WHERE event_id IN \(\$1,\$2,\$3\)`).
+		WithArgs("a", "b", "c").
+		WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow("b"))
+
+	fresh, err := repo.FreshEvents([]domain.Event{{ID: "a"}, {ID: "b"}, {ID: "c"}})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Event{{ID: "a"}, {ID: "c"}}, fresh)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveSpamFlags(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	hour := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	flaggedAt := hour.Add(12 * time.Minute)
+
+	mock.ExpectBegin()
+	// Звезда e5 уже помечена, поэтому не возвращается и не учитывается повторно
+	mock.ExpectQuery(`UPDATE star_events SET flagged = true WHERE event_id IN \(\$1,\$2,\$3,\$4,\$5\) `+
+		`AND created_at >= \$6 AND created_at < \$7 AND NOT flagged RETURNING repo_id, repo_name, created_at`).
+		WithArgs("e4", "e5", "e1", "e2", "e3", hour, hour.Add(2*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "repo_name", "created_at"}).
+			AddRow(2, "org/b", hour.Add(65*time.Minute)).
+			AddRow(1, "org/a", hour.Add(time.Minute)).
+			AddRow(1, "org/a", hour.Add(2*time.Minute)).
+			AddRow(1, "org/a", hour.Add(3*time.Minute)))
+	mock.ExpectQuery(`INSERT INTO "hourly_aggregates" .* ON CONFLICT \("repo_id","hour"\) DO UPDATE SET `+
+		`"flagged_stars"=hourly_aggregates.flagged_stars \+ excluded.flagged_stars,"updated_at"=excluded.updated_at`).
+		WithArgs(
+			int64(1), "org/a", 0, 0, 0, 0, 0, 0, 3, hour, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			int64(2), "org/b", 0, 0, 0, 0, 0, 0, 1, hour.Add(time.Hour), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	// Свернутые сутки помеченных звезд сворачиваются заново
+	mock.ExpectExec(`INSERT INTO rollup_dirty_days`).
+		WithArgs(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "suspicious_actors" .* ON CONFLICT \("login"\) DO UPDATE SET `+
+		`"flagged_stars"=suspicious_actors.flagged_stars \+ excluded.flagged_stars,`+
+		`"last_flagged_at"=GREATEST\(suspicious_actors.last_flagged_at, excluded.last_flagged_at\),`+
+		`"reason"=excluded.reason`).
+		WithArgs("farmer", "actor_burst", int64(4), flaggedAt, flaggedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.SaveSpamFlags(
+		[]domain.StarFlag{
+			{RepoID: 2, RepoName: "org/b", Hour: hour.Add(time.Hour), Stars: 2, EventIDs: []string{"e4", "e5"}},
+			{RepoID: 1, RepoName: "org/a", Hour: hour, Stars: 3, EventIDs: []string{"e1", "e2", "e3"}},
+		},
+		[]domain.ActorFlag{{Login: "farmer", Reason: domain.SpamReasonActorBurst, Stars: 4, FlaggedAt: flaggedAt}},
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.SaveSpamFlags(nil, nil))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetTopN(t *testing.T) {
 	db, mock := setupTestDB(t)
 	repo := NewStatsRepo(db)
 
-	hourBucket := time.Now().UTC().Add(time.Hour * -1).Truncate(time.Hour)
+	// Окно не содержит целых суток, поэтому свертки не читаются
+	window := domain.LastHours(time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC), 24)
 
-	rows := sqlmock.NewRows([]string{"id", "repo_id", "repo_name", "stars", "hour", "created_at", "updated_at"}).
-		AddRow(1, 2, "repo2/test", 200, hourBucket, time.Now(), time.Now()).
-		AddRow(2, 4, "repo4/test", 150, hourBucket, time.Now(), time.Now()).
-		AddRow(3, 1, "repo1/test", 100, hourBucket, time.Now(), time.Now())
+	rows := sqlmock.NewRows([]string{"repo_name", "stars", "total_stars", "count", "total_count", "repo_id"}).
+		AddRow("repo2/test", 200, 5200, 200, 5200, 2).
+		AddRow("repo4/test", 150, 150, 150, 150, 4).
+		AddRow("repo1/test", 100, 98000, 100, 98000, 1)
 
-	mock.ExpectQuery(`SELECT \* FROM "hourly_aggregates"`).
-		WithArgs(hourBucket, 3).
+	mock.ExpectQuery(`SELECT .* FROM hourly_aggregates AS h LEFT JOIN repo_totals AS t .* `+
+		`WHERE h.hour >= \$1 AND h.hour < \$2 GROUP BY "h"."repo_id" HAVING SUM\(h.stars\) > 0 `+
+		`ORDER BY count desc LIMIT \$3`).
+		WithArgs(window.From, window.To, 3).
 		WillReturnRows(rows)
 
-	repos, err := repo.GetTopN(3)
+	// Часовые счетчики уникальных аккаунтов объединяются по окну
+	first, second := hll.New(), hll.New()
+	first.Add("alice")
+	first.Add("bob")
+	second.Add("bob")
+	second.Add("carol")
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches" `+
+		`WHERE \(hour >= \$1 AND hour < \$2\) AND repo_id IN \(\$3,\$4,\$5\)`).
+		WithArgs(window.From, window.To, int64(2), int64(4), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "sketch"}).
+			AddRow(2, mustMarshal(t, first)).
+			AddRow(2, mustMarshal(t, second)).
+			AddRow(1, mustMarshal(t, second)))
+
+	repos, err := repo.GetTopN(3, window, domain.MetricStars, domain.SpamPolicy{})
 	require.NoError(t, err)
 	require.Len(t, repos, 3)
 
 	// Проверяем данные
 	assert.Equal(t, "repo2/test", repos[0].Name)
-	assert.Equal(t, uint64(200), repos[0].StarsLastHour)
+	assert.Equal(t, uint64(200), repos[0].WindowStars)
+	assert.Equal(t, uint64(5200), repos[0].TotalStars)
+	assert.Equal(t, uint64(3), repos[0].UniqueStargazers)
 
 	assert.Equal(t, "repo4/test", repos[1].Name)
-	assert.Equal(t, uint64(150), repos[1].StarsLastHour)
+	assert.Equal(t, uint64(150), repos[1].WindowStars)
 
 	assert.Equal(t, "repo1/test", repos[2].Name)
-	assert.Equal(t, uint64(100), repos[2].StarsLastHour)
+	assert.Equal(t, uint64(100), repos[2].WindowStars)
+	assert.Equal(t, uint64(98000), repos[2].TotalStars)
+	assert.Equal(t, uint64(2), repos[2].UniqueStargazers)
+	assert.Zero(t, repos[1].UniqueStargazers)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -156,17 +419,15 @@ func TestGetTopN_EmptyResult(t *testing.T) {
 	db, mock := setupTestDB(t)
 	repo := NewStatsRepo(db)
 
-	hourBucket := time.Now().UTC().Add(time.Hour * -1).Truncate(time.Hour)
+	window := domain.LastHours(time.Now(), 1)
 
-	rows := sqlmock.NewRows(
-		[]string{"id", "repo_id", "repo_name", "stars", "hour", "created_at", "updated_at"},
-	)
+	rows := sqlmock.NewRows([]string{"repo_name", "stars", "total_stars", "count", "total_count"})
 
-	mock.ExpectQuery(`SELECT \* FROM "hourly_aggregates"`).
-		WithArgs(hourBucket, 10).
+	mock.ExpectQuery(`SELECT .* FROM hourly_aggregates AS h LEFT JOIN repo_totals AS t`).
+		WithArgs(window.From, window.To, 10).
 		WillReturnRows(rows)
 
-	repos, err := repo.GetTopN(10)
+	repos, err := repo.GetTopN(10, window, domain.MetricStars, domain.SpamPolicy{})
 	require.NoError(t, err)
 	assert.Empty(t, repos)
 
@@ -177,15 +438,165 @@ func TestGetTopN_DatabaseError(t *testing.T) {
 	db, mock := setupTestDB(t)
 	repo := NewStatsRepo(db)
 
-	hourBucket := time.Now().UTC().Add(time.Hour * -1).Truncate(time.Hour)
+	window := domain.LastHours(time.Now(), 1)
 
-	mock.ExpectQuery(`SELECT \* FROM "hourly_aggregates"`).
-		WithArgs(hourBucket, 10).
+	mock.ExpectQuery(`SELECT .* FROM hourly_aggregates AS h LEFT JOIN repo_totals AS t`).
+		WithArgs(window.From, window.To, 10).
 		WillReturnError(gorm.ErrInvalidDB)
 
-	repos, err := repo.GetTopN(10)
+	repos, err := repo.GetTopN(10, window, domain.MetricStars, domain.SpamPolicy{})
 	assert.Error(t, err)
 	assert.Nil(t, repos)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestGetTopN_ByMetric(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	window := domain.LastHours(time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC), 24)
+
+	rows := sqlmock.NewRows([]string{"repo_name", "stars", "total_stars", "count", "total_count", "repo_id"}).
+		AddRow("repo1/test", 3, 98000, 40, 1200, 1)
+
+	mock.ExpectQuery(`SELECT .*SUM\(h.forks\) AS count, COALESCE\(MAX\(t.total_forks\), 0\) AS total_count `+
+		`FROM hourly_aggregates AS h .* HAVING SUM\(h.forks\) > 0 ORDER BY count desc`).
+		WithArgs(window.From, window.To, 5).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches"`).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "sketch"}))
+
+	repos, err := repo.GetTopN(5, window, domain.MetricForks, domain.SpamPolicy{})
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, uint64(40), repos[0].WindowCount)
+	assert.Equal(t, uint64(1200), repos[0].TotalCount)
+	assert.Equal(t, uint64(3), repos[0].WindowStars)
+
+	_, err = repo.GetTopN(5, window, "unknown", domain.SpamPolicy{})
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTopN_DiscountsFlaggedStars(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	window := domain.LastHours(time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC), 24)
+
+	rows := sqlmock.NewRows([]string{"repo_name", "stars", "flagged_stars", "total_stars", "count", "total_count", "repo_id"}).
+		AddRow("repo1/test", 70, 60, 1000, 70, 1000, 1)
+
+	mock.ExpectQuery(`SELECT h.repo_id AS repo_id, MAX\(h.repo_name\) AS repo_name, GREATEST\(ROUND\(SUM\(h.stars\) - SUM\(h.flagged_stars\) \* 0.5\), 0\) AS stars, `+
+		`SUM\(h.flagged_stars\) AS flagged_stars, .* `+
+		`HAVING GREATEST\(ROUND\(SUM\(h.stars\) - SUM\(h.flagged_stars\) \* 0.5\), 0\) > 0 ORDER BY count desc`).
+		WithArgs(window.From, window.To, 5).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches"`).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "sketch"}))
+
+	repos, err := repo.GetTopN(5, window, domain.MetricStars,
+		domain.SpamPolicy{Mode: domain.SpamModeDiscount, Weight: 0.5})
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, uint64(70), repos[0].WindowStars)
+	assert.Equal(t, uint64(60), repos[0].FlaggedStars)
+
+	mock.ExpectQuery(`SELECT h.repo_id AS repo_id, MAX\(h.repo_name\) AS repo_name, GREATEST\(ROUND\(SUM\(h.stars\) - SUM\(h.flagged_stars\) \* 1\), 0\) AS stars, `+
+		`.*SUM\(h.forks\) AS count, .* HAVING SUM\(h.forks\) > 0`).
+		WithArgs(window.From, window.To, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_name"}))
+
+	_, err = repo.GetTopN(5, window, domain.MetricForks, domain.SpamPolicy{Mode: domain.SpamModeExclude})
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTimeSeries_HourlyZeroFilled(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: from, To: from.Add(4 * time.Hour)}
+
+	mock.ExpectQuery(`SELECT \* FROM "repo_totals" WHERE repo_name = \$1 ORDER BY updated_at desc LIMIT \$2`).
+		WithArgs("test/repo", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "repo_name", "total_stars"}).
+			AddRow(7, "test/repo", 42))
+
+	mock.ExpectQuery(`SELECT "hour","stars" FROM "hourly_aggregates"`).
+		WithArgs(int64(7), window.From, window.To).
+		WillReturnRows(sqlmock.NewRows([]string{"hour", "stars"}).
+			AddRow(from.Add(time.Hour), 5).
+			AddRow(from.Add(3*time.Hour), 2))
+
+	series, err := repo.GetTimeSeries(domain.RepoRef{Name: "test/repo"}, window, domain.GranularityHour)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), series.RepoId)
+	assert.Equal(t, "test/repo", series.Name)
+	require.Len(t, series.Points, 4)
+
+	stars := make([]uint64, len(series.Points))
+	for i, p := range series.Points {
+		assert.Equal(t, from.Add(time.Duration(i)*time.Hour), p.Bucket.AsTime())
+		stars[i] = p.Stars
+	}
+	assert.Equal(t, []uint64{0, 5, 0, 2}, stars)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTimeSeries_Daily(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: day.Add(5 * time.Hour), To: day.Add(50 * time.Hour)}
+
+	mock.ExpectQuery(`SELECT \* FROM "repo_totals" WHERE repo_id = \$1 LIMIT \$2`).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "repo_name", "total_stars"}).
+			AddRow(7, "test/repo", 42))
+
+	// Свертки еще не построены
+	mock.ExpectQuery(`SELECT \* FROM "rollup_watermarks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"granularity", "compacted_until"}))
+
+	// Диапазон расширяется до границ суток
+	mock.ExpectQuery(`SELECT "hour","stars" FROM "hourly_aggregates"`).
+		WithArgs(int64(7), day, day.AddDate(0, 0, 3)).
+		WillReturnRows(sqlmock.NewRows([]string{"hour", "stars"}).
+			AddRow(day.Add(1*time.Hour), 3).
+			AddRow(day.Add(23*time.Hour), 4).
+			AddRow(day.Add(49*time.Hour), 1))
+
+	series, err := repo.GetTimeSeries(domain.RepoRef{ID: 7}, window, domain.GranularityDay)
+	require.NoError(t, err)
+	require.Len(t, series.Points, 3)
+
+	assert.Equal(t, day, series.Points[0].Bucket.AsTime())
+	assert.Equal(t, uint64(7), series.Points[0].Stars)
+	assert.Equal(t, uint64(0), series.Points[1].Stars)
+	assert.Equal(t, uint64(1), series.Points[2].Stars)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTimeSeries_RepoNotFound(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	mock.ExpectQuery(`SELECT \* FROM "repo_totals"`).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "repo_name", "total_stars"}))
+
+	window := domain.LastHours(time.Now(), 24)
+	series, err := repo.GetTimeSeries(domain.RepoRef{Name: "missing/repo"}, window, domain.GranularityHour)
+	assert.ErrorIs(t, err, domain.ErrRepoNotFound)
+	assert.Nil(t, series)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,361 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rollupTables сопоставляет гранулярность свертки с ее таблицей.
+var rollupTables = map[domain.Granularity]string{
+	domain.GranularityDay:   "daily_aggregates",
+	domain.GranularityWeek:  "weekly_aggregates",
+	domain.GranularityMonth: "monthly_aggregates",
+}
+
+// rollupSources сопоставляет гранулярность свертки с гранулярностью, из
+// которой она сворачивается: недели и месяцы собираются из суток, чтобы
+// пережить удаление часовых агрегатов.
+var rollupSources = map[domain.Granularity]domain.Granularity{
+	domain.GranularityDay:   domain.GranularityHour,
+	domain.GranularityWeek:  domain.GranularityDay,
+	domain.GranularityMonth: domain.GranularityDay,
+}
+
+// dirtyDaysTable содержит сутки, которые нужно свернуть заново.
+const dirtyDaysTable = "rollup_dirty_days"
+
+// topRollups перечисляет свертки, подходящие для суммы за окно, от крупной к мелкой.
+var topRollups = []domain.Granularity{domain.GranularityMonth, domain.GranularityWeek, domain.GranularityDay}
+
+// seriesRollups перечисляет свертки, корзины которых целиком лежат в корзине
+// временного ряда гранулярности, от крупной к мелкой. Недели не вкладываются в месяцы.
+var seriesRollups = map[domain.Granularity][]domain.Granularity{
+	domain.GranularityDay:   {domain.GranularityDay},
+	domain.GranularityWeek:  {domain.GranularityWeek, domain.GranularityDay},
+	domain.GranularityMonth: {domain.GranularityMonth, domain.GranularityDay},
+}
+
+// segment задает часть окна, читаемую из агрегатов одной гранулярности.
+type segment struct {
+	granularity domain.Granularity
+	window      domain.TimeRange
+}
+
+// table возвращает таблицу агрегатов отрезка.
+func (s segment) table() string {
+	if table, ok := rollupTables[s.granularity]; ok {
+		return table
+	}
+	return hourlyTable
+}
+
+// column возвращает колонку начала корзины в таблице отрезка.
+func (s segment) column() string {
+	if _, ok := rollupTables[s.granularity]; ok {
+		return "bucket"
+	}
+	return "hour"
+}
+
+// planWindow разбивает окно на отрезки так, чтобы каждая его часть читалась из
+// самой крупной свертки из rollups, уже содержащей ее корзины. Остаток
+// читается из часовых агрегатов.
+func planWindow(window domain.TimeRange, watermarks map[domain.Granularity]time.Time, rollups []domain.Granularity) []segment {
+	for _, g := range rollups {
+		watermark, ok := watermarks[g]
+		if !ok {
+			continue
+		}
+		from := g.Truncate(window.From)
+		if from.Before(window.From) {
+			from = g.Next(from)
+		}
+		to := window.To
+		if watermark.Before(to) {
+			to = watermark
+		}
+		to = g.Truncate(to)
+		if !from.Before(to) {
+			continue
+		}
+
+		var segments []segment
+		if window.From.Before(from) {
+			segments = append(segments, planWindow(domain.TimeRange{From: window.From, To: from}, watermarks, rollups)...)
+		}
+		segments = append(segments, segment{granularity: g, window: domain.TimeRange{From: from, To: to}})
+		if to.Before(window.To) {
+			segments = append(segments, planWindow(domain.TimeRange{From: to, To: window.To}, watermarks, rollups)...)
+		}
+		return segments
+	}
+	return []segment{{granularity: domain.GranularityHour, window: window}}
+}
+
+// planQuery разбивает окно на отрезки по сверткам rollups. Границы сверток
+// читаются из базы, только если окно содержит хотя бы одни целые сутки.
+func planQuery(db *gorm.DB, window domain.TimeRange, rollups []domain.Granularity) ([]segment, error) {
+	hourly := []segment{{granularity: domain.GranularityHour, window: window}}
+	day := domain.GranularityDay.Truncate(window.From)
+	if day.Before(window.From) {
+		day = domain.GranularityDay.Next(day)
+	}
+	if len(rollups) == 0 || domain.GranularityDay.Next(day).After(window.To) {
+		return hourly, nil
+	}
+
+	watermarks, err := rollupWatermarks(db)
+	if err != nil {
+		return nil, err
+	}
+	return planWindow(window, watermarks, rollups), nil
+}
+
+// rollupWatermarks возвращает границы свертки по гранулярности.
+func rollupWatermarks(db *gorm.DB) (map[domain.Granularity]time.Time, error) {
+	var rows []models.RollupWatermark
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("loading rollup watermarks: %w", err)
+	}
+	watermarks := make(map[domain.Granularity]time.Time, len(rows))
+	for _, row := range rows {
+		watermarks[domain.Granularity(row.Granularity)] = row.CompactedUntil.UTC()
+	}
+	return watermarks, nil
+}
+
+// markDirtyDays отмечает уже свернутые сутки часов hours, чтобы compaction
+// свернул их заново с опоздавшими часовыми агрегатами.
+func markDirtyDays(tx *gorm.DB, hours []time.Time) error {
+	seen := make(map[time.Time]bool)
+	var values []string
+	var args []interface{}
+	for _, hour := range hours {
+		day := domain.GranularityDay.Truncate(hour)
+		if seen[day] {
+			continue
+		}
+		seen[day] = true
+		values = append(values, "(?::timestamptz)")
+		args = append(args, day)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (day, marked_at)
+		SELECT v.day, NOW() FROM (VALUES %s) AS v(day)
+		JOIN rollup_watermarks AS w ON w.granularity = '%s' AND v.day < w.compacted_until
+		ON CONFLICT (day) DO NOTHING
+	`, dirtyDaysTable, strings.Join(values, ", "), domain.GranularityDay), args...).Error
+	if err != nil {
+		return fmt.Errorf("marking dirty days: %w", err)
+	}
+	return nil
+}
+
+// rollupColumns содержит колонки, общие для часовых агрегатов и сверток.
+func rollupColumns() []string {
+	return append(append([]string{"repo_id", "repo_name"}, sortedMetricColumns()...), flaggedColumn)
+}
+
+// segmentsSource возвращает подзапрос h со строками агрегатов всех отрезков.
+func segmentsSource(segments []segment) (string, []interface{}) {
+	columns := strings.Join(rollupColumns(), ", ")
+	parts := make([]string, len(segments))
+	args := make([]interface{}, 0, 2*len(segments))
+	for i, s := range segments {
+		parts[i] = fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? AND %s < ?", columns, s.table(), s.column(), s.column())
+		args = append(args, s.window.From, s.window.To)
+	}
+	return "(" + strings.Join(parts, " UNION ALL ") + ") AS h", args
+}
+
+// compactBuckets пересчитывает корзины свертки g, начинающиеся в window,
+// из агрегатов и счетчиков уникальных аккаунтов исходной гранулярности.
+func compactBuckets(tx *gorm.DB, g domain.Granularity, window domain.TimeRange) error {
+	target := segment{granularity: g, window: window}
+	source := segment{granularity: rollupSources[g], window: window}
+
+	err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE bucket >= ? AND bucket < ?", target.table()),
+		window.From, window.To).Error
+	if err != nil {
+		return fmt.Errorf("clearing %s: %w", target.table(), err)
+	}
+
+	counters := append(sortedMetricColumns(), flaggedColumn)
+	sums := make([]string, len(counters))
+	for i, column := range counters {
+		sums[i] = fmt.Sprintf("SUM(%s)", column)
+	}
+	err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %[1]s (repo_id, repo_name, bucket, %[2]s, updated_at)
+		SELECT repo_id, MAX(repo_name), date_trunc('%[3]s', %[4]s, 'UTC'), %[5]s, NOW()
+		FROM %[6]s
+		WHERE %[4]s >= ? AND %[4]s < ?
+		GROUP BY repo_id, 3
+	`,
+		target.table(), strings.Join(counters, ", "), g, source.column(),
+		strings.Join(sums, ", "), source.table(),
+	), window.From, window.To).Error
+	if err != nil {
+		return fmt.Errorf("filling %s: %w", target.table(), err)
+	}
+	return compactStargazers(tx, g, window)
+}
+
+// recompactOverlapping пересчитывает уже свернутые корзины всех сверток,
+// пересекающиеся с window, после изменения часовых агрегатов окна.
+func recompactOverlapping(tx *gorm.DB, window domain.TimeRange) error {
+	watermarks, err := rollupWatermarks(tx)
+	if err != nil {
+		return err
+	}
+	// Сутки пересчитываются раньше недель и месяцев, которые из них собираются.
+	for _, g := range []domain.Granularity{domain.GranularityDay, domain.GranularityWeek, domain.GranularityMonth} {
+		watermark, ok := watermarks[g]
+		if !ok {
+			continue
+		}
+		buckets := window.Align(g)
+		if watermark.Before(buckets.To) {
+			buckets.To = watermark
+		}
+		if !buckets.From.Before(buckets.To) {
+			continue
+		}
+		if err := compactBuckets(tx, g, buckets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompactionRepo сворачивает часовые агрегаты в дневные, недельные и месячные
+// и удаляет свернутые часовые агрегаты.
+type CompactionRepo struct {
+	db *gorm.DB
+}
+
+// NewCompactionRepo создает новый CompactionRepo.
+func NewCompactionRepo(db *gorm.DB) *CompactionRepo {
+	return &CompactionRepo{db: db}
+}
+
+// Watermarks возвращает границы свертки по гранулярности.
+func (r *CompactionRepo) Watermarks(ctx context.Context) (map[domain.Granularity]time.Time, error) {
+	return rollupWatermarks(r.db.WithContext(ctx))
+}
+
+// HourlyHorizon возвращает начало первых суток с полными часовыми агрегатами:
+// границу удаления, если часы удалялись, иначе первые сутки с часовыми
+// агрегатами. Опоздавшие часы удаленных суток границу не сдвигают. Возвращает
+// false, если часы не удалялись и часовых агрегатов нет.
+func (r *CompactionRepo) HourlyHorizon(ctx context.Context) (time.Time, bool, error) {
+	db := r.db.WithContext(ctx)
+	watermarks, err := rollupWatermarks(db)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if pruned, ok := watermarks[domain.GranularityHour]; ok {
+		return pruned, true, nil
+	}
+
+	var earliest *time.Time
+	err = db.Model(&models.HourlyAggregate{}).Select("MIN(hour)").Scan(&earliest).Error
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("getting earliest hour: %w", err)
+	}
+	if earliest == nil {
+		return time.Time{}, false, nil
+	}
+	return domain.GranularityDay.Truncate(*earliest), true, nil
+}
+
+// DirtyDays возвращает свернутые сутки с опоздавшими часовыми агрегатами по возрастанию.
+func (r *CompactionRepo) DirtyDays(ctx context.Context) ([]time.Time, error) {
+	var days []time.Time
+	err := r.db.WithContext(ctx).Model(&models.RollupDirtyDay{}).Order("day").Pluck("day", &days).Error
+	if err != nil {
+		return nil, fmt.Errorf("getting dirty days: %w", err)
+	}
+	for i := range days {
+		days[i] = days[i].UTC()
+	}
+	return days, nil
+}
+
+// DiscardDirtyDays удаляет отметки суток раньше before.
+func (r *CompactionRepo) DiscardDirtyDays(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("day < ?", before).Delete(&models.RollupDirtyDay{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("discarding dirty days: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Compact пересчитывает корзины свертки g, начинающиеся в window, и сдвигает
+// ее границу до window.To, если та была раньше. Отметки пересчитанных суток
+// снимаются до пересчета: сутки, отмеченные позже, будут свернуты снова.
+func (r *CompactionRepo) Compact(ctx context.Context, g domain.Granularity, window domain.TimeRange) error {
+	if _, ok := rollupTables[g]; !ok {
+		return fmt.Errorf("unknown rollup granularity: %s", g)
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if g == domain.GranularityDay {
+			err := tx.Where("day >= ? AND day < ?", window.From, window.To).Delete(&models.RollupDirtyDay{}).Error
+			if err != nil {
+				return fmt.Errorf("clearing dirty days: %w", err)
+			}
+		}
+		if err := compactBuckets(tx, g, window); err != nil {
+			return err
+		}
+		return saveWatermark(tx, g, window.To)
+	})
+}
+
+// PruneHourly удаляет часовые агрегаты и счетчики уникальных аккаунтов раньше
+// before и запоминает границу удаления.
+func (r *CompactionRepo) PruneHourly(ctx context.Context, before time.Time) (int64, error) {
+	var pruned int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("hour < ?", before).Delete(&models.HourlyAggregate{})
+		if result.Error != nil {
+			return fmt.Errorf("pruning hourly aggregates: %w", result.Error)
+		}
+		pruned = result.RowsAffected
+		if err := tx.Where("hour < ?", before).Delete(&models.StargazerSketch{}).Error; err != nil {
+			return fmt.Errorf("pruning stargazer sketches: %w", err)
+		}
+		return saveWatermark(tx, domain.GranularityHour, before)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+// saveWatermark сдвигает границу гранулярности g до until, если та была раньше.
+func saveWatermark(tx *gorm.DB, g domain.Granularity, until time.Time) error {
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "granularity"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"compacted_until": gorm.Expr("GREATEST(rollup_watermarks.compacted_until, excluded.compacted_until)"),
+			"updated_at":      gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&models.RollupWatermark{Granularity: string(g), CompactedUntil: until}).Error
+	if err != nil {
+		return fmt.Errorf("saving %s watermark: %w", g, err)
+	}
+	return nil
+}
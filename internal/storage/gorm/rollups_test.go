@@ -0,0 +1,279 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPlanWindow(t *testing.T) {
+	// 1 января 2024 года — понедельник, 1 февраля — четверг
+	jan1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb1 := jan1.AddDate(0, 1, 0)
+	watermarks := map[domain.Granularity]time.Time{
+		domain.GranularityDay:   feb1.AddDate(0, 0, 11),
+		domain.GranularityWeek:  feb1.AddDate(0, 0, 11),
+		domain.GranularityMonth: feb1,
+	}
+	window := domain.TimeRange{From: jan1.Add(-6 * time.Hour), To: feb1.AddDate(0, 0, 11).Add(3 * time.Hour)}
+
+	segments := planWindow(window, watermarks, topRollups)
+
+	assert.Equal(t, []segment{
+		{granularity: domain.GranularityHour, window: domain.TimeRange{From: window.From, To: jan1}},
+		{granularity: domain.GranularityMonth, window: domain.TimeRange{From: jan1, To: feb1}},
+		// Дни до понедельника 5 февраля не составляют целой недели
+		{granularity: domain.GranularityDay, window: domain.TimeRange{From: feb1, To: feb1.AddDate(0, 0, 4)}},
+		{granularity: domain.GranularityWeek, window: domain.TimeRange{From: feb1.AddDate(0, 0, 4), To: feb1.AddDate(0, 0, 11)}},
+		{granularity: domain.GranularityHour, window: domain.TimeRange{From: feb1.AddDate(0, 0, 11), To: window.To}},
+	}, segments)
+}
+
+func TestPlanWindow_NoWatermarks(t *testing.T) {
+	window := domain.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	segments := planWindow(window, nil, topRollups)
+
+	assert.Equal(t, []segment{{granularity: domain.GranularityHour, window: window}}, segments)
+}
+
+func TestGetTopN_ReadsRollups(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: from, To: from.AddDate(0, 0, 3)}
+	jan2 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT \* FROM "rollup_watermarks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"granularity", "compacted_until"}).
+			AddRow("day", jan2.AddDate(0, 0, 1)))
+	mock.ExpectQuery(`SELECT .* FROM \(SELECT repo_id, repo_name, .* FROM hourly_aggregates WHERE hour >= \$1 AND hour < \$2 `+
+		`UNION ALL SELECT .* FROM daily_aggregates WHERE bucket >= \$3 AND bucket < \$4 `+
+		`UNION ALL SELECT .* FROM hourly_aggregates WHERE hour >= \$5 AND hour < \$6\) AS h `+
+		`LEFT JOIN repo_totals AS t .* GROUP BY "h"."repo_id"`).
+		WithArgs(from, jan2, jan2, jan2.AddDate(0, 0, 1), jan2.AddDate(0, 0, 1), window.To, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_name", "stars", "total_stars", "count", "total_count", "repo_id"}).
+			AddRow("repo1/test", 40, 900, 40, 900, 1))
+	// Уникальные аккаунты читаются из тех же отрезков, что и агрегаты
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches" WHERE \(hour >= \$1 AND hour < \$2\) AND repo_id IN \(\$3\)`).
+		WithArgs(from, jan2, int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}).
+			AddRow(1, from, mustMarshal(t, sketchOf("a", "b"))))
+	mock.ExpectQuery(`SELECT repo_id, bucket AS at, sketch FROM "stargazer_rollups" `+
+		`WHERE \(granularity = \$1 AND bucket >= \$2 AND bucket < \$3\) AND repo_id IN \(\$4\)`).
+		WithArgs("day", jan2, jan2.AddDate(0, 0, 1), int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}).
+			AddRow(1, jan2, mustMarshal(t, sketchOf("b", "c", "d"))))
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches"`).
+		WithArgs(jan2.AddDate(0, 0, 1), window.To, int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}))
+
+	repos, err := repo.GetTopN(5, window, domain.MetricStars, domain.SpamPolicy{})
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, uint64(40), repos[0].WindowStars)
+	assert.Equal(t, uint64(4), repos[0].UniqueStargazers)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactionRepo_Compact(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCompactionRepo(db)
+
+	week := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: week, To: week.AddDate(0, 0, 7)}
+
+	// Недели собираются из суточных сверток
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM weekly_aggregates WHERE bucket >= \$1 AND bucket < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO weekly_aggregates \(repo_id, repo_name, bucket, .*\) `+
+		`SELECT repo_id, MAX\(repo_name\), date_trunc\('week', bucket, 'UTC'\), .* FROM daily_aggregates `+
+		`WHERE bucket >= \$1 AND bucket < \$2 GROUP BY repo_id, 3`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// Счетчики уникальных аккаунтов недели объединяются из суточных
+	mock.ExpectExec(`DELETE FROM "stargazer_rollups" WHERE granularity = \$1 AND bucket >= \$2 AND bucket < \$3`).
+		WithArgs("week", window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`SELECT repo_id, bucket AS at, sketch FROM "stargazer_rollups" `+
+		`WHERE granularity = \$1 AND bucket >= \$2 AND bucket < \$3 ORDER BY repo_id, bucket LIMIT \$4`).
+		WithArgs("day", window.From, window.To, sketchChunkSize).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}).
+			AddRow(1, week, mustMarshal(t, sketchOf("a", "b"))).
+			AddRow(1, week.AddDate(0, 0, 1), mustMarshal(t, sketchOf("b", "c"))).
+			AddRow(2, week.AddDate(0, 0, 3), mustMarshal(t, sketchOf("d"))))
+	mock.ExpectExec(`INSERT INTO "stargazer_rollups" \("granularity","repo_id","bucket","sketch","uniques","updated_at"\)`).
+		WithArgs(
+			"week", int64(1), week, mustMarshal(t, sketchOf("a", "b", "c")), int64(3), sqlmock.AnyArg(),
+			"week", int64(2), week, mustMarshal(t, sketchOf("d")), int64(1), sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO "rollup_watermarks" .* ON CONFLICT \("granularity"\) DO UPDATE SET `+
+		`"compacted_until"=GREATEST\(rollup_watermarks.compacted_until, excluded.compacted_until\)`).
+		WithArgs("week", window.To, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.Compact(context.Background(), domain.GranularityWeek, window)
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactionRepo_CompactUnknownGranularity(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCompactionRepo(db)
+
+	err := repo.Compact(context.Background(), domain.GranularityHour, domain.TimeRange{})
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactionRepo_CompactDayClearsDirtyDays(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCompactionRepo(db)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: day, To: day.AddDate(0, 0, 1)}
+
+	// Отметка снимается до пересчета, чтобы не потерять отмеченные позже сутки
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "rollup_dirty_days" WHERE day >= \$1 AND day < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM daily_aggregates WHERE bucket >= \$1 AND bucket < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO daily_aggregates .* FROM hourly_aggregates WHERE hour >= \$1 AND hour < \$2`).
+		WithArgs(window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "stargazer_rollups"`).
+		WithArgs("day", window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches" `+
+		`WHERE hour >= \$1 AND hour < \$2 ORDER BY repo_id, hour LIMIT \$3`).
+		WithArgs(window.From, window.To, sketchChunkSize).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}))
+	mock.ExpectExec(`INSERT INTO "rollup_watermarks"`).
+		WithArgs("day", window.To, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.Compact(context.Background(), domain.GranularityDay, window)
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactStargazers_Pages(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := domain.TimeRange{From: day, To: day.AddDate(0, 0, 1)}
+	hourly := func(repos int64, hours int) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"repo_id", "at", "sketch"})
+		for repoID := int64(1); repoID <= repos; repoID++ {
+			for hour := 0; hour < 24 && (repoID < repos || hour < hours); hour++ {
+				rows.AddRow(repoID, day.Add(time.Duration(hour)*time.Hour), mustMarshal(t, sketchOf(fmt.Sprint(hour))))
+			}
+		}
+		return rows
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "stargazer_rollups"`).
+		WithArgs("day", window.From, window.To).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Первая страница обрывается на репозитории 21: его сутки еще не собраны
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches" `+
+		`WHERE hour >= \$1 AND hour < \$2 ORDER BY repo_id, hour LIMIT \$3`).
+		WithArgs(window.From, window.To, sketchChunkSize).
+		WillReturnRows(hourly(21, sketchChunkSize-20*24))
+	args := make([]driver.Value, 0, 20*6)
+	for repoID := int64(1); repoID <= 20; repoID++ {
+		args = append(args, "day", repoID, day, sqlmock.AnyArg(), int64(24), sqlmock.AnyArg())
+	}
+	mock.ExpectExec(`INSERT INTO "stargazer_rollups"`).
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+	mock.ExpectQuery(`SELECT repo_id, hour AS at, sketch FROM "stargazer_sketches" `+
+		`WHERE \(hour >= \$1 AND hour < \$2\) AND \(repo_id, hour\) > \(\$3, \$4\) ORDER BY repo_id, hour LIMIT \$5`).
+		WithArgs(window.From, window.To, int64(21), day.Add(19*time.Hour), sketchChunkSize).
+		WillReturnRows(sqlmock.NewRows([]string{"repo_id", "at", "sketch"}).
+			AddRow(21, day.Add(20*time.Hour), mustMarshal(t, sketchOf("20"))).
+			AddRow(21, day.Add(21*time.Hour), mustMarshal(t, sketchOf("0"))))
+	mock.ExpectExec(`INSERT INTO "stargazer_rollups"`).
+		WithArgs("day", int64(21), day, sqlmock.AnyArg(), int64(21), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return compactStargazers(tx, domain.GranularityDay, window)
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactionRepo_HourlyHorizon(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCompactionRepo(db)
+
+	pruned := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Граница удаления важнее опоздавших часов удаленных суток
+	mock.ExpectQuery(`SELECT \* FROM "rollup_watermarks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"granularity", "compacted_until"}).
+			AddRow("day", pruned.AddDate(0, 1, 0)).
+			AddRow("hour", pruned))
+
+	horizon, ok, err := repo.HourlyHorizon(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, pruned, horizon)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompactionRepo_PruneHourly(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewCompactionRepo(db)
+
+	before := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "hourly_aggregates" WHERE hour < \$1`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectExec(`DELETE FROM "stargazer_sketches" WHERE hour < \$1`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec(`INSERT INTO "rollup_watermarks" .* ON CONFLICT \("granularity"\) DO UPDATE SET `+
+		`"compacted_until"=GREATEST\(rollup_watermarks.compacted_until, excluded.compacted_until\)`).
+		WithArgs("hour", before, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pruned, err := repo.PruneHourly(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), pruned)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
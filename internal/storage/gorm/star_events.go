@@ -0,0 +1,161 @@
+package gorm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// starEventsTable содержит события звезд, секционированные по дням.
+	starEventsTable = "star_events"
+	// starPartitionPrefix и starPartitionLayout задают имя дневной секции, например star_events_p20240101.
+	starPartitionPrefix = starEventsTable + "_p"
+	starPartitionLayout = "20060102"
+	// partitionDay задает размер секции star_events.
+	partitionDay = 24 * time.Hour
+)
+
+// starPartitionName возвращает имя секции дня day.
+func starPartitionName(day time.Time) string {
+	return starPartitionPrefix + day.Format(starPartitionLayout)
+}
+
+// saveStarEvents записывает учтенные звезды пачки в star_events, создавая
+// недостающие дневные секции. Возвращает дни созданных секций: запомнить их
+// можно только после фиксации транзакции, иначе откат удалит секцию.
+func (r *StatsRepo) saveStarEvents(tx *gorm.DB, events []domain.Event) ([]time.Time, error) {
+	rows := make([]models.StarEvent, 0, len(events))
+	days := make(map[time.Time]struct{})
+	for _, event := range events {
+		if event.Action != domain.ActionStarred {
+			continue
+		}
+		createdAt := event.CreatedAt.UTC()
+		rows = append(rows, models.StarEvent{
+			EventID:    event.ID,
+			RepoID:     event.RepoID,
+			RepoName:   event.RepoName,
+			ActorLogin: event.ActorLogin,
+			CreatedAt:  createdAt,
+			Flagged:    event.Flagged,
+		})
+		days[createdAt.Truncate(partitionDay)] = struct{}{}
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var created []time.Time
+	for day := range days {
+		if _, ok := r.partitions.Load(day); !ok {
+			created = append(created, day)
+		}
+	}
+	sort.Slice(created, func(i, j int) bool { return created[i].Before(created[j]) })
+
+	for _, day := range created {
+		// Параллельный processor может создать ту же секцию одновременно: тогда
+		// транзакция завершится ошибкой и при повторе IF NOT EXISTS ее пропустит.
+		err := tx.Exec(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			starPartitionName(day), starEventsTable,
+			day.Format(time.RFC3339), day.Add(partitionDay).Format(time.RFC3339),
+		)).Error
+		if err != nil {
+			return nil, fmt.Errorf("creating star events partition: %w", err)
+		}
+	}
+
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, insertChunkSize).Error
+	if err != nil {
+		return nil, fmt.Errorf("saving star events: %w", err)
+	}
+	return created, nil
+}
+
+// rememberPartitions запоминает созданные секции, чтобы не выполнять DDL на каждой пачке.
+func (r *StatsRepo) rememberPartitions(days []time.Time) {
+	for _, day := range days {
+		r.partitions.Store(day, struct{}{})
+	}
+}
+
+// ListStarEvents возвращает сохраненные события звезд, упорядоченные по времени и ID.
+func (r *StatsRepo) ListStarEvents(query domain.StarEventQuery) ([]domain.Event, error) {
+	db := r.db.Where("created_at >= ? AND created_at < ?", query.Window.From, query.Window.To)
+	if query.Repo.ID != 0 {
+		db = db.Where("repo_id = ?", query.Repo.ID)
+	} else if query.Repo.Name != "" {
+		db = db.Where("repo_name = ?", query.Repo.Name)
+	}
+	if query.Actor != "" {
+		db = db.Where("actor_login = ?", query.Actor)
+	}
+	if query.After != nil {
+		db = db.Where("(created_at, event_id) > (?, ?)", query.After.CreatedAt, query.After.ID)
+	}
+
+	var rows []models.StarEvent
+	err := db.Order("created_at, event_id").Limit(query.Limit).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("listing star events: %w", err)
+	}
+
+	events := make([]domain.Event, len(rows))
+	for i, row := range rows {
+		events[i] = domain.Event{
+			ID:         row.EventID,
+			Action:     domain.ActionStarred,
+			RepoID:     row.RepoID,
+			RepoName:   row.RepoName,
+			ActorLogin: row.ActorLogin,
+			CreatedAt:  row.CreatedAt.UTC(),
+			Flagged:    row.Flagged,
+		}
+	}
+	return events, nil
+}
+
+// PruneStarEvents удаляет дневные секции star_events, целиком лежащие раньше before.
+// Удаление секции не оставляет мертвых строк, в отличие от DELETE.
+func (r *StatsRepo) PruneStarEvents(before time.Time) (int, error) {
+	var names []string
+	err := r.db.Raw(`
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = ?
+		ORDER BY c.relname
+	`, starEventsTable).Scan(&names).Error
+	if err != nil {
+		return 0, fmt.Errorf("listing star events partitions: %w", err)
+	}
+
+	dropped := 0
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, starPartitionPrefix)
+		if !ok {
+			continue
+		}
+		day, err := time.Parse(starPartitionLayout, suffix)
+		if err != nil {
+			continue
+		}
+		if day.Add(partitionDay).After(before) {
+			continue
+		}
+		if err := r.db.Exec("DROP TABLE IF EXISTS " + name).Error; err != nil {
+			return dropped, fmt.Errorf("dropping star events partition %s: %w", name, err)
+		}
+		r.partitions.Delete(day)
+		dropped++
+	}
+	return dropped, nil
+}
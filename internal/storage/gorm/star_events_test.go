@@ -0,0 +1,113 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveStarEvents_CreatesPartitionOnce(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := &StatsRepo{db: db}
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []domain.Event{
+		{ID: "1", Action: domain.ActionStarred, RepoID: 1, RepoName: "org/a", ActorLogin: "u", CreatedAt: day.Add(23 * time.Hour)},
+		{ID: "2", Action: domain.ActionForked, RepoID: 1, RepoName: "org/a", ActorLogin: "u", CreatedAt: day},
+		{ID: "3", Action: domain.ActionStarred, RepoID: 2, RepoName: "org/b", ActorLogin: "u", CreatedAt: day.Add(25 * time.Hour)},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS star_events_p20240101 PARTITION OF star_events`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS star_events_p20240102 PARTITION OF star_events`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "star_events"`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	tx := db.Begin()
+	created, err := repo.saveStarEvents(tx, events)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit().Error)
+	assert.Equal(t, []time.Time{day, day.Add(partitionDay)}, created)
+	repo.rememberPartitions(created)
+
+	// Известные секции не создаются повторно
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "star_events"`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	tx = db.Begin()
+	created, err = repo.saveStarEvents(tx, events)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit().Error)
+	assert.Empty(t, created)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListStarEvents(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := domain.StarEventQuery{
+		Repo:   domain.RepoRef{Name: "org/a"},
+		Actor:  "user",
+		Window: domain.TimeRange{From: from, To: from.Add(24 * time.Hour)},
+		Limit:  2,
+		After:  &domain.StarEventCursor{CreatedAt: from.Add(time.Hour), ID: "10"},
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "star_events" WHERE \(created_at >= \$1 AND created_at < \$2\) `+
+		`AND repo_name = \$3 AND actor_login = \$4 AND \(created_at, event_id\) > \(\$5, \$6\) `+
+		`ORDER BY created_at, event_id LIMIT \$7`).
+		WithArgs(query.Window.From, query.Window.To, "org/a", "user", query.After.CreatedAt, "10", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id", "repo_id", "repo_name", "actor_login", "created_at", "flagged"}).
+			AddRow("11", 1, "org/a", "user", from.Add(2*time.Hour), true))
+
+	events, err := repo.ListStarEvents(query)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Event{{
+		ID:         "11",
+		Action:     domain.ActionStarred,
+		RepoID:     1,
+		RepoName:   "org/a",
+		ActorLogin: "user",
+		CreatedAt:  from.Add(2 * time.Hour),
+		Flagged:    true,
+	}}, events)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneStarEvents(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewStatsRepo(db)
+
+	before := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT c.relname FROM pg_inherits`).
+		WithArgs("star_events").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("star_events_p20240101").
+			AddRow("star_events_p20240102").
+			AddRow("star_events_p20240103").
+			AddRow("star_events_manual"))
+	mock.ExpectExec(`DROP TABLE IF EXISTS star_events_p20240101`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP TABLE IF EXISTS star_events_p20240102`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := repo.PruneStarEvents(before)
+	require.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,261 @@
+package gorm
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kun1ts4/stars-analytics/internal/domain"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"github.com/kun1ts4/stars-analytics/pkg/hll"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// stargazersTable содержит часовые счетчики уникальных аккаунтов.
+const stargazersTable = "stargazer_sketches"
+
+// stargazerRollupsTable содержит счетчики уникальных аккаунтов сверток.
+const stargazerRollupsTable = "stargazer_rollups"
+
+// sketchChunkSize ограничивает число ключей (репозиторий, час) в одном запросе счетчиков.
+const sketchChunkSize = insertChunkSize / 2
+
+// stargazerSketches строит счетчики аккаунтов, поставивших звезды, по (репозиторий, час).
+func stargazerSketches(events []domain.Event) map[hourKey]*hll.Sketch {
+	sketches := make(map[hourKey]*hll.Sketch)
+	for _, event := range events {
+		if event.Action != domain.ActionStarred || event.ActorLogin == "" {
+			continue
+		}
+		key := hourKey{repoID: event.RepoID, hour: event.CreatedAt.UTC().Truncate(time.Hour)}
+		sketch, ok := sketches[key]
+		if !ok {
+			sketch = hll.New()
+			sketches[key] = sketch
+		}
+		sketch.Add(event.ActorLogin)
+	}
+	return sketches
+}
+
+// mergeStargazers добавляет аккаунты звезд пачки к счетчикам таблицы table
+// (stargazer_sketches или ее теневой копии). Для stargazer_sketches вызывается
+// после upsert hourly_aggregates: строки тех же часов уже заблокированы
+// транзакцией, поэтому параллельная пачка не перезапишет счетчик.
+func mergeStargazers(tx *gorm.DB, table string, events []domain.Event) error {
+	sketches := stargazerSketches(events)
+	if len(sketches) == 0 {
+		return nil
+	}
+
+	keys := make([]hourKey, 0, len(sketches))
+	for key := range sketches {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].repoID != keys[j].repoID {
+			return keys[i].repoID < keys[j].repoID
+		}
+		return keys[i].hour.Before(keys[j].hour)
+	})
+
+	for start := 0; start < len(keys); start += sketchChunkSize {
+		chunk := keys[start:min(start+sketchChunkSize, len(keys))]
+
+		pairs := make([][]interface{}, len(chunk))
+		for i, key := range chunk {
+			pairs[i] = []interface{}{key.repoID, key.hour}
+		}
+		var stored []models.StargazerSketch
+		err := tx.Table(table).Where("(repo_id, hour) IN ?", pairs).Find(&stored).Error
+		if err != nil {
+			return fmt.Errorf("loading stargazer sketches: %w", err)
+		}
+		for _, row := range stored {
+			key := hourKey{repoID: row.RepoID, hour: row.Hour.UTC()}
+			previous := hll.New()
+			if err := previous.UnmarshalBinary(row.Sketch); err != nil {
+				// Счетчик производный: поврежденный заменяется новым, а не блокирует учет пачки.
+				logger.WithError(err).WithFields(logrus.Fields{
+					"repo_id": row.RepoID,
+					"hour":    key.hour,
+				}).Warn("discarding corrupt stargazer sketch")
+				continue
+			}
+			if sketch, ok := sketches[key]; ok {
+				sketch.Merge(previous)
+			}
+		}
+
+		rows := make([]models.StargazerSketch, len(chunk))
+		for i, key := range chunk {
+			sketch := sketches[key]
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("encoding stargazer sketch: %w", err)
+			}
+			rows[i] = models.StargazerSketch{
+				RepoID:  key.repoID,
+				Hour:    key.hour,
+				Sketch:  data,
+				Uniques: int64(sketch.Count()),
+			}
+		}
+		err = tx.Table(table).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "repo_id"}, {Name: "hour"}},
+			DoUpdates: clause.AssignmentColumns([]string{"sketch", "uniques", "updated_at"}),
+		}).Create(&rows).Error
+		if err != nil {
+			return fmt.Errorf("saving stargazer sketches: %w", err)
+		}
+	}
+	return nil
+}
+
+// sketchSource возвращает запрос счетчиков отрезка s с колонками repo_id,
+// at (начало часа или корзины) и sketch.
+func sketchSource(db *gorm.DB, s segment) *gorm.DB {
+	if s.granularity == domain.GranularityHour {
+		return db.Table(stargazersTable).Select("repo_id, hour AS at, sketch").
+			Where("hour >= ? AND hour < ?", s.window.From, s.window.To)
+	}
+	return db.Table(stargazerRollupsTable).Select("repo_id, bucket AS at, sketch").
+		Where("granularity = ? AND bucket >= ? AND bucket < ?", string(s.granularity), s.window.From, s.window.To)
+}
+
+// sketchRow содержит счетчик, прочитанный sketchSource.
+type sketchRow struct {
+	RepoID int64
+	At     time.Time
+	Sketch []byte
+}
+
+// compactStargazers пересчитывает счетчики уникальных аккаунтов свертки g,
+// начинающиеся в window, объединяя счетчики исходной гранулярности. Счетчики
+// читаются страницами по репозиториям, чтобы не держать в памяти все окно.
+func compactStargazers(tx *gorm.DB, g domain.Granularity, window domain.TimeRange) error {
+	err := tx.Where("granularity = ? AND bucket >= ? AND bucket < ?", string(g), window.From, window.To).
+		Delete(&models.StargazerRollup{}).Error
+	if err != nil {
+		return fmt.Errorf("clearing stargazer rollups: %w", err)
+	}
+
+	source := segment{granularity: rollupSources[g], window: window}
+	merged := make(map[hourKey]*hll.Sketch)
+	var last *sketchRow
+	for {
+		query := sketchSource(tx, source)
+		if last != nil {
+			query = query.Where("(repo_id, "+source.column()+") > (?, ?)", last.RepoID, last.At)
+		}
+		var rows []sketchRow
+		err := query.Order("repo_id, " + source.column()).Limit(sketchChunkSize).Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("loading stargazer sketches: %w", err)
+		}
+
+		for _, row := range rows {
+			sketch := hll.New()
+			if err := sketch.UnmarshalBinary(row.Sketch); err != nil {
+				// Счетчик производный: поврежденный пропускается, а не блокирует свертку.
+				logger.WithError(err).WithFields(logrus.Fields{
+					"repo_id": row.RepoID,
+					"at":      row.At.UTC(),
+				}).Warn("skipping corrupt stargazer sketch")
+				continue
+			}
+			key := hourKey{repoID: row.RepoID, hour: g.Truncate(row.At.UTC())}
+			if total, ok := merged[key]; ok {
+				total.Merge(sketch)
+				continue
+			}
+			merged[key] = sketch
+		}
+		if len(rows) < sketchChunkSize {
+			return saveStargazerRollups(tx, g, merged)
+		}
+
+		// Корзины репозиториев раньше последнего на странице уже собраны полностью.
+		last = &rows[len(rows)-1]
+		done := make(map[hourKey]*hll.Sketch)
+		for key, sketch := range merged {
+			if key.repoID < last.RepoID {
+				done[key] = sketch
+				delete(merged, key)
+			}
+		}
+		if err := saveStargazerRollups(tx, g, done); err != nil {
+			return err
+		}
+	}
+}
+
+// saveStargazerRollups записывает счетчики sketches корзин свертки g.
+func saveStargazerRollups(tx *gorm.DB, g domain.Granularity, sketches map[hourKey]*hll.Sketch) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+
+	rows := make([]models.StargazerRollup, 0, len(sketches))
+	for key, sketch := range sketches {
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("encoding stargazer sketch: %w", err)
+		}
+		rows = append(rows, models.StargazerRollup{
+			Granularity: string(g),
+			RepoID:      key.repoID,
+			Bucket:      key.hour,
+			Sketch:      data,
+			Uniques:     int64(sketch.Count()),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].RepoID != rows[j].RepoID {
+			return rows[i].RepoID < rows[j].RepoID
+		}
+		return rows[i].Bucket.Before(rows[j].Bucket)
+	})
+
+	if err := tx.CreateInBatches(rows, sketchChunkSize).Error; err != nil {
+		return fmt.Errorf("saving stargazer rollups: %w", err)
+	}
+	return nil
+}
+
+// uniqueStargazers объединяет счетчики репозиториев по отрезкам окна, тем же,
+// из которых читаются агрегаты, и возвращает число уникальных аккаунтов по repo_id.
+func uniqueStargazers(db *gorm.DB, repoIDs []int64, segments []segment) (map[int64]uint64, error) {
+	if len(repoIDs) == 0 {
+		return nil, nil
+	}
+
+	merged := make(map[int64]*hll.Sketch, len(repoIDs))
+	for _, s := range segments {
+		var rows []sketchRow
+		err := sketchSource(db, s).Where("repo_id IN ?", repoIDs).Scan(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("loading stargazer sketches: %w", err)
+		}
+		for _, row := range rows {
+			sketch := hll.New()
+			if err := sketch.UnmarshalBinary(row.Sketch); err != nil {
+				return nil, fmt.Errorf("decoding stargazer sketch of repo %d: %w", row.RepoID, err)
+			}
+			if total, ok := merged[row.RepoID]; ok {
+				total.Merge(sketch)
+				continue
+			}
+			merged[row.RepoID] = sketch
+		}
+	}
+
+	counts := make(map[int64]uint64, len(merged))
+	for repoID, sketch := range merged {
+		counts[repoID] = sketch.Count()
+	}
+	return counts, nil
+}
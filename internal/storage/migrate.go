@@ -2,13 +2,351 @@
 package storage
 
 import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"github.com/kun1ts4/stars-analytics/pkg/logger"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-// Migrate выполняет миграцию базы данных.
-func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.HourlyAggregate{},
-	)
+// migrationFiles содержит миграции вида <версия>_<имя>.up.sql и
+// <версия>_<имя>.down.sql. Миграция без down-файла не откатывается.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID является ключом advisory lock, под которым применяются миграции.
+const migrationLockID int64 = 7_245_110_325
+
+// schemaMigrationsDDL создает таблицу примененных миграций.
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    bigint       PRIMARY KEY,
+	name       varchar(255) NOT NULL,
+	applied_at timestamptz  NOT NULL
+)`
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaOutdated означает, что к базе применены не все миграции сборки.
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// Migration описывает одну версию схемы.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down пуст, если миграцию нельзя откатить.
+	Down string
+}
+
+// MigrationStatus описывает состояние миграции в базе.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// AppliedAt равен нулю, если миграция не применена.
+	AppliedAt time.Time
+	// Unknown означает, что миграция применена, но отсутствует в этой сборке.
+	Unknown bool
+}
+
+// Migrator применяет и откатывает встроенные миграции. Изменяющие схему
+// операции выполняются под advisory lock, поэтому одновременные запуски
+// выполняются по очереди. Каждая миграция применяется в своей транзакции
+// вместе с записью в schema_migrations.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator создает Migrator для встроенных миграций.
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, files)
+}
+
+func newMigrator(db *gorm.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(files)
+	if err != nil {
+		return nil, fmt.Errorf("loading migrations: %w", err)
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest возвращает последнюю версию схемы сборки.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status возвращает состояние миграций сборки и примененных миграций,
+// отсутствующих в сборке, по возрастанию версии.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	db := m.db.WithContext(ctx)
+	applied := make(map[int64]models.SchemaMigration)
+	if db.Migrator().HasTable(&models.SchemaMigration{}) {
+		var err error
+		if applied, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations)+len(applied))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.AppliedAt = row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			AppliedAt: row.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, nil
+}
+
+// Up применяет все непримененные миграции.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down откатывает последнюю примененную миграцию.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return errors.New("no applied migrations to roll back")
+		}
+		return m.rollback(conn, applied[slices.Max(slices.Collect(maps.Keys(applied)))])
+	})
+}
+
+// To применяет миграции до version включительно и откатывает более поздние,
+// начиная с последней. Версия 0 откатывает все миграции.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool {
+		return migration.Version == version
+	}) {
+		return fmt.Errorf("unknown migration version: %d", version)
+	}
+
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		versions := slices.Sorted(maps.Keys(applied))
+		for i := len(versions) - 1; i >= 0 && versions[i] > version; i-- {
+			if err := m.rollback(conn, applied[versions[i]]); err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(conn, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// locked выполняет fn на одном соединении под advisory lock миграций.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// Новая сессия не дает условиям одного запроса попасть в следующие.
+		conn = conn.Session(&gorm.Session{})
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer func() {
+			// Блокировка снимается и после отмены ctx, иначе она останется
+			// на соединении, вернувшемся в пул.
+			err := conn.WithContext(context.WithoutCancel(ctx)).
+				Exec("SELECT pg_advisory_unlock(?)", migrationLockID).Error
+			if err != nil {
+				logger.WithError(err).Warn("failed to release migration lock")
+			}
+		}()
+
+		if err := conn.Exec(schemaMigrationsDDL).Error; err != nil {
+			return fmt.Errorf("creating schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// apply применяет миграцию и записывает ее в schema_migrations.
+func (m *Migrator) apply(conn *gorm.DB, migration Migration) error {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(migration.Up).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"version": migration.Version,
+		"name":    migration.Name,
+	}).Info("migration applied")
+	return nil
+}
+
+// rollback откатывает примененную миграцию и удаляет ее из schema_migrations.
+func (m *Migrator) rollback(conn *gorm.DB, applied models.SchemaMigration) error {
+	index := slices.IndexFunc(m.migrations, func(migration Migration) bool {
+		return migration.Version == applied.Version
+	})
+	if index < 0 {
+		return fmt.Errorf("migration %d_%s is not known to this build", applied.Version, applied.Name)
+	}
+	migration := m.migrations[index]
+	if strings.TrimSpace(migration.Down) == "" {
+		return fmt.Errorf("migration %d_%s cannot be rolled back", migration.Version, migration.Name)
+	}
+
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SchemaMigration{}, migration.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"version": migration.Version,
+		"name":    migration.Name,
+	}).Info("migration rolled back")
+	return nil
+}
+
+// CheckSchema возвращает ErrSchemaOutdated, если к базе применены не все
+// миграции сборки. Примененные миграции более новой сборки не считаются ошибкой.
+func CheckSchema(ctx context.Context, db *gorm.DB) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt.IsZero() {
+			pending = append(pending, fmt.Sprintf("%d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s, run migrate up",
+			ErrSchemaOutdated, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// appliedMigrations возвращает примененные миграции по версии.
+func appliedMigrations(db *gorm.DB) (map[int64]models.SchemaMigration, error) {
+	var rows []models.SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("loading applied migrations: %w", err)
+	}
+	applied := make(map[int64]models.SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// loadMigrations читает миграции из files и сортирует их по версии.
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected migration file: %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
 }
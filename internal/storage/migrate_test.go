@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kun1ts4/stars-analytics/internal/storage/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: db,
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	return gormDB, mock
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id bigint)")},
+	"0001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id bigint)")},
+	"0002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+}
+
+func expectLock(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).
+		WithArgs(migrationLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, "applied", time.Now())
+	}
+	mock.ExpectQuery(`SELECT \* FROM "schema_migrations"`).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).
+		WithArgs(migrationLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrator.migrations)
+
+	// Исходная миграция перенимает таблицы, созданные AutoMigrate, поэтому не откатывается
+	initial := migrator.migrations[0]
+	assert.Equal(t, int64(1), initial.Version)
+	assert.Contains(t, initial.Up, "CREATE TABLE IF NOT EXISTS hourly_aggregates")
+	assert.Contains(t, initial.Up, "CREATE TABLE IF NOT EXISTS rollup_watermarks")
+	assert.Empty(t, initial.Down)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"0010_backfill.up.sql": {Data: []byte("UPDATE a SET id = 1")},
+		"0002_create_b.up.sql": {Data: []byte("CREATE TABLE b (id bigint)")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, "create_b", migrations[0].Name)
+	assert.Equal(t, int64(10), migrations[1].Version)
+	assert.Empty(t, migrations[1].Down)
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"unexpected file", fstest.MapFS{"README.md": {}}},
+		{"zero version", fstest.MapFS{"0000_a.up.sql": {Data: []byte("SELECT 1")}}},
+		{"missing up", fstest.MapFS{"0001_a.down.sql": {Data: []byte("SELECT 1")}}},
+		{"conflicting names", fstest.MapFS{
+			"0001_a.up.sql":   {Data: []byte("SELECT 1")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigratorUp_AppliesPending(t *testing.T) {
+	db, mock := setupTestDB(t)
+	migrator, err := newMigrator(db, testMigrations)
+	require.NoError(t, err)
+
+	expectLock(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "schema_migrations" \("version","name","applied_at"\)`).
+		WithArgs(int64(2), "create_b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	require.NoError(t, migrator.Up(context.Background()))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUp_FailedMigrationRollsBack(t *testing.T) {
+	db, mock := setupTestDB(t)
+	migrator, err := newMigrator(db, testMigrations)
+	require.NoError(t, err)
+
+	expectLock(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnError(gorm.ErrInvalidDB)
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	err = migrator.Up(context.Background())
+	assert.ErrorContains(t, err, "applying migration 1_create_a")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorTo_RollsBackLaterMigrations(t *testing.T) {
+	db, mock := setupTestDB(t)
+	migrator, err := newMigrator(db, testMigrations)
+	require.NoError(t, err)
+
+	expectLock(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "schema_migrations" WHERE "schema_migrations"."version" = \$1`).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	require.NoError(t, migrator.To(context.Background(), 1))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDown_Irreversible(t *testing.T) {
+	db, mock := setupTestDB(t)
+	migrator, err := newMigrator(db, fstest.MapFS{
+		"0001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id bigint)")},
+	})
+	require.NoError(t, err)
+
+	expectLock(mock, 1)
+	expectUnlock(mock)
+
+	err = migrator.Down(context.Background())
+	assert.ErrorContains(t, err, "migration 1_create_a cannot be rolled back")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDown_UnknownMigration(t *testing.T) {
+	db, mock := setupTestDB(t)
+	migrator, err := newMigrator(db, testMigrations)
+	require.NoError(t, err)
+
+	// Последняя миграция применена более новой сборкой
+	expectLock(mock, 1, 2, 3)
+	expectUnlock(mock)
+
+	err = migrator.Down(context.Background())
+	assert.ErrorContains(t, err, "migration 3_applied is not known to this build")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckSchema_Outdated(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM information_schema.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	err := CheckSchema(context.Background(), db)
+	assert.ErrorIs(t, err, ErrSchemaOutdated)
+	assert.ErrorContains(t, err, "1_initial")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// baselineDDL воспроизводит схему, которую создавал AutoMigrate до появления
+// остальных таблиц и метрик.
+const baselineDDL = `
+	CREATE TABLE hourly_aggregates (
+		id         bigserial    PRIMARY KEY,
+		repo_id    bigint       NOT NULL,
+		repo_name  varchar(255) NOT NULL,
+		stars      bigint       DEFAULT 0,
+		hour       timestamptz  NOT NULL,
+		created_at timestamptz,
+		updated_at timestamptz
+	);
+	CREATE UNIQUE INDEX idx_repo_hour ON hourly_aggregates (repo_id, hour);
+	CREATE INDEX idx_hourly_aggregates_hour ON hourly_aggregates (hour DESC);
+	INSERT INTO hourly_aggregates (repo_id, repo_name, stars, hour, created_at, updated_at)
+	VALUES (1, 'org/a', 5, '2024-01-01T00:00:00Z', NOW(), NOW());
+`
+
+func TestMigratorUp_AdoptsBaselineSchema(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	// Единственное соединение сохраняет search_path временной схемы для всех запросов
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	require.NoError(t, db.Exec("CREATE SCHEMA "+schema).Error)
+	t.Cleanup(func() { db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+	require.NoError(t, db.Exec("SET search_path TO "+schema).Error)
+	require.NoError(t, db.Exec(baselineDDL).Error)
+
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(ctx))
+	require.NoError(t, CheckSchema(ctx, db))
+
+	for _, model := range []interface{}{
+		&models.HourlyAggregate{},
+		&models.RepoTotal{},
+		&models.ProcessedEvent{},
+		&models.IngestionCheckpoint{},
+		&models.IngestedHour{},
+		&models.SuspiciousActor{},
+		&models.StargazerSketch{},
+		&models.StargazerRollup{},
+		&models.StarEvent{},
+		&models.DailyAggregate{},
+		&models.WeeklyAggregate{},
+		&models.MonthlyAggregate{},
+		&models.RollupWatermark{},
+		&models.RollupDirtyDay{},
+	} {
+		statement := &gorm.Statement{DB: db}
+		require.NoError(t, statement.Parse(model))
+		for _, field := range statement.Schema.Fields {
+			if field.DBName != "" {
+				assert.True(t, db.Migrator().HasColumn(model, field.DBName), "%s.%s", statement.Table, field.DBName)
+			}
+		}
+	}
+
+	// Строка базовой схемы получает нули в новых метриках и попадает в repo_totals
+	var hourly models.HourlyAggregate
+	require.NoError(t, db.First(&hourly).Error)
+	assert.Equal(t, 5, hourly.Stars)
+	assert.Zero(t, hourly.Forks)
+	assert.Zero(t, hourly.FlaggedStars)
+
+	var total models.RepoTotal
+	require.NoError(t, db.First(&total, 1).Error)
+	assert.Equal(t, int64(5), total.TotalStars)
+}
@@ -0,0 +1,191 @@
+-- Исходная схема. IF NOT EXISTS позволяет применить миграцию к базе,
+-- созданной AutoMigrate до перехода на версионные миграции: колонки,
+-- добавленные в таблицы после их создания, дополняются ADD COLUMN IF NOT EXISTS.
+
+CREATE TABLE IF NOT EXISTS hourly_aggregates (
+	id                   bigserial    PRIMARY KEY,
+	repo_id              bigint       NOT NULL,
+	repo_name            varchar(255) NOT NULL,
+	stars                bigint       DEFAULT 0,
+	forks                bigint       DEFAULT 0,
+	pull_requests_opened bigint       DEFAULT 0,
+	pull_requests_merged bigint       DEFAULT 0,
+	issues_opened        bigint       DEFAULT 0,
+	releases             bigint       DEFAULT 0,
+	flagged_stars        bigint       DEFAULT 0,
+	hour                 timestamptz  NOT NULL,
+	created_at           timestamptz,
+	updated_at           timestamptz
+);
+ALTER TABLE hourly_aggregates
+	ADD COLUMN IF NOT EXISTS forks                bigint DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS pull_requests_opened bigint DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS pull_requests_merged bigint DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS issues_opened        bigint DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS releases             bigint DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS flagged_stars        bigint DEFAULT 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_repo_hour ON hourly_aggregates (repo_id, hour);
+CREATE INDEX IF NOT EXISTS idx_hourly_aggregates_hour ON hourly_aggregates (hour DESC);
+
+CREATE TABLE IF NOT EXISTS repo_totals (
+	repo_id                    bigint       PRIMARY KEY,
+	repo_name                  varchar(255) NOT NULL,
+	total_stars                bigint       NOT NULL DEFAULT 0,
+	total_forks                bigint       NOT NULL DEFAULT 0,
+	total_pull_requests_opened bigint       NOT NULL DEFAULT 0,
+	total_pull_requests_merged bigint       NOT NULL DEFAULT 0,
+	total_issues_opened        bigint       NOT NULL DEFAULT 0,
+	total_releases             bigint       NOT NULL DEFAULT 0,
+	created_at                 timestamptz,
+	updated_at                 timestamptz
+);
+ALTER TABLE repo_totals
+	ADD COLUMN IF NOT EXISTS total_forks                bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS total_pull_requests_opened bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS total_pull_requests_merged bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS total_issues_opened        bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS total_releases             bigint NOT NULL DEFAULT 0;
+
+-- Базы, созданные до появления repo_totals, получают суммы из накопленных
+-- часовых агрегатов; уже заполненные строки не меняются.
+INSERT INTO repo_totals (
+	repo_id, repo_name, total_stars, total_forks, total_pull_requests_opened,
+	total_pull_requests_merged, total_issues_opened, total_releases, created_at, updated_at
+)
+SELECT repo_id, MAX(repo_name), SUM(stars), SUM(forks), SUM(pull_requests_opened),
+	SUM(pull_requests_merged), SUM(issues_opened), SUM(releases), NOW(), NOW()
+FROM hourly_aggregates
+GROUP BY repo_id
+ON CONFLICT (repo_id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS processed_events (
+	event_id         varchar(64) PRIMARY KEY,
+	event_created_at timestamptz NOT NULL,
+	processed_at     timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events (processed_at);
+
+CREATE TABLE IF NOT EXISTS ingestion_checkpoints (
+	source     varchar(64) PRIMARY KEY,
+	hour       timestamptz NOT NULL,
+	updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS ingested_hours (
+	hour             timestamptz PRIMARY KEY,
+	status           varchar(16) NOT NULL,
+	attempts         bigint      NOT NULL DEFAULT 0,
+	last_error       text,
+	line_offset      bigint      NOT NULL DEFAULT 0,
+	bytes_downloaded bigint      NOT NULL DEFAULT 0,
+	lines_parsed     bigint      NOT NULL DEFAULT 0,
+	parse_failures   bigint      NOT NULL DEFAULT 0,
+	events_produced  bigint      NOT NULL DEFAULT 0,
+	send_failures    bigint      NOT NULL DEFAULT 0,
+	duration_ms      bigint      NOT NULL DEFAULT 0,
+	filtered_events  bigint      NOT NULL DEFAULT 0,
+	oversized_lines  bigint      NOT NULL DEFAULT 0,
+	truncated        boolean     NOT NULL DEFAULT false,
+	created_at       timestamptz,
+	updated_at       timestamptz
+);
+ALTER TABLE ingested_hours
+	ADD COLUMN IF NOT EXISTS attempts         bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS last_error       text,
+	ADD COLUMN IF NOT EXISTS line_offset      bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS bytes_downloaded bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS lines_parsed     bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS parse_failures   bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS events_produced  bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS send_failures    bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS duration_ms      bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS filtered_events  bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS oversized_lines  bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS truncated        boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_ingested_hours_status ON ingested_hours (status);
+
+CREATE TABLE IF NOT EXISTS suspicious_actors (
+	login            varchar(255) PRIMARY KEY,
+	reason           varchar(32)  NOT NULL,
+	flagged_stars    bigint       NOT NULL DEFAULT 0,
+	first_flagged_at timestamptz  NOT NULL,
+	last_flagged_at  timestamptz  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_suspicious_actors_last_flagged_at ON suspicious_actors (last_flagged_at);
+
+CREATE TABLE IF NOT EXISTS stargazer_sketches (
+	repo_id    bigint      NOT NULL,
+	hour       timestamptz NOT NULL,
+	sketch     bytea       NOT NULL,
+	uniques    bigint      NOT NULL DEFAULT 0,
+	updated_at timestamptz,
+	PRIMARY KEY (repo_id, hour)
+);
+CREATE INDEX IF NOT EXISTS idx_stargazer_sketches_hour ON stargazer_sketches (hour);
+
+-- Дневные секции star_events создает StatsRepo при записи, а удаляет PruneStarEvents.
+CREATE TABLE IF NOT EXISTS star_events (
+	event_id    varchar(64)  NOT NULL,
+	repo_id     bigint       NOT NULL,
+	repo_name   varchar(255) NOT NULL,
+	actor_login varchar(255) NOT NULL,
+	created_at  timestamptz  NOT NULL,
+	flagged     boolean      NOT NULL DEFAULT false,
+	PRIMARY KEY (event_id, created_at)
+) PARTITION BY RANGE (created_at);
+CREATE INDEX IF NOT EXISTS idx_star_events_repo ON star_events (repo_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_star_events_actor ON star_events (actor_login, created_at);
+
+CREATE TABLE IF NOT EXISTS daily_aggregates (
+	repo_id              bigint       NOT NULL,
+	bucket               timestamptz  NOT NULL,
+	repo_name            varchar(255) NOT NULL,
+	stars                bigint       NOT NULL DEFAULT 0,
+	forks                bigint       NOT NULL DEFAULT 0,
+	pull_requests_opened bigint       NOT NULL DEFAULT 0,
+	pull_requests_merged bigint       NOT NULL DEFAULT 0,
+	issues_opened        bigint       NOT NULL DEFAULT 0,
+	releases             bigint       NOT NULL DEFAULT 0,
+	flagged_stars        bigint       NOT NULL DEFAULT 0,
+	updated_at           timestamptz,
+	PRIMARY KEY (repo_id, bucket)
+);
+CREATE INDEX IF NOT EXISTS idx_daily_aggregates_bucket ON daily_aggregates (bucket);
+
+CREATE TABLE IF NOT EXISTS weekly_aggregates (
+	repo_id              bigint       NOT NULL,
+	bucket               timestamptz  NOT NULL,
+	repo_name            varchar(255) NOT NULL,
+	stars                bigint       NOT NULL DEFAULT 0,
+	forks                bigint       NOT NULL DEFAULT 0,
+	pull_requests_opened bigint       NOT NULL DEFAULT 0,
+	pull_requests_merged bigint       NOT NULL DEFAULT 0,
+	issues_opened        bigint       NOT NULL DEFAULT 0,
+	releases             bigint       NOT NULL DEFAULT 0,
+	flagged_stars        bigint       NOT NULL DEFAULT 0,
+	updated_at           timestamptz,
+	PRIMARY KEY (repo_id, bucket)
+);
+CREATE INDEX IF NOT EXISTS idx_weekly_aggregates_bucket ON weekly_aggregates (bucket);
+
+CREATE TABLE IF NOT EXISTS monthly_aggregates (
+	repo_id              bigint       NOT NULL,
+	bucket               timestamptz  NOT NULL,
+	repo_name            varchar(255) NOT NULL,
+	stars                bigint       NOT NULL DEFAULT 0,
+	forks                bigint       NOT NULL DEFAULT 0,
+	pull_requests_opened bigint       NOT NULL DEFAULT 0,
+	pull_requests_merged bigint       NOT NULL DEFAULT 0,
+	issues_opened        bigint       NOT NULL DEFAULT 0,
+	releases             bigint       NOT NULL DEFAULT 0,
+	flagged_stars        bigint       NOT NULL DEFAULT 0,
+	updated_at           timestamptz,
+	PRIMARY KEY (repo_id, bucket)
+);
+CREATE INDEX IF NOT EXISTS idx_monthly_aggregates_bucket ON monthly_aggregates (bucket);
+
+CREATE TABLE IF NOT EXISTS rollup_watermarks (
+	granularity     varchar(16) PRIMARY KEY,
+	compacted_until timestamptz NOT NULL,
+	updated_at      timestamptz
+);
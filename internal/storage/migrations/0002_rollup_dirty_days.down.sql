@@ -0,0 +1,2 @@
+DELETE FROM rollup_watermarks WHERE granularity = 'hour';
+DROP TABLE IF EXISTS rollup_dirty_days;
@@ -0,0 +1,16 @@
+-- Сутки, в которые после свертки попали опоздавшие часовые агрегаты.
+-- Compaction пересчитывает их и удаляет отметку в той же транзакции.
+CREATE TABLE IF NOT EXISTS rollup_dirty_days (
+	day       timestamptz PRIMARY KEY,
+	marked_at timestamptz NOT NULL
+);
+
+-- Запись hour в rollup_watermarks хранит границу удаления часовых агрегатов:
+-- сутки раньше нее нельзя пересчитать. Если сутки уже сворачивались, часы до
+-- первых сохранившихся могли быть удалены.
+INSERT INTO rollup_watermarks (granularity, compacted_until, updated_at)
+SELECT 'hour', date_trunc('day', MIN(hour), 'UTC'), NOW()
+FROM hourly_aggregates
+HAVING MIN(hour) IS NOT NULL
+	AND EXISTS (SELECT 1 FROM rollup_watermarks WHERE granularity = 'day')
+ON CONFLICT (granularity) DO NOTHING;
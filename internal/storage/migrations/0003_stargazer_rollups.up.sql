@@ -0,0 +1,23 @@
+-- Счетчики уникальных аккаунтов суток, недель и месяцев. Compaction строит их
+-- вместе со свертками агрегатов и удаляет часовые счетчики вместе с часовыми агрегатами.
+CREATE TABLE IF NOT EXISTS stargazer_rollups (
+	granularity varchar(16) NOT NULL,
+	repo_id     bigint      NOT NULL,
+	bucket      timestamptz NOT NULL,
+	sketch      bytea       NOT NULL,
+	uniques     bigint      NOT NULL DEFAULT 0,
+	updated_at  timestamptz,
+	PRIMARY KEY (granularity, repo_id, bucket)
+);
+
+-- Уже свернутые сутки с сохранившимися часовыми агрегатами сворачиваются заново,
+-- чтобы получить счетчики; недели и месяцы пересчитываются вслед за сутками.
+-- Сутки раньше границы удаления часов пересчитать нельзя: их счетчики в свертки
+-- не попадают и удаляются при следующем удалении часовых агрегатов.
+INSERT INTO rollup_dirty_days (day, marked_at)
+SELECT DISTINCT date_trunc('day', s.hour, 'UTC'), NOW()
+FROM stargazer_sketches AS s
+JOIN rollup_watermarks AS d ON d.granularity = 'day' AND s.hour < d.compacted_until
+LEFT JOIN rollup_watermarks AS h ON h.granularity = 'hour'
+WHERE h.compacted_until IS NULL OR s.hour >= h.compacted_until
+ON CONFLICT (day) DO NOTHING;
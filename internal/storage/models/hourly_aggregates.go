@@ -9,7 +9,16 @@ type HourlyAggregate struct {
 	RepoID   int64  `gorm:"not null;uniqueIndex:idx_repo_hour"`
 	RepoName string `gorm:"type:varchar(255);not null"`
 	Stars    int    `gorm:"default:0"`
-	// Forks    int       `gorm:"default:0"`
+	Forks    int    `gorm:"default:0"`
+
+	PullRequestsOpened int `gorm:"default:0"`
+	PullRequestsMerged int `gorm:"default:0"`
+	IssuesOpened       int `gorm:"default:0"`
+	Releases           int `gorm:"default:0"`
+
+	// FlaggedStars считает звезды, помеченные подозрительными; входят в Stars.
+	FlaggedStars int `gorm:"default:0"`
+
 	Hour time.Time `gorm:"not null;uniqueIndex:idx_repo_hour;index:,sort:desc"`
 
 	CreatedAt time.Time `gorm:"autoCreateTime"`
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// HourStats содержит счетчики одной загрузки часа, см. domain.HourStats.
+type HourStats struct {
+	BytesDownloaded int64 `gorm:"not null;default:0"`
+	LinesParsed     int64 `gorm:"not null;default:0"`
+	ParseFailures   int64 `gorm:"not null;default:0"`
+	EventsProduced  int64 `gorm:"not null;default:0"`
+	SendFailures    int64 `gorm:"not null;default:0"`
+	DurationMs      int64 `gorm:"not null;default:0"`
+	// FilteredEvents считает события, отброшенные правилами фильтра ingestion.
+	FilteredEvents int64 `gorm:"not null;default:0"`
+	// OversizedLines считает строки, пропущенные из-за превышения длины.
+	OversizedLines int64 `gorm:"not null;default:0"`
+	// Truncated означает, что дамп поврежден и загружена только его начальная часть.
+	Truncated bool `gorm:"not null;default:false"`
+}
+
+// IngestedHour представляет запись журнала загрузки часа GH Archive.
+type IngestedHour struct {
+	Hour time.Time `gorm:"primaryKey"`
+	// Status содержит значение domain.IngestedHourStatus.
+	Status string `gorm:"type:varchar(16);not null;index"`
+	// Attempts считает все неудачные попытки загрузить час.
+	Attempts  int    `gorm:"not null;default:0"`
+	LastError string `gorm:"type:text"`
+	// LineOffset содержит число уже опубликованных строк незавершенного часа.
+	LineOffset int64 `gorm:"not null;default:0"`
+	// HourStats содержит счетчики последней загрузки.
+	HourStats `gorm:"embedded"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// IngestionCheckpoint представляет последний полностью опубликованный час источника.
+type IngestionCheckpoint struct {
+	Source string    `gorm:"primaryKey;type:varchar(64)"`
+	Hour   time.Time `gorm:"not null"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// ProcessedEvent представляет уже учтенное в агрегатах событие.
+type ProcessedEvent struct {
+	EventID        string    `gorm:"primaryKey;type:varchar(64)"`
+	EventCreatedAt time.Time `gorm:"not null"`
+	ProcessedAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RepoTotal представляет накопленные за всё время счетчики репозитория.
+type RepoTotal struct {
+	RepoID     int64  `gorm:"primaryKey;autoIncrement:false"`
+	RepoName   string `gorm:"type:varchar(255);not null"`
+	TotalStars int64  `gorm:"not null;default:0"`
+	TotalForks int64  `gorm:"not null;default:0"`
+
+	TotalPullRequestsOpened int64 `gorm:"not null;default:0"`
+	TotalPullRequestsMerged int64 `gorm:"not null;default:0"`
+	TotalIssuesOpened       int64 `gorm:"not null;default:0"`
+	TotalReleases           int64 `gorm:"not null;default:0"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
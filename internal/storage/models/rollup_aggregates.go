@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// RollupAggregate содержит сумму часовых агрегатов репозитория за корзину
+// (сутки, неделю или месяц), начинающуюся в Bucket.
+type RollupAggregate struct {
+	RepoID   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Bucket   time.Time `gorm:"primaryKey;index"`
+	RepoName string    `gorm:"type:varchar(255);not null"`
+	Stars    int64     `gorm:"not null;default:0"`
+	Forks    int64     `gorm:"not null;default:0"`
+
+	PullRequestsOpened int64 `gorm:"not null;default:0"`
+	PullRequestsMerged int64 `gorm:"not null;default:0"`
+	IssuesOpened       int64 `gorm:"not null;default:0"`
+	Releases           int64 `gorm:"not null;default:0"`
+	FlaggedStars       int64 `gorm:"not null;default:0"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// DailyAggregate содержит суточные суммы.
+type DailyAggregate struct {
+	RollupAggregate
+}
+
+// WeeklyAggregate содержит недельные суммы.
+type WeeklyAggregate struct {
+	RollupAggregate
+}
+
+// MonthlyAggregate содержит месячные суммы.
+type MonthlyAggregate struct {
+	RollupAggregate
+}
+
+// RollupWatermark хранит границу свертки гранулярности: все корзины раньше
+// CompactedUntil свернуты. Запись гранулярности hour хранит границу удаления
+// часовых агрегатов: часы раньше CompactedUntil удалены.
+type RollupWatermark struct {
+	Granularity    string    `gorm:"primaryKey;type:varchar(16)"`
+	CompactedUntil time.Time `gorm:"not null"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// RollupDirtyDay отмечает свернутые сутки, в которые позже попали опоздавшие
+// часовые агрегаты. Такие сутки сворачиваются заново.
+type RollupDirtyDay struct {
+	Day      time.Time `gorm:"primaryKey"`
+	MarkedAt time.Time `gorm:"not null"`
+}
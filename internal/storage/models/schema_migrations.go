@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SchemaMigration представляет примененную миграцию схемы.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
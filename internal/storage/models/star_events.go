@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// StarEvent представляет сохраненное событие звезды. Таблица star_events
+// секционирована по дням created_at и создается миграцией из storage/migrations.
+type StarEvent struct {
+	EventID    string
+	RepoID     int64
+	RepoName   string
+	ActorLogin string
+	CreatedAt  time.Time `gorm:"autoCreateTime:false"`
+	// Flagged означает, что звезда была помечена подозрительной при учете
+	// или задним числом.
+	Flagged bool
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// StargazerSketch хранит счетчик уникальных аккаунтов, поставивших звезды
+// репозиторию за час, в формате pkg/hll.
+type StargazerSketch struct {
+	RepoID int64     `gorm:"primaryKey;autoIncrement:false"`
+	Hour   time.Time `gorm:"primaryKey;index"`
+	Sketch []byte    `gorm:"type:bytea;not null"`
+	// Uniques содержит оценку Sketch за час.
+	Uniques int64 `gorm:"not null;default:0"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// StargazerRollup хранит счетчик уникальных аккаунтов, поставивших звезды
+// репозиторию за корзину свертки (сутки, неделю или месяц), начинающуюся в Bucket.
+type StargazerRollup struct {
+	Granularity string    `gorm:"primaryKey;type:varchar(16)"`
+	RepoID      int64     `gorm:"primaryKey;autoIncrement:false"`
+	Bucket      time.Time `gorm:"primaryKey"`
+	Sketch      []byte    `gorm:"type:bytea;not null"`
+	// Uniques содержит оценку Sketch за корзину.
+	Uniques int64 `gorm:"not null;default:0"`
+
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
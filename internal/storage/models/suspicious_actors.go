@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SuspiciousActor представляет аккаунт, замеченный в накрутке звезд.
+type SuspiciousActor struct {
+	Login  string `gorm:"primaryKey;type:varchar(255)"`
+	Reason string `gorm:"type:varchar(32);not null"`
+	// FlaggedStars считает все звезды аккаунта, помеченные подозрительными.
+	FlaggedStars   int64     `gorm:"not null;default:0"`
+	FirstFlaggedAt time.Time `gorm:"not null"`
+	LastFlaggedAt  time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,58 @@
+// Package backoff предоставляет экспоненциальные задержки с джиттером для повторных попыток.
+package backoff
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff вычисляет задержки между повторными попытками.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// New создает Backoff из значений в миллисекундах.
+func New(initialMs, maxMs int) Backoff {
+	return Backoff{
+		Initial: time.Duration(initialMs) * time.Millisecond,
+		Max:     time.Duration(maxMs) * time.Millisecond,
+	}
+}
+
+// Delay возвращает задержку перед попыткой attempt+1 (attempt начинается с 1):
+// случайное значение из [d/2, d], где d = Initial * 2^(attempt-1), но не больше Max.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Initial <= 0 {
+		return 0
+	}
+
+	d := b.Initial
+	for i := 1; i < attempt && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// Sleep ждет d или отмены контекста.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
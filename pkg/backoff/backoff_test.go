@@ -0,0 +1,44 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+
+	cases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 100 * time.Millisecond},
+		{attempt: 2, max: 200 * time.Millisecond},
+		{attempt: 3, max: 400 * time.Millisecond},
+		{attempt: 5, max: time.Second},
+		{attempt: 50, max: time.Second},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			d := b.Delay(c.attempt)
+			require.GreaterOrEqual(t, d, c.max/2)
+			require.LessOrEqual(t, d, c.max)
+		}
+	}
+}
+
+func TestDelay_Disabled(t *testing.T) {
+	require.Zero(t, Backoff{}.Delay(3))
+}
+
+func TestSleep_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Sleep(ctx, time.Hour)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,233 @@
+// Package hll предоставляет счетчик уникальных значений: точный для небольших
+// множеств и HyperLogLog для больших. Счетчики можно объединять и сериализовать.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+const (
+	// precision задает число бит хеша для номера регистра.
+	precision = 14
+	// registers задает число регистров плотного представления; ошибка оценки около 0.8%.
+	registers = 1 << precision
+	// maxExact задает число хешей, после которого счетчик переходит на регистры.
+	maxExact = 1024
+)
+
+// Форматы сериализации.
+const (
+	formatExact byte = 1
+	formatDense byte = 2
+)
+
+// Sketch считает уникальные значения. Пока значений не больше maxExact, хранит
+// их хеши и считает точно, затем переходит на регистры HyperLogLog.
+// Нулевое значение готово к использованию.
+type Sketch struct {
+	// hashes содержит отсортированные уникальные хеши точного представления.
+	hashes []uint64
+	// registers содержит регистры плотного представления; nil для точного.
+	registers []uint8
+}
+
+// New создает пустой счетчик.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add учитывает значение.
+func (s *Sketch) Add(value string) {
+	s.addHash(hash(value))
+}
+
+func (s *Sketch) addHash(h uint64) {
+	if s.registers != nil {
+		s.setRegister(h)
+		return
+	}
+	i, found := slices.BinarySearch(s.hashes, h)
+	if found {
+		return
+	}
+	s.hashes = slices.Insert(s.hashes, i, h)
+	if len(s.hashes) > maxExact {
+		s.densify()
+	}
+}
+
+// Merge добавляет к счетчику значения other.
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil {
+		return
+	}
+	if other.registers != nil {
+		s.densify()
+		for i, rank := range other.registers {
+			s.registers[i] = max(s.registers[i], rank)
+		}
+		return
+	}
+	if s.registers != nil {
+		for _, h := range other.hashes {
+			s.setRegister(h)
+		}
+		return
+	}
+
+	merged := make([]uint64, 0, len(s.hashes)+len(other.hashes))
+	i, j := 0, 0
+	for i < len(s.hashes) || j < len(other.hashes) {
+		switch {
+		case j == len(other.hashes) || (i < len(s.hashes) && s.hashes[i] < other.hashes[j]):
+			merged = append(merged, s.hashes[i])
+			i++
+		case i == len(s.hashes) || other.hashes[j] < s.hashes[i]:
+			merged = append(merged, other.hashes[j])
+			j++
+		default:
+			merged = append(merged, s.hashes[i])
+			i++
+			j++
+		}
+	}
+	s.hashes = merged
+	if len(s.hashes) > maxExact {
+		s.densify()
+	}
+}
+
+// Count возвращает число уникальных значений: точное для точного
+// представления и оценку HyperLogLog для плотного.
+func (s *Sketch) Count() uint64 {
+	if s.registers == nil {
+		return uint64(len(s.hashes))
+	}
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Для малых оценок линейный подсчет по пустым регистрам точнее.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// Exact сообщает, что счетчик считает точно.
+func (s *Sketch) Exact() bool {
+	return s.registers == nil
+}
+
+// densify переводит счетчик на регистры.
+func (s *Sketch) densify() {
+	if s.registers != nil {
+		return
+	}
+	s.registers = make([]uint8, registers)
+	for _, h := range s.hashes {
+		s.setRegister(h)
+	}
+	s.hashes = nil
+}
+
+func (s *Sketch) setRegister(h uint64) {
+	index := h >> (64 - precision)
+	rank := uint8(min(bits.LeadingZeros64(h<<precision), 64-precision) + 1)
+	s.registers[index] = max(s.registers[index], rank)
+}
+
+// MarshalBinary сериализует счетчик. Точное представление хранит разности
+// отсортированных хешей в varint, плотное — байт на регистр.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.registers != nil {
+		data := make([]byte, 0, 2+registers)
+		data = append(data, formatDense, precision)
+		return append(data, s.registers...), nil
+	}
+
+	data := make([]byte, 0, 1+binary.MaxVarintLen64*(len(s.hashes)+1))
+	data = append(data, formatExact)
+	data = binary.AppendUvarint(data, uint64(len(s.hashes)))
+	prev := uint64(0)
+	for _, h := range s.hashes {
+		data = binary.AppendUvarint(data, h-prev)
+		prev = h
+	}
+	return data, nil
+}
+
+// errCorrupt возвращается при разборе поврежденных данных.
+var errCorrupt = errors.New("corrupt sketch")
+
+// UnmarshalBinary восстанавливает счетчик из данных MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errCorrupt
+	}
+
+	switch data[0] {
+	case formatDense:
+		if len(data) != 2+registers || data[1] != precision {
+			return fmt.Errorf("%w: unexpected dense size %d", errCorrupt, len(data))
+		}
+		s.hashes = nil
+		s.registers = slices.Clone(data[2:])
+		return nil
+	case formatExact:
+		data = data[1:]
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > maxExact {
+			return fmt.Errorf("%w: bad hash count", errCorrupt)
+		}
+		data = data[n:]
+
+		hashes := make([]uint64, count)
+		prev := uint64(0)
+		for i := range hashes {
+			delta, n := binary.Uvarint(data)
+			if n <= 0 || (i > 0 && delta == 0) {
+				return fmt.Errorf("%w: bad hash %d", errCorrupt, i)
+			}
+			data = data[n:]
+			prev += delta
+			hashes[i] = prev
+		}
+		if len(data) != 0 {
+			return fmt.Errorf("%w: trailing bytes", errCorrupt)
+		}
+		s.hashes = hashes
+		s.registers = nil
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown format %d", errCorrupt, data[0])
+	}
+}
+
+// hash возвращает 64-битный хеш значения. FNV-1a перемешивается финализатором
+// MurmurHash3, чтобы старшие биты, задающие номер регистра, были равномерными.
+func hash(value string) uint64 {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(value))
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,122 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fill(s *Sketch, prefix string, n int) {
+	for i := 0; i < n; i++ {
+		s.Add(fmt.Sprintf("%s-%d", prefix, i))
+	}
+}
+
+func TestSketch_ExactForSmallSets(t *testing.T) {
+	s := New()
+	fill(s, "user", 500)
+	fill(s, "user", 500)
+
+	assert.True(t, s.Exact())
+	assert.Equal(t, uint64(500), s.Count())
+}
+
+func TestSketch_EstimatesLargeSets(t *testing.T) {
+	for _, n := range []int{2000, 20000, 200000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			s := New()
+			fill(s, "user", n)
+
+			require.False(t, s.Exact())
+			assert.InEpsilon(t, float64(n), float64(s.Count()), 0.03)
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b int
+	}{
+		{name: "exact", a: 300, b: 300},
+		{name: "exact_to_dense", a: 800, b: 800},
+		{name: "dense", a: 30000, b: 30000},
+		{name: "mixed", a: 100, b: 30000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Половина значений b совпадает со значениями a.
+			a, b := New(), New()
+			fill(a, "user", c.a)
+			fill(b, "user", c.b/2)
+			fill(b, "other", c.b-c.b/2)
+
+			want := float64(max(c.a, c.b/2) + c.b - c.b/2)
+
+			merged := New()
+			merged.Merge(a)
+			merged.Merge(b)
+			assert.InEpsilon(t, want, float64(merged.Count()), 0.03)
+
+			reversed := New()
+			reversed.Merge(b)
+			reversed.Merge(a)
+			assert.Equal(t, merged.Count(), reversed.Count())
+		})
+	}
+}
+
+func TestSketch_MarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 50000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			s := New()
+			fill(s, "user", n)
+
+			data, err := s.MarshalBinary()
+			require.NoError(t, err)
+
+			restored := New()
+			require.NoError(t, restored.UnmarshalBinary(data))
+			assert.Equal(t, s.Count(), restored.Count())
+			assert.Equal(t, s.Exact(), restored.Exact())
+		})
+	}
+}
+
+func TestSketch_UnmarshalCorrupt(t *testing.T) {
+	s := New()
+	fill(s, "user", 10)
+	data, err := s.MarshalBinary()
+	require.NoError(t, err)
+
+	for name, corrupt := range map[string][]byte{
+		"empty":     nil,
+		"format":    {9},
+		"truncated": data[:len(data)-1],
+		"trailing":  append(append([]byte(nil), data...), 1),
+		"dense":     {formatDense, precision, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, New().UnmarshalBinary(corrupt), errCorrupt)
+		})
+	}
+}
+
+func TestHash_SpreadsRegisters(t *testing.T) {
+	s := New()
+	s.densify()
+	fill(s, "user", registers*4)
+
+	zeros := 0
+	for _, rank := range s.registers {
+		if rank == 0 {
+			zeros++
+		}
+	}
+	// При равномерном хеше пустыми остаются около e^-4 регистров.
+	assert.Less(t, float64(zeros), 2*registers*math.Exp(-4))
+}
@@ -4,26 +4,39 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// Message представляет сообщение Kafka вместе с его метаданными.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+}
+
 // Consumer потребляет сообщения из Kafka.
 type Consumer struct {
-	reader *kafka.Reader
+	reader  *kafka.Reader
+	groupID string
 }
 
-// NewConsumer создает новый Consumer.
-func NewConsumer(brokers []string, topic /*,groupID*/ string) *Consumer {
+// NewConsumer создает новый Consumer. При непустом groupID потребитель работает
+// в составе группы и смещения фиксируются только явным вызовом Commit.
+func NewConsumer(brokers []string, topic, groupID string) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: brokers,
 		Topic:   topic,
-		// GroupID: groupID,
+		GroupID: groupID,
 	})
-	return &Consumer{reader: reader}
+	return &Consumer{reader: reader, groupID: groupID}
 }
 
-// Read читает сообщение из Kafka.
+// Read читает сообщение из Kafka. В режиме группы смещение фиксируется автоматически.
 func (c *Consumer) Read(ctx context.Context) ([]byte, error) {
 	message, err := c.reader.ReadMessage(ctx)
 	if err != nil {
@@ -32,6 +45,43 @@ func (c *Consumer) Read(ctx context.Context) ([]byte, error) {
 	return message.Value, nil
 }
 
+// Fetch читает следующее сообщение из Kafka без фиксации смещения.
+func (c *Consumer) Fetch(ctx context.Context) (Message, error) {
+	message, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, fmt.Errorf("fetching message from Kafka: %w", err)
+	}
+	return Message{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Time:      message.Time,
+	}, nil
+}
+
+// Commit фиксирует смещения переданных сообщений. Вне группы ничего не делает.
+func (c *Consumer) Commit(ctx context.Context, msgs ...Message) error {
+	if c.groupID == "" || len(msgs) == 0 {
+		return nil
+	}
+
+	kafkaMsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		kafkaMsgs[i] = kafka.Message{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+		}
+	}
+
+	if err := c.reader.CommitMessages(ctx, kafkaMsgs...); err != nil {
+		return fmt.Errorf("committing offsets: %w", err)
+	}
+	return nil
+}
+
 // Close закрывает Consumer.
 func (c *Consumer) Close() error {
 	return c.reader.Close()
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -11,6 +12,7 @@ func TestNewConsumer(t *testing.T) {
 		name    string
 		brokers []string
 		topic   string
+		groupID string
 	}{
 		{
 			name:    "single_broker",
@@ -22,13 +24,27 @@ func TestNewConsumer(t *testing.T) {
 			brokers: []string{"broker1:9092", "broker2:9092"},
 			topic:   "events",
 		},
+		{
+			name:    "consumer_group",
+			brokers: []string{"localhost:9092"},
+			topic:   "events",
+			groupID: "processor",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			consumer := NewConsumer(tt.brokers, tt.topic)
+			consumer := NewConsumer(tt.brokers, tt.topic, tt.groupID)
 			require.NotNil(t, consumer)
 			require.NotNil(t, consumer.reader)
+			require.Equal(t, tt.groupID, consumer.reader.Config().GroupID)
 		})
 	}
 }
+
+func TestCommit_WithoutGroupIsNoop(t *testing.T) {
+	consumer := NewConsumer([]string{"localhost:9092"}, "events", "")
+
+	err := consumer.Commit(context.Background(), Message{Topic: "events", Partition: 0, Offset: 10})
+	require.NoError(t, err)
+}
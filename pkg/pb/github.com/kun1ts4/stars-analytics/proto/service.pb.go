@@ -9,6 +9,7 @@ package proto
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -21,9 +22,248 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Window задает предопределенное окно времени для TopN.
+type Window int32
+
+const (
+	// Последний полный час (по умолчанию).
+	Window_WINDOW_LAST_HOUR Window = 0
+	// Последние 24 полных часа.
+	Window_WINDOW_LAST_DAY Window = 1
+	// Последние 7 суток (168 полных часов).
+	Window_WINDOW_LAST_WEEK Window = 2
+	// Произвольный диапазон [start, end), задается полями start и end.
+	Window_WINDOW_CUSTOM Window = 3
+)
+
+// Enum value maps for Window.
+var (
+	Window_name = map[int32]string{
+		0: "WINDOW_LAST_HOUR",
+		1: "WINDOW_LAST_DAY",
+		2: "WINDOW_LAST_WEEK",
+		3: "WINDOW_CUSTOM",
+	}
+	Window_value = map[string]int32{
+		"WINDOW_LAST_HOUR": 0,
+		"WINDOW_LAST_DAY":  1,
+		"WINDOW_LAST_WEEK": 2,
+		"WINDOW_CUSTOM":    3,
+	}
+)
+
+func (x Window) Enum() *Window {
+	p := new(Window)
+	*p = x
+	return p
+}
+
+func (x Window) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Window) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_proto_enumTypes[0].Descriptor()
+}
+
+func (Window) Type() protoreflect.EnumType {
+	return &file_service_proto_enumTypes[0]
+}
+
+func (x Window) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Window.Descriptor instead.
+func (Window) EnumDescriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{0}
+}
+
+// Metric задает счетчик, по которому строится TopN.
+type Metric int32
+
+const (
+	// Звезды (по умолчанию).
+	Metric_METRIC_STARS Metric = 0
+	Metric_METRIC_FORKS Metric = 1
+	// Открытые pull request.
+	Metric_METRIC_PRS_OPENED Metric = 2
+	// Слитые pull request.
+	Metric_METRIC_PRS_MERGED Metric = 3
+	// Открытые issue.
+	Metric_METRIC_ISSUES_OPENED Metric = 4
+	// Опубликованные релизы.
+	Metric_METRIC_RELEASES Metric = 5
+)
+
+// Enum value maps for Metric.
+var (
+	Metric_name = map[int32]string{
+		0: "METRIC_STARS",
+		1: "METRIC_FORKS",
+		2: "METRIC_PRS_OPENED",
+		3: "METRIC_PRS_MERGED",
+		4: "METRIC_ISSUES_OPENED",
+		5: "METRIC_RELEASES",
+	}
+	Metric_value = map[string]int32{
+		"METRIC_STARS":         0,
+		"METRIC_FORKS":         1,
+		"METRIC_PRS_OPENED":    2,
+		"METRIC_PRS_MERGED":    3,
+		"METRIC_ISSUES_OPENED": 4,
+		"METRIC_RELEASES":      5,
+	}
+)
+
+func (x Metric) Enum() *Metric {
+	p := new(Metric)
+	*p = x
+	return p
+}
+
+func (x Metric) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Metric) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_proto_enumTypes[1].Descriptor()
+}
+
+func (Metric) Type() protoreflect.EnumType {
+	return &file_service_proto_enumTypes[1]
+}
+
+func (x Metric) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Metric.Descriptor instead.
+func (Metric) EnumDescriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{1}
+}
+
+// SpamMode задает учет звезд, помеченных подозрительными.
+type SpamMode int32
+
+const (
+	// Учитывать все звезды (по умолчанию).
+	SpamMode_SPAM_MODE_INCLUDE SpamMode = 0
+	// Не учитывать подозрительные звезды.
+	SpamMode_SPAM_MODE_EXCLUDE SpamMode = 1
+	// Учитывать подозрительные звезды с весом flagged_weight.
+	SpamMode_SPAM_MODE_DISCOUNT SpamMode = 2
+)
+
+// Enum value maps for SpamMode.
+var (
+	SpamMode_name = map[int32]string{
+		0: "SPAM_MODE_INCLUDE",
+		1: "SPAM_MODE_EXCLUDE",
+		2: "SPAM_MODE_DISCOUNT",
+	}
+	SpamMode_value = map[string]int32{
+		"SPAM_MODE_INCLUDE":  0,
+		"SPAM_MODE_EXCLUDE":  1,
+		"SPAM_MODE_DISCOUNT": 2,
+	}
+)
+
+func (x SpamMode) Enum() *SpamMode {
+	p := new(SpamMode)
+	*p = x
+	return p
+}
+
+func (x SpamMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SpamMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_proto_enumTypes[2].Descriptor()
+}
+
+func (SpamMode) Type() protoreflect.EnumType {
+	return &file_service_proto_enumTypes[2]
+}
+
+func (x SpamMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SpamMode.Descriptor instead.
+func (SpamMode) EnumDescriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{2}
+}
+
+// Granularity задает размер корзины временного ряда.
+type Granularity int32
+
+const (
+	Granularity_GRANULARITY_HOUR Granularity = 0
+	Granularity_GRANULARITY_DAY  Granularity = 1
+	// Неделя с понедельника (UTC).
+	Granularity_GRANULARITY_WEEK Granularity = 2
+	// Календарный месяц (UTC).
+	Granularity_GRANULARITY_MONTH Granularity = 3
+)
+
+// Enum value maps for Granularity.
+var (
+	Granularity_name = map[int32]string{
+		0: "GRANULARITY_HOUR",
+		1: "GRANULARITY_DAY",
+		2: "GRANULARITY_WEEK",
+		3: "GRANULARITY_MONTH",
+	}
+	Granularity_value = map[string]int32{
+		"GRANULARITY_HOUR":  0,
+		"GRANULARITY_DAY":   1,
+		"GRANULARITY_WEEK":  2,
+		"GRANULARITY_MONTH": 3,
+	}
+)
+
+func (x Granularity) Enum() *Granularity {
+	p := new(Granularity)
+	*p = x
+	return p
+}
+
+func (x Granularity) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Granularity) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_proto_enumTypes[3].Descriptor()
+}
+
+func (Granularity) Type() protoreflect.EnumType {
+	return &file_service_proto_enumTypes[3]
+}
+
+func (x Granularity) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Granularity.Descriptor instead.
+func (Granularity) EnumDescriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{3}
+}
+
 type NRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	N             uint64                 `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	N      uint64                 `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	Window Window                 `protobuf:"varint,2,opt,name=window,proto3,enum=api.Window" json:"window,omitempty"`
+	// Начало диапазона (включительно), только для WINDOW_CUSTOM.
+	Start *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	// Конец диапазона (не включительно), только для WINDOW_CUSTOM.
+	End    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	Metric Metric                 `protobuf:"varint,5,opt,name=metric,proto3,enum=api.Metric" json:"metric,omitempty"`
+	// Учет подозрительных звезд в звездах окна и метрике звезд.
+	SpamMode SpamMode `protobuf:"varint,6,opt,name=spam_mode,json=spamMode,proto3,enum=api.SpamMode" json:"spam_mode,omitempty"`
+	// Вес подозрительной звезды от 0 до 1 для SPAM_MODE_DISCOUNT; 0 означает вес по умолчанию (0.5).
+	FlaggedWeight float64 `protobuf:"fixed64,7,opt,name=flagged_weight,json=flaggedWeight,proto3" json:"flagged_weight,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,6 +305,48 @@ func (x *NRequest) GetN() uint64 {
 	return 0
 }
 
+func (x *NRequest) GetWindow() Window {
+	if x != nil {
+		return x.Window
+	}
+	return Window_WINDOW_LAST_HOUR
+}
+
+func (x *NRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *NRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *NRequest) GetMetric() Metric {
+	if x != nil {
+		return x.Metric
+	}
+	return Metric_METRIC_STARS
+}
+
+func (x *NRequest) GetSpamMode() SpamMode {
+	if x != nil {
+		return x.SpamMode
+	}
+	return SpamMode_SPAM_MODE_INCLUDE
+}
+
+func (x *NRequest) GetFlaggedWeight() float64 {
+	if x != nil {
+		return x.FlaggedWeight
+	}
+	return 0
+}
+
 type TopResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Repos         []*Repo                `protobuf:"bytes,1,rep,name=repos,proto3" json:"repos,omitempty"`
@@ -110,12 +392,24 @@ func (x *TopResponse) GetRepos() []*Repo {
 }
 
 type Repo struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	StarsLastHour uint64                 `protobuf:"varint,2,opt,name=stars_last_hour,json=starsLastHour,proto3" json:"stars_last_hour,omitempty"`
-	TotalStars    uint64                 `protobuf:"varint,3,opt,name=total_stars,json=totalStars,proto3" json:"total_stars,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Звезды за последний час; заполняется только для WINDOW_LAST_HOUR.
+	StarsLastHour uint64 `protobuf:"varint,2,opt,name=stars_last_hour,json=starsLastHour,proto3" json:"stars_last_hour,omitempty"`
+	TotalStars    uint64 `protobuf:"varint,3,opt,name=total_stars,json=totalStars,proto3" json:"total_stars,omitempty"`
+	// Звезды за запрошенное окно.
+	WindowStars uint64 `protobuf:"varint,4,opt,name=window_stars,json=windowStars,proto3" json:"window_stars,omitempty"`
+	// Значение запрошенной метрики за окно.
+	WindowCount uint64 `protobuf:"varint,5,opt,name=window_count,json=windowCount,proto3" json:"window_count,omitempty"`
+	// Значение запрошенной метрики за всё время.
+	TotalCount uint64 `protobuf:"varint,6,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	// Подозрительные звезды за окно.
+	FlaggedStars uint64 `protobuf:"varint,7,opt,name=flagged_stars,json=flaggedStars,proto3" json:"flagged_stars,omitempty"`
+	// Уникальные аккаунты, поставившие звезды за окно. Точное значение для
+	// небольших множеств, оценка HyperLogLog с ошибкой около 1% для больших.
+	UniqueStargazers uint64 `protobuf:"varint,8,opt,name=unique_stargazers,json=uniqueStargazers,proto3" json:"unique_stargazers,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *Repo) Reset() {
@@ -169,26 +463,71 @@ func (x *Repo) GetTotalStars() uint64 {
 	return 0
 }
 
-type Empty struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+func (x *Repo) GetWindowStars() uint64 {
+	if x != nil {
+		return x.WindowStars
+	}
+	return 0
+}
+
+func (x *Repo) GetWindowCount() uint64 {
+	if x != nil {
+		return x.WindowCount
+	}
+	return 0
+}
+
+func (x *Repo) GetTotalCount() uint64 {
+	if x != nil {
+		return x.TotalCount
+	}
+	return 0
+}
+
+func (x *Repo) GetFlaggedStars() uint64 {
+	if x != nil {
+		return x.FlaggedStars
+	}
+	return 0
+}
+
+func (x *Repo) GetUniqueStargazers() uint64 {
+	if x != nil {
+		return x.UniqueStargazers
+	}
+	return 0
+}
+
+type TimeSeriesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Repo:
+	//
+	//	*TimeSeriesRequest_Name
+	//	*TimeSeriesRequest_Id
+	Repo isTimeSeriesRequest_Repo `protobuf_oneof:"repo"`
+	// Начало диапазона (включительно), выравнивается вниз по granularity.
+	Start *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	// Конец диапазона (не включительно), выравнивается вверх по granularity.
+	End           *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	Granularity   Granularity            `protobuf:"varint,5,opt,name=granularity,proto3,enum=api.Granularity" json:"granularity,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Empty) Reset() {
-	*x = Empty{}
+func (x *TimeSeriesRequest) Reset() {
+	*x = TimeSeriesRequest{}
 	mi := &file_service_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Empty) String() string {
+func (x *TimeSeriesRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Empty) ProtoMessage() {}
+func (*TimeSeriesRequest) ProtoMessage() {}
 
-func (x *Empty) ProtoReflect() protoreflect.Message {
+func (x *TimeSeriesRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_service_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -200,32 +539,95 @@ func (x *Empty) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
-func (*Empty) Descriptor() ([]byte, []int) {
+// Deprecated: Use TimeSeriesRequest.ProtoReflect.Descriptor instead.
+func (*TimeSeriesRequest) Descriptor() ([]byte, []int) {
 	return file_service_proto_rawDescGZIP(), []int{3}
 }
 
-type HealthyResponse struct {
+func (x *TimeSeriesRequest) GetRepo() isTimeSeriesRequest_Repo {
+	if x != nil {
+		return x.Repo
+	}
+	return nil
+}
+
+func (x *TimeSeriesRequest) GetName() string {
+	if x != nil {
+		if x, ok := x.Repo.(*TimeSeriesRequest_Name); ok {
+			return x.Name
+		}
+	}
+	return ""
+}
+
+func (x *TimeSeriesRequest) GetId() int64 {
+	if x != nil {
+		if x, ok := x.Repo.(*TimeSeriesRequest_Id); ok {
+			return x.Id
+		}
+	}
+	return 0
+}
+
+func (x *TimeSeriesRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *TimeSeriesRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *TimeSeriesRequest) GetGranularity() Granularity {
+	if x != nil {
+		return x.Granularity
+	}
+	return Granularity_GRANULARITY_HOUR
+}
+
+type isTimeSeriesRequest_Repo interface {
+	isTimeSeriesRequest_Repo()
+}
+
+type TimeSeriesRequest_Name struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3,oneof"`
+}
+
+type TimeSeriesRequest_Id struct {
+	Id int64 `protobuf:"varint,2,opt,name=id,proto3,oneof"`
+}
+
+func (*TimeSeriesRequest_Name) isTimeSeriesRequest_Repo() {}
+
+func (*TimeSeriesRequest_Id) isTimeSeriesRequest_Repo() {}
+
+type TimeSeriesPoint struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Bucket        *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Stars         uint64                 `protobuf:"varint,2,opt,name=stars,proto3" json:"stars,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *HealthyResponse) Reset() {
-	*x = HealthyResponse{}
+func (x *TimeSeriesPoint) Reset() {
+	*x = TimeSeriesPoint{}
 	mi := &file_service_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HealthyResponse) String() string {
+func (x *TimeSeriesPoint) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HealthyResponse) ProtoMessage() {}
+func (*TimeSeriesPoint) ProtoMessage() {}
 
-func (x *HealthyResponse) ProtoReflect() protoreflect.Message {
+func (x *TimeSeriesPoint) ProtoReflect() protoreflect.Message {
 	mi := &file_service_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -237,90 +639,915 @@ func (x *HealthyResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HealthyResponse.ProtoReflect.Descriptor instead.
-func (*HealthyResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use TimeSeriesPoint.ProtoReflect.Descriptor instead.
+func (*TimeSeriesPoint) Descriptor() ([]byte, []int) {
 	return file_service_proto_rawDescGZIP(), []int{4}
 }
 
-func (x *HealthyResponse) GetStatus() string {
+func (x *TimeSeriesPoint) GetBucket() *timestamppb.Timestamp {
 	if x != nil {
-		return x.Status
+		return x.Bucket
 	}
-	return ""
+	return nil
 }
 
-var File_service_proto protoreflect.FileDescriptor
+func (x *TimeSeriesPoint) GetStars() uint64 {
+	if x != nil {
+		return x.Stars
+	}
+	return 0
+}
 
-const file_service_proto_rawDesc = "" +
-	"\n" +
-	"\rservice.proto\x12\x03api\"\x18\n" +
-	"\bNRequest\x12\f\n" +
-	"\x01n\x18\x01 \x01(\x04R\x01n\".\n" +
-	"\vTopResponse\x12\x1f\n" +
-	"\x05repos\x18\x01 \x03(\v2\t.api.RepoR\x05repos\"c\n" +
-	"\x04Repo\x12\x12\n" +
-	"\x04name\x18\x01 \x01(\tR\x04name\x12&\n" +
-	"\x0fstars_last_hour\x18\x02 \x01(\x04R\rstarsLastHour\x12\x1f\n" +
-	"\vtotal_stars\x18\x03 \x01(\x04R\n" +
-	"totalStars\"\a\n" +
-	"\x05Empty\")\n" +
-	"\x0fHealthyResponse\x12\x16\n" +
-	"\x06status\x18\x01 \x01(\tR\x06status2]\n" +
-	"\x05Stats\x12'\n" +
-	"\x04TopN\x12\r.api.NRequest\x1a\x10.api.TopResponse\x12+\n" +
-	"\aHealthy\x12\n" +
-	".api.Empty\x1a\x14.api.HealthyResponseB0Z.github.com/kun1ts4/stars-analytics/proto;protob\x06proto3"
+type TimeSeriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RepoId        int64                  `protobuf:"varint,1,opt,name=repo_id,json=repoId,proto3" json:"repo_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Points        []*TimeSeriesPoint     `protobuf:"bytes,3,rep,name=points,proto3" json:"points,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-var (
-	file_service_proto_rawDescOnce sync.Once
-	file_service_proto_rawDescData []byte
-)
+func (x *TimeSeriesResponse) Reset() {
+	*x = TimeSeriesResponse{}
+	mi := &file_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
 
-func file_service_proto_rawDescGZIP() []byte {
-	file_service_proto_rawDescOnce.Do(func() {
-		file_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)))
-	})
-	return file_service_proto_rawDescData
+func (x *TimeSeriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
-var file_service_proto_goTypes = []any{
-	(*NRequest)(nil),        // 0: api.NRequest
-	(*TopResponse)(nil),     // 1: api.TopResponse
-	(*Repo)(nil),            // 2: api.Repo
-	(*Empty)(nil),           // 3: api.Empty
-	(*HealthyResponse)(nil), // 4: api.HealthyResponse
+func (*TimeSeriesResponse) ProtoMessage() {}
+
+func (x *TimeSeriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_service_proto_depIdxs = []int32{
-	2, // 0: api.TopResponse.repos:type_name -> api.Repo
-	0, // 1: api.Stats.TopN:input_type -> api.NRequest
-	3, // 2: api.Stats.Healthy:input_type -> api.Empty
-	1, // 3: api.Stats.TopN:output_type -> api.TopResponse
-	4, // 4: api.Stats.Healthy:output_type -> api.HealthyResponse
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+
+// Deprecated: Use TimeSeriesResponse.ProtoReflect.Descriptor instead.
+func (*TimeSeriesResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{5}
 }
 
-func init() { file_service_proto_init() }
-func file_service_proto_init() {
-	if File_service_proto != nil {
-		return
+func (x *TimeSeriesResponse) GetRepoId() int64 {
+	if x != nil {
+		return x.RepoId
+	}
+	return 0
+}
+
+func (x *TimeSeriesResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *TimeSeriesResponse) GetPoints() []*TimeSeriesPoint {
+	if x != nil {
+		return x.Points
+	}
+	return nil
+}
+
+type IngestionStatusRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Начало диапазона (включительно); по умолчанию за сутки до end.
+	Start *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	// Конец диапазона (не включительно); по умолчанию начало текущего часа.
+	End           *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestionStatusRequest) Reset() {
+	*x = IngestionStatusRequest{}
+	mi := &file_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestionStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestionStatusRequest) ProtoMessage() {}
+
+func (x *IngestionStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestionStatusRequest.ProtoReflect.Descriptor instead.
+func (*IngestionStatusRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *IngestionStatusRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *IngestionStatusRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+// IngestedHour содержит запись журнала загрузки одного часа.
+type IngestedHour struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Hour  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=hour,proto3" json:"hour,omitempty"`
+	// Статус: completed, failed или in_progress.
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// Число неудачных попыток.
+	Attempts        uint32 `protobuf:"varint,3,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	LastError       string `protobuf:"bytes,4,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	BytesDownloaded uint64 `protobuf:"varint,5,opt,name=bytes_downloaded,json=bytesDownloaded,proto3" json:"bytes_downloaded,omitempty"`
+	LinesParsed     uint64 `protobuf:"varint,6,opt,name=lines_parsed,json=linesParsed,proto3" json:"lines_parsed,omitempty"`
+	ParseFailures   uint64 `protobuf:"varint,7,opt,name=parse_failures,json=parseFailures,proto3" json:"parse_failures,omitempty"`
+	// Опубликованные в Kafka события.
+	EventsProduced uint64                 `protobuf:"varint,8,opt,name=events_produced,json=eventsProduced,proto3" json:"events_produced,omitempty"`
+	SendFailures   uint64                 `protobuf:"varint,9,opt,name=send_failures,json=sendFailures,proto3" json:"send_failures,omitempty"`
+	DurationMs     uint64                 `protobuf:"varint,10,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	UpdatedAt      *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	// Строки, пропущенные из-за превышения длины.
+	OversizedLines uint64 `protobuf:"varint,12,opt,name=oversized_lines,json=oversizedLines,proto3" json:"oversized_lines,omitempty"`
+	// Дамп поврежден, загружена только его начальная часть.
+	Truncated bool `protobuf:"varint,13,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	// События, отброшенные правилами фильтра ingestion.
+	FilteredEvents uint64 `protobuf:"varint,14,opt,name=filtered_events,json=filteredEvents,proto3" json:"filtered_events,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *IngestedHour) Reset() {
+	*x = IngestedHour{}
+	mi := &file_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestedHour) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestedHour) ProtoMessage() {}
+
+func (x *IngestedHour) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestedHour.ProtoReflect.Descriptor instead.
+func (*IngestedHour) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *IngestedHour) GetHour() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Hour
+	}
+	return nil
+}
+
+func (x *IngestedHour) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *IngestedHour) GetAttempts() uint32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *IngestedHour) GetBytesDownloaded() uint64 {
+	if x != nil {
+		return x.BytesDownloaded
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetLinesParsed() uint64 {
+	if x != nil {
+		return x.LinesParsed
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetParseFailures() uint64 {
+	if x != nil {
+		return x.ParseFailures
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetEventsProduced() uint64 {
+	if x != nil {
+		return x.EventsProduced
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetSendFailures() uint64 {
+	if x != nil {
+		return x.SendFailures
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetDurationMs() uint64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *IngestedHour) GetOversizedLines() uint64 {
+	if x != nil {
+		return x.OversizedLines
+	}
+	return 0
+}
+
+func (x *IngestedHour) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *IngestedHour) GetFilteredEvents() uint64 {
+	if x != nil {
+		return x.FilteredEvents
+	}
+	return 0
+}
+
+type IngestionStatusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Hours []*IngestedHour        `protobuf:"bytes,1,rep,name=hours,proto3" json:"hours,omitempty"`
+	// Часы диапазона, для которых нет записи в журнале.
+	Missing       []*timestamppb.Timestamp `protobuf:"bytes,2,rep,name=missing,proto3" json:"missing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestionStatusResponse) Reset() {
+	*x = IngestionStatusResponse{}
+	mi := &file_service_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestionStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestionStatusResponse) ProtoMessage() {}
+
+func (x *IngestionStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestionStatusResponse.ProtoReflect.Descriptor instead.
+func (*IngestionStatusResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *IngestionStatusResponse) GetHours() []*IngestedHour {
+	if x != nil {
+		return x.Hours
+	}
+	return nil
+}
+
+func (x *IngestionStatusResponse) GetMissing() []*timestamppb.Timestamp {
+	if x != nil {
+		return x.Missing
+	}
+	return nil
+}
+
+type StarEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Репозиторий; не задан — события всех репозиториев.
+	//
+	// Types that are valid to be assigned to Repo:
+	//
+	//	*StarEventsRequest_Name
+	//	*StarEventsRequest_Id
+	Repo isStarEventsRequest_Repo `protobuf_oneof:"repo"`
+	// Аккаунт; пустое значение — события всех аккаунтов.
+	Actor string `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	// Начало диапазона (включительно).
+	Start *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=start,proto3" json:"start,omitempty"`
+	// Конец диапазона (не включительно); по умолчанию текущий момент.
+	End *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=end,proto3" json:"end,omitempty"`
+	// Размер страницы; по умолчанию 100, не больше 1000.
+	Limit uint32 `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Токен следующей страницы из предыдущего ответа.
+	PageToken     string `protobuf:"bytes,7,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StarEventsRequest) Reset() {
+	*x = StarEventsRequest{}
+	mi := &file_service_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StarEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StarEventsRequest) ProtoMessage() {}
+
+func (x *StarEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StarEventsRequest.ProtoReflect.Descriptor instead.
+func (*StarEventsRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StarEventsRequest) GetRepo() isStarEventsRequest_Repo {
+	if x != nil {
+		return x.Repo
+	}
+	return nil
+}
+
+func (x *StarEventsRequest) GetName() string {
+	if x != nil {
+		if x, ok := x.Repo.(*StarEventsRequest_Name); ok {
+			return x.Name
+		}
+	}
+	return ""
+}
+
+func (x *StarEventsRequest) GetId() int64 {
+	if x != nil {
+		if x, ok := x.Repo.(*StarEventsRequest_Id); ok {
+			return x.Id
+		}
+	}
+	return 0
+}
+
+func (x *StarEventsRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *StarEventsRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *StarEventsRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *StarEventsRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *StarEventsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type isStarEventsRequest_Repo interface {
+	isStarEventsRequest_Repo()
+}
+
+type StarEventsRequest_Name struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3,oneof"`
+}
+
+type StarEventsRequest_Id struct {
+	Id int64 `protobuf:"varint,2,opt,name=id,proto3,oneof"`
+}
+
+func (*StarEventsRequest_Name) isStarEventsRequest_Repo() {}
+
+func (*StarEventsRequest_Id) isStarEventsRequest_Repo() {}
+
+// StarEvent содержит сохраненное событие звезды.
+type StarEvent struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	RepoId    int64                  `protobuf:"varint,2,opt,name=repo_id,json=repoId,proto3" json:"repo_id,omitempty"`
+	RepoName  string                 `protobuf:"bytes,3,opt,name=repo_name,json=repoName,proto3" json:"repo_name,omitempty"`
+	Actor     string                 `protobuf:"bytes,4,opt,name=actor,proto3" json:"actor,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Звезда помечена подозрительной при учете.
+	Flagged       bool `protobuf:"varint,6,opt,name=flagged,proto3" json:"flagged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StarEvent) Reset() {
+	*x = StarEvent{}
+	mi := &file_service_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StarEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StarEvent) ProtoMessage() {}
+
+func (x *StarEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StarEvent.ProtoReflect.Descriptor instead.
+func (*StarEvent) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StarEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *StarEvent) GetRepoId() int64 {
+	if x != nil {
+		return x.RepoId
+	}
+	return 0
+}
+
+func (x *StarEvent) GetRepoName() string {
+	if x != nil {
+		return x.RepoName
+	}
+	return ""
+}
+
+func (x *StarEvent) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *StarEvent) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *StarEvent) GetFlagged() bool {
+	if x != nil {
+		return x.Flagged
+	}
+	return false
+}
+
+type StarEventsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// События по возрастанию времени.
+	Events []*StarEvent `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// Токен следующей страницы; пустой, если страница последняя.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StarEventsResponse) Reset() {
+	*x = StarEventsResponse{}
+	mi := &file_service_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StarEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StarEventsResponse) ProtoMessage() {}
+
+func (x *StarEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StarEventsResponse.ProtoReflect.Descriptor instead.
+func (*StarEventsResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StarEventsResponse) GetEvents() []*StarEvent {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *StarEventsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_service_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{12}
+}
+
+type HealthyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthyResponse) Reset() {
+	*x = HealthyResponse{}
+	mi := &file_service_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthyResponse) ProtoMessage() {}
+
+func (x *HealthyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthyResponse.ProtoReflect.Descriptor instead.
+func (*HealthyResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *HealthyResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+var File_service_proto protoreflect.FileDescriptor
+
+const file_service_proto_rawDesc = "" +
+	"\n" +
+	"\rservice.proto\x12\x03api\x1a\x1fgoogle/protobuf/timestamp.proto\"\x95\x02\n" +
+	"\bNRequest\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x04R\x01n\x12#\n" +
+	"\x06window\x18\x02 \x01(\x0e2\v.api.WindowR\x06window\x120\n" +
+	"\x05start\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12#\n" +
+	"\x06metric\x18\x05 \x01(\x0e2\v.api.MetricR\x06metric\x12*\n" +
+	"\tspam_mode\x18\x06 \x01(\x0e2\r.api.SpamModeR\bspamMode\x12%\n" +
+	"\x0eflagged_weight\x18\a \x01(\x01R\rflaggedWeight\".\n" +
+	"\vTopResponse\x12\x1f\n" +
+	"\x05repos\x18\x01 \x03(\v2\t.api.RepoR\x05repos\"\x9c\x02\n" +
+	"\x04Repo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12&\n" +
+	"\x0fstars_last_hour\x18\x02 \x01(\x04R\rstarsLastHour\x12\x1f\n" +
+	"\vtotal_stars\x18\x03 \x01(\x04R\n" +
+	"totalStars\x12!\n" +
+	"\fwindow_stars\x18\x04 \x01(\x04R\vwindowStars\x12!\n" +
+	"\fwindow_count\x18\x05 \x01(\x04R\vwindowCount\x12\x1f\n" +
+	"\vtotal_count\x18\x06 \x01(\x04R\n" +
+	"totalCount\x12#\n" +
+	"\rflagged_stars\x18\a \x01(\x04R\fflaggedStars\x12+\n" +
+	"\x11unique_stargazers\x18\b \x01(\x04R\x10uniqueStargazers\"\xd7\x01\n" +
+	"\x11TimeSeriesRequest\x12\x14\n" +
+	"\x04name\x18\x01 \x01(\tH\x00R\x04name\x12\x10\n" +
+	"\x02id\x18\x02 \x01(\x03H\x00R\x02id\x120\n" +
+	"\x05start\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x122\n" +
+	"\vgranularity\x18\x05 \x01(\x0e2\x10.api.GranularityR\vgranularityB\x06\n" +
+	"\x04repo\"[\n" +
+	"\x0fTimeSeriesPoint\x122\n" +
+	"\x06bucket\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x06bucket\x12\x14\n" +
+	"\x05stars\x18\x02 \x01(\x04R\x05stars\"o\n" +
+	"\x12TimeSeriesResponse\x12\x17\n" +
+	"\arepo_id\x18\x01 \x01(\x03R\x06repoId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12,\n" +
+	"\x06points\x18\x03 \x03(\v2\x14.api.TimeSeriesPointR\x06points\"x\n" +
+	"\x16IngestionStatusRequest\x120\n" +
+	"\x05start\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\"\xa0\x04\n" +
+	"\fIngestedHour\x12.\n" +
+	"\x04hour\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04hour\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1a\n" +
+	"\battempts\x18\x03 \x01(\rR\battempts\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\x04 \x01(\tR\tlastError\x12)\n" +
+	"\x10bytes_downloaded\x18\x05 \x01(\x04R\x0fbytesDownloaded\x12!\n" +
+	"\flines_parsed\x18\x06 \x01(\x04R\vlinesParsed\x12%\n" +
+	"\x0eparse_failures\x18\a \x01(\x04R\rparseFailures\x12'\n" +
+	"\x0fevents_produced\x18\b \x01(\x04R\x0eeventsProduced\x12#\n" +
+	"\rsend_failures\x18\t \x01(\x04R\fsendFailures\x12\x1f\n" +
+	"\vduration_ms\x18\n" +
+	" \x01(\x04R\n" +
+	"durationMs\x129\n" +
+	"\n" +
+	"updated_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12'\n" +
+	"\x0foversized_lines\x18\f \x01(\x04R\x0eoversizedLines\x12\x1c\n" +
+	"\ttruncated\x18\r \x01(\bR\ttruncated\x12'\n" +
+	"\x0ffiltered_events\x18\x0e \x01(\x04R\x0efilteredEvents\"x\n" +
+	"\x17IngestionStatusResponse\x12'\n" +
+	"\x05hours\x18\x01 \x03(\v2\x11.api.IngestedHourR\x05hours\x124\n" +
+	"\amissing\x18\x02 \x03(\v2\x1a.google.protobuf.TimestampR\amissing\"\xee\x01\n" +
+	"\x11StarEventsRequest\x12\x14\n" +
+	"\x04name\x18\x01 \x01(\tH\x00R\x04name\x12\x10\n" +
+	"\x02id\x18\x02 \x01(\x03H\x00R\x02id\x12\x14\n" +
+	"\x05actor\x18\x03 \x01(\tR\x05actor\x120\n" +
+	"\x05start\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x14\n" +
+	"\x05limit\x18\x06 \x01(\rR\x05limit\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\a \x01(\tR\tpageTokenB\x06\n" +
+	"\x04repo\"\xbc\x01\n" +
+	"\tStarEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\arepo_id\x18\x02 \x01(\x03R\x06repoId\x12\x1b\n" +
+	"\trepo_name\x18\x03 \x01(\tR\brepoName\x12\x14\n" +
+	"\x05actor\x18\x04 \x01(\tR\x05actor\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x18\n" +
+	"\aflagged\x18\x06 \x01(\bR\aflagged\"d\n" +
+	"\x12StarEventsResponse\x12&\n" +
+	"\x06events\x18\x01 \x03(\v2\x0e.api.StarEventR\x06events\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\a\n" +
+	"\x05Empty\")\n" +
+	"\x0fHealthyResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status*\\\n" +
+	"\x06Window\x12\x14\n" +
+	"\x10WINDOW_LAST_HOUR\x10\x00\x12\x13\n" +
+	"\x0fWINDOW_LAST_DAY\x10\x01\x12\x14\n" +
+	"\x10WINDOW_LAST_WEEK\x10\x02\x12\x11\n" +
+	"\rWINDOW_CUSTOM\x10\x03*\x89\x01\n" +
+	"\x06Metric\x12\x10\n" +
+	"\fMETRIC_STARS\x10\x00\x12\x10\n" +
+	"\fMETRIC_FORKS\x10\x01\x12\x15\n" +
+	"\x11METRIC_PRS_OPENED\x10\x02\x12\x15\n" +
+	"\x11METRIC_PRS_MERGED\x10\x03\x12\x18\n" +
+	"\x14METRIC_ISSUES_OPENED\x10\x04\x12\x13\n" +
+	"\x0fMETRIC_RELEASES\x10\x05*P\n" +
+	"\bSpamMode\x12\x15\n" +
+	"\x11SPAM_MODE_INCLUDE\x10\x00\x12\x15\n" +
+	"\x11SPAM_MODE_EXCLUDE\x10\x01\x12\x16\n" +
+	"\x12SPAM_MODE_DISCOUNT\x10\x02*e\n" +
+	"\vGranularity\x12\x14\n" +
+	"\x10GRANULARITY_HOUR\x10\x00\x12\x13\n" +
+	"\x0fGRANULARITY_DAY\x10\x01\x12\x14\n" +
+	"\x10GRANULARITY_WEEK\x10\x02\x12\x15\n" +
+	"\x11GRANULARITY_MONTH\x10\x032\xad\x02\n" +
+	"\x05Stats\x12'\n" +
+	"\x04TopN\x12\r.api.NRequest\x1a\x10.api.TopResponse\x12+\n" +
+	"\aHealthy\x12\n" +
+	".api.Empty\x1a\x14.api.HealthyResponse\x12A\n" +
+	"\x0eRepoTimeSeries\x12\x16.api.TimeSeriesRequest\x1a\x17.api.TimeSeriesResponse\x12L\n" +
+	"\x0fIngestionStatus\x12\x1b.api.IngestionStatusRequest\x1a\x1c.api.IngestionStatusResponse\x12=\n" +
+	"\n" +
+	"StarEvents\x12\x16.api.StarEventsRequest\x1a\x17.api.StarEventsResponseB0Z.github.com/kun1ts4/stars-analytics/proto;protob\x06proto3"
+
+var (
+	file_service_proto_rawDescOnce sync.Once
+	file_service_proto_rawDescData []byte
+)
+
+func file_service_proto_rawDescGZIP() []byte {
+	file_service_proto_rawDescOnce.Do(func() {
+		file_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)))
+	})
+	return file_service_proto_rawDescData
+}
+
+var file_service_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_service_proto_goTypes = []any{
+	(Window)(0),                     // 0: api.Window
+	(Metric)(0),                     // 1: api.Metric
+	(SpamMode)(0),                   // 2: api.SpamMode
+	(Granularity)(0),                // 3: api.Granularity
+	(*NRequest)(nil),                // 4: api.NRequest
+	(*TopResponse)(nil),             // 5: api.TopResponse
+	(*Repo)(nil),                    // 6: api.Repo
+	(*TimeSeriesRequest)(nil),       // 7: api.TimeSeriesRequest
+	(*TimeSeriesPoint)(nil),         // 8: api.TimeSeriesPoint
+	(*TimeSeriesResponse)(nil),      // 9: api.TimeSeriesResponse
+	(*IngestionStatusRequest)(nil),  // 10: api.IngestionStatusRequest
+	(*IngestedHour)(nil),            // 11: api.IngestedHour
+	(*IngestionStatusResponse)(nil), // 12: api.IngestionStatusResponse
+	(*StarEventsRequest)(nil),       // 13: api.StarEventsRequest
+	(*StarEvent)(nil),               // 14: api.StarEvent
+	(*StarEventsResponse)(nil),      // 15: api.StarEventsResponse
+	(*Empty)(nil),                   // 16: api.Empty
+	(*HealthyResponse)(nil),         // 17: api.HealthyResponse
+	(*timestamppb.Timestamp)(nil),   // 18: google.protobuf.Timestamp
+}
+var file_service_proto_depIdxs = []int32{
+	0,  // 0: api.NRequest.window:type_name -> api.Window
+	18, // 1: api.NRequest.start:type_name -> google.protobuf.Timestamp
+	18, // 2: api.NRequest.end:type_name -> google.protobuf.Timestamp
+	1,  // 3: api.NRequest.metric:type_name -> api.Metric
+	2,  // 4: api.NRequest.spam_mode:type_name -> api.SpamMode
+	6,  // 5: api.TopResponse.repos:type_name -> api.Repo
+	18, // 6: api.TimeSeriesRequest.start:type_name -> google.protobuf.Timestamp
+	18, // 7: api.TimeSeriesRequest.end:type_name -> google.protobuf.Timestamp
+	3,  // 8: api.TimeSeriesRequest.granularity:type_name -> api.Granularity
+	18, // 9: api.TimeSeriesPoint.bucket:type_name -> google.protobuf.Timestamp
+	8,  // 10: api.TimeSeriesResponse.points:type_name -> api.TimeSeriesPoint
+	18, // 11: api.IngestionStatusRequest.start:type_name -> google.protobuf.Timestamp
+	18, // 12: api.IngestionStatusRequest.end:type_name -> google.protobuf.Timestamp
+	18, // 13: api.IngestedHour.hour:type_name -> google.protobuf.Timestamp
+	18, // 14: api.IngestedHour.updated_at:type_name -> google.protobuf.Timestamp
+	11, // 15: api.IngestionStatusResponse.hours:type_name -> api.IngestedHour
+	18, // 16: api.IngestionStatusResponse.missing:type_name -> google.protobuf.Timestamp
+	18, // 17: api.StarEventsRequest.start:type_name -> google.protobuf.Timestamp
+	18, // 18: api.StarEventsRequest.end:type_name -> google.protobuf.Timestamp
+	18, // 19: api.StarEvent.created_at:type_name -> google.protobuf.Timestamp
+	14, // 20: api.StarEventsResponse.events:type_name -> api.StarEvent
+	4,  // 21: api.Stats.TopN:input_type -> api.NRequest
+	16, // 22: api.Stats.Healthy:input_type -> api.Empty
+	7,  // 23: api.Stats.RepoTimeSeries:input_type -> api.TimeSeriesRequest
+	10, // 24: api.Stats.IngestionStatus:input_type -> api.IngestionStatusRequest
+	13, // 25: api.Stats.StarEvents:input_type -> api.StarEventsRequest
+	5,  // 26: api.Stats.TopN:output_type -> api.TopResponse
+	17, // 27: api.Stats.Healthy:output_type -> api.HealthyResponse
+	9,  // 28: api.Stats.RepoTimeSeries:output_type -> api.TimeSeriesResponse
+	12, // 29: api.Stats.IngestionStatus:output_type -> api.IngestionStatusResponse
+	15, // 30: api.Stats.StarEvents:output_type -> api.StarEventsResponse
+	26, // [26:31] is the sub-list for method output_type
+	21, // [21:26] is the sub-list for method input_type
+	21, // [21:21] is the sub-list for extension type_name
+	21, // [21:21] is the sub-list for extension extendee
+	0,  // [0:21] is the sub-list for field type_name
+}
+
+func init() { file_service_proto_init() }
+func file_service_proto_init() {
+	if File_service_proto != nil {
+		return
+	}
+	file_service_proto_msgTypes[3].OneofWrappers = []any{
+		(*TimeSeriesRequest_Name)(nil),
+		(*TimeSeriesRequest_Id)(nil),
+	}
+	file_service_proto_msgTypes[9].OneofWrappers = []any{
+		(*StarEventsRequest_Name)(nil),
+		(*StarEventsRequest_Id)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   5,
+			NumEnums:      4,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_service_proto_goTypes,
 		DependencyIndexes: file_service_proto_depIdxs,
+		EnumInfos:         file_service_proto_enumTypes,
 		MessageInfos:      file_service_proto_msgTypes,
 	}.Build()
 	File_service_proto = out.File
@@ -19,8 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Stats_TopN_FullMethodName    = "/api.Stats/TopN"
-	Stats_Healthy_FullMethodName = "/api.Stats/Healthy"
+	Stats_TopN_FullMethodName            = "/api.Stats/TopN"
+	Stats_Healthy_FullMethodName         = "/api.Stats/Healthy"
+	Stats_RepoTimeSeries_FullMethodName  = "/api.Stats/RepoTimeSeries"
+	Stats_IngestionStatus_FullMethodName = "/api.Stats/IngestionStatus"
+	Stats_StarEvents_FullMethodName      = "/api.Stats/StarEvents"
 )
 
 // StatsClient is the client API for Stats service.
@@ -29,6 +32,9 @@ const (
 type StatsClient interface {
 	TopN(ctx context.Context, in *NRequest, opts ...grpc.CallOption) (*TopResponse, error)
 	Healthy(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthyResponse, error)
+	RepoTimeSeries(ctx context.Context, in *TimeSeriesRequest, opts ...grpc.CallOption) (*TimeSeriesResponse, error)
+	IngestionStatus(ctx context.Context, in *IngestionStatusRequest, opts ...grpc.CallOption) (*IngestionStatusResponse, error)
+	StarEvents(ctx context.Context, in *StarEventsRequest, opts ...grpc.CallOption) (*StarEventsResponse, error)
 }
 
 type statsClient struct {
@@ -59,12 +65,45 @@ func (c *statsClient) Healthy(ctx context.Context, in *Empty, opts ...grpc.CallO
 	return out, nil
 }
 
+func (c *statsClient) RepoTimeSeries(ctx context.Context, in *TimeSeriesRequest, opts ...grpc.CallOption) (*TimeSeriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TimeSeriesResponse)
+	err := c.cc.Invoke(ctx, Stats_RepoTimeSeries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *statsClient) IngestionStatus(ctx context.Context, in *IngestionStatusRequest, opts ...grpc.CallOption) (*IngestionStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IngestionStatusResponse)
+	err := c.cc.Invoke(ctx, Stats_IngestionStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *statsClient) StarEvents(ctx context.Context, in *StarEventsRequest, opts ...grpc.CallOption) (*StarEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StarEventsResponse)
+	err := c.cc.Invoke(ctx, Stats_StarEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // StatsServer is the server API for Stats service.
 // All implementations must embed UnimplementedStatsServer
 // for forward compatibility.
 type StatsServer interface {
 	TopN(context.Context, *NRequest) (*TopResponse, error)
 	Healthy(context.Context, *Empty) (*HealthyResponse, error)
+	RepoTimeSeries(context.Context, *TimeSeriesRequest) (*TimeSeriesResponse, error)
+	IngestionStatus(context.Context, *IngestionStatusRequest) (*IngestionStatusResponse, error)
+	StarEvents(context.Context, *StarEventsRequest) (*StarEventsResponse, error)
 	mustEmbedUnimplementedStatsServer()
 }
 
@@ -81,6 +120,15 @@ func (UnimplementedStatsServer) TopN(context.Context, *NRequest) (*TopResponse,
 func (UnimplementedStatsServer) Healthy(context.Context, *Empty) (*HealthyResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Healthy not implemented")
 }
+func (UnimplementedStatsServer) RepoTimeSeries(context.Context, *TimeSeriesRequest) (*TimeSeriesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RepoTimeSeries not implemented")
+}
+func (UnimplementedStatsServer) IngestionStatus(context.Context, *IngestionStatusRequest) (*IngestionStatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method IngestionStatus not implemented")
+}
+func (UnimplementedStatsServer) StarEvents(context.Context, *StarEventsRequest) (*StarEventsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method StarEvents not implemented")
+}
 func (UnimplementedStatsServer) mustEmbedUnimplementedStatsServer() {}
 func (UnimplementedStatsServer) testEmbeddedByValue()               {}
 
@@ -138,6 +186,60 @@ func _Stats_Healthy_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Stats_RepoTimeSeries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TimeSeriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StatsServer).RepoTimeSeries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stats_RepoTimeSeries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StatsServer).RepoTimeSeries(ctx, req.(*TimeSeriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stats_IngestionStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IngestionStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StatsServer).IngestionStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stats_IngestionStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StatsServer).IngestionStatus(ctx, req.(*IngestionStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stats_StarEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StarEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StatsServer).StarEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stats_StarEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StatsServer).StarEvents(ctx, req.(*StarEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Stats_ServiceDesc is the grpc.ServiceDesc for Stats service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,6 +255,18 @@ var Stats_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Healthy",
 			Handler:    _Stats_Healthy_Handler,
 		},
+		{
+			MethodName: "RepoTimeSeries",
+			Handler:    _Stats_RepoTimeSeries_Handler,
+		},
+		{
+			MethodName: "IngestionStatus",
+			Handler:    _Stats_IngestionStatus_Handler,
+		},
+		{
+			MethodName: "StarEvents",
+			Handler:    _Stats_StarEvents_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "service.proto",